@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	// Embed the timezone database so --timezone works where the OS has none
+	_ "time/tzdata"
 
 	"github.com/wdm0006/vanity/internal/cli"
 )
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var configScope string
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and change sync settings",
+	Long: `Shows and changes the settings 'vanity sync' uses when the matching flag
+isn't given, so a group doesn't have to remember the same flags.
+
+Settings are read from three files in git's config format, each overriding
+the one before:
+
+  shared    .vanity/config, committed so every collaborator follows it
+  user      vanity/config in your XDG config directory (~/.config on Linux)
+  local     .git/vanity/config, this clone only
+
+Flags passed to 'vanity sync' override all of them. 'vanity config list'
+shows every setting with its effective value and where it came from.
+
+Changes to the shared file are committed and pushed by your next sync.`,
+	Example: `  # Show every setting
+  vanity config list
+
+  # Push in smaller batches, for everyone
+  vanity config set sync.batchSize 50
+
+  # Mirror days in your own timezone, just for you
+  vanity config set --scope user sync.timezone Europe/Berlin`,
+	Args: cobra.NoArgs,
+	RunE: runConfigList,
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show every setting and where its value comes from",
+	Args:  cobra.NoArgs,
+	RunE:  runConfigList,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a setting",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+			return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+		}
+		value, err := syncpkg.GetSetting(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value.Value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := openConfigScope()
+		if err != nil {
+			return err
+		}
+		if err := syncpkg.SetSetting(scope, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s to %q in the %s config\n", args[0], args[1], scope)
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a setting, falling back to the next file or the default",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scope, err := openConfigScope()
+		if err != nil {
+			return err
+		}
+		if err := syncpkg.UnsetSetting(scope, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s from the %s config\n", args[0], scope)
+		return nil
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{configSetCmd, configUnsetCmd} {
+		cmd.Flags().StringVar(&configScope, "scope", string(syncpkg.ScopeShared), "Config file to change: shared, user or local")
+	}
+	configCmd.AddCommand(configListCmd, configGetCmd, configSetCmd, configUnsetCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigList(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	values, err := syncpkg.ListSettings()
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		value := v.Value
+		if value == "" {
+			value = "(unset)"
+		}
+		fmt.Printf("%-20s %-16s %-8s %s\n", v.Key, value, v.Scope, v.Help)
+	}
+	return nil
+}
+
+// openConfigScope parses --scope for a command that writes settings
+func openConfigScope() (syncpkg.SettingsScope, error) {
+	scope, err := syncpkg.ParseSettingsScope(configScope)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) && scope != syncpkg.ScopeUser {
+		return "", fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	return scope, nil
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var consentCmd = &cobra.Command{
+	Use:   "consent",
+	Short: "Choose who may mirror your contributions",
+	Long: `Shows and edits what other accounts may do with your contributions. Consent
+is stored in your own contribution file, which you sign, and every other
+account's 'vanity sync' honours it before creating mirror commits.
+
+  deny      nobody mirrors your contributions
+  allow     only the given accounts mirror them; no accounts allows everyone
+  pause     nobody mirrors them before a date; your days are mirrored after
+  resume    end a pause
+
+Mirror commits that already exist are not removed. Changes are pushed by
+your next 'vanity sync'.`,
+	Example: `  # Show your consent
+  vanity consent
+
+  # Only let your work account mirror your contributions
+  vanity consent allow work-account
+
+  # Pause mirroring until the new year
+  vanity consent pause 2027-01-01`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		state, naming, err := loadOwnState()
+		if err != nil {
+			return err
+		}
+		data, err := syncpkg.LoadContributionData(state.Username)
+		if err != nil {
+			return fmt.Errorf("failed to load contribution data: %w", err)
+		}
+		fmt.Printf("Consent: %s\n", data.Consent.Describe(naming))
+		return nil
+	},
+}
+
+var consentDenyCmd = &cobra.Command{
+	Use:   "deny",
+	Short: "Let nobody mirror your contributions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConsent(func(c *syncpkg.Consent, naming *syncpkg.Naming) error {
+			c.Deny = true
+			return nil
+		})
+	},
+}
+
+var consentAllowCmd = &cobra.Command{
+	Use:   "allow [account...]",
+	Short: "Let only these accounts mirror your contributions (none lets everyone)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConsent(func(c *syncpkg.Consent, naming *syncpkg.Naming) error {
+			c.Deny = false
+			c.AllowInto = nil
+			for _, login := range args {
+				if err := syncpkg.ValidateLogin(login); err != nil {
+					return err
+				}
+				if err := naming.Remember(login); err != nil {
+					return err
+				}
+				c.AllowInto = append(c.AllowInto, naming.Name(login))
+			}
+			return nil
+		})
+	},
+}
+
+var consentPauseCmd = &cobra.Command{
+	Use:   "pause <date>",
+	Short: "Let nobody mirror your contributions before a date (YYYY-MM-DD)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := time.Parse("2006-01-02", args[0]); err != nil {
+			return fmt.Errorf("invalid date %q (want YYYY-MM-DD)", args[0])
+		}
+		return updateConsent(func(c *syncpkg.Consent, naming *syncpkg.Naming) error {
+			c.PausedUntil = args[0]
+			return nil
+		})
+	},
+}
+
+var consentResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "End a pause",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConsent(func(c *syncpkg.Consent, naming *syncpkg.Naming) error {
+			c.PausedUntil = ""
+			return nil
+		})
+	},
+}
+
+func init() {
+	consentCmd.AddCommand(consentDenyCmd, consentAllowCmd, consentPauseCmd, consentResumeCmd)
+	rootCmd.AddCommand(consentCmd)
+}
+
+// updateConsent applies a change to the current user's consent, saves it and
+// shows the result
+func updateConsent(change func(*syncpkg.Consent, *syncpkg.Naming) error) error {
+	state, naming, err := loadOwnState()
+	if err != nil {
+		return err
+	}
+	consent, err := syncpkg.UpdateConsent(state.Username, func(c *syncpkg.Consent) error {
+		return change(c, naming)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Consent: %s\n", consent.Describe(naming))
+	return nil
+}
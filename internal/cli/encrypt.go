@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var (
+	encryptGroup   bool
+	encryptLabel   string
+	encryptJoinKey string
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt contribution data in the shared repo",
+	Long: `Shows and manages encryption of the .vanity/ contribution and state files,
+the sources manifest and the departures list. Once enabled, each is read and
+written through AES-256-GCM, so a leaked clone or an accidentally public fork
+shows only ciphertext and empty commits. Shared settings (.vanity/config) and
+registered public keys (.vanity/keys/) stay readable.
+
+Two modes are available:
+  group     one shared key; every collaborator stores it with 'join'
+  x25519    each collaborator has their own key pair and files are encrypted
+            to every listed recipient, so nobody shares a secret
+
+  init      encrypt the repo (--group for a shared key, X25519 otherwise)
+  join      store the group key of a repo that is already encrypted
+  keygen    create this clone's X25519 key pair and print its recipient
+  add       let another recipient read the files (X25519 mode)
+  remove    stop encrypting to a recipient (X25519 mode)
+
+Keys live in this clone's .git/vanity/config and are never committed; the
+repo's .vanity/encryption only holds the mode, public recipients and a check
+value for the group key. Files committed before encryption stay readable in
+history until it is rebuilt with 'vanity sync --rebuild'.`,
+	Example: `  # Encrypt with a shared group key, then tell collaborators the key
+  vanity encrypt init --group
+  vanity encrypt join --key <key>
+
+  # Encrypt to individual keys
+  vanity encrypt init --label alice-laptop
+  vanity encrypt keygen                       # run by bob, prints his recipient
+  vanity encrypt add 'x25519:... bob-desktop' # run by alice`,
+	Args: cobra.NoArgs,
+	RunE: runEncryptShow,
+}
+
+var encryptInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Encrypt every file in .vanity/ and commit the result",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireUnencrypted(); err != nil {
+			return err
+		}
+		if encryptGroup {
+			key, err := syncpkg.EnableGroupEncryption()
+			if err != nil {
+				return err
+			}
+			fmt.Println("Encrypted .vanity/ with a new group key and committed the change.")
+			fmt.Printf("\nShare this key privately with every collaborator:\n  %s\n", key)
+			fmt.Println("\nThey run 'vanity encrypt join --key <key>' after pulling. Run 'vanity sync' to push.")
+			return nil
+		}
+
+		if err := syncpkg.EnableRecipientEncryption(encryptLabel); err != nil {
+			return err
+		}
+		self, err := syncpkg.Identity()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Encrypted .vanity/ to your key (%s) and committed the change.\n", self.ID())
+		fmt.Println("\nCollaborators run 'vanity encrypt keygen' and send you the recipient it prints;")
+		fmt.Println("add each with 'vanity encrypt add <recipient>'. Run 'vanity sync' to push.")
+		return nil
+	},
+}
+
+var encryptJoinCmd = &cobra.Command{
+	Use:   "join",
+	Short: "Store the group key of an encrypted repo",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if encryptJoinKey == "" {
+			return fmt.Errorf("--key is required")
+		}
+		if err := syncpkg.JoinGroupEncryption(encryptJoinKey); err != nil {
+			return err
+		}
+		fmt.Println("Group key stored; this clone can read and write the encrypted files.")
+		return nil
+	},
+}
+
+var encryptKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Create this clone's X25519 key pair and print its recipient",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		self, err := syncpkg.Identity()
+		if err != nil {
+			return err
+		}
+		self.Label = encryptLabel
+		fmt.Println(self)
+		return nil
+	},
+}
+
+var encryptAddCmd = &cobra.Command{
+	Use:   "add <recipient>",
+	Short: "Re-encrypt every file so another recipient can read it",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Recipients are usually pasted unquoted, label and all.
+		r, err := syncpkg.ParseRecipient(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if err := syncpkg.AddRecipient(r); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s and committed the re-encrypted files. Run 'vanity sync' to push.\n", r.ID())
+		return nil
+	},
+}
+
+var encryptRemoveCmd = &cobra.Command{
+	Use:   "remove <id|label>",
+	Short: "Re-encrypt every file without a recipient",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := syncpkg.RemoveRecipient(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s and committed the re-encrypted files. Run 'vanity sync' to push.\n", args[0])
+		fmt.Println("Copies they already pulled stay readable to them.")
+		return nil
+	},
+}
+
+func init() {
+	encryptInitCmd.Flags().BoolVar(&encryptGroup, "group", false, "Use one shared group key instead of X25519 recipients")
+	encryptInitCmd.Flags().StringVar(&encryptLabel, "label", "", "Label for your recipient entry (X25519 mode)")
+	encryptKeygenCmd.Flags().StringVar(&encryptLabel, "label", "", "Label to print with the recipient")
+	encryptJoinCmd.Flags().StringVar(&encryptJoinKey, "key", "", "Group key (hex)")
+	encryptCmd.AddCommand(encryptInitCmd, encryptJoinCmd, encryptKeygenCmd, encryptAddCmd, encryptRemoveCmd)
+	rootCmd.AddCommand(encryptCmd)
+}
+
+func runEncryptShow(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	settings, err := syncpkg.LoadEncryptionSettings()
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		fmt.Println("Not encrypted: .vanity/ files are plain JSON.")
+		return nil
+	}
+
+	fmt.Printf("Encrypted (%s mode).\n", settings.Mode)
+	for _, r := range settings.Recipients {
+		label := r.Label
+		if label == "" {
+			label = "(no label)"
+		}
+		fmt.Printf("  - %s %s\n", r.ID(), label)
+	}
+	return nil
+}
+
+func requireUnencrypted() error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	settings, err := syncpkg.LoadEncryptionSettings()
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		return fmt.Errorf("this repository is already encrypted (%s mode)", settings.Mode)
+	}
+	return nil
+}
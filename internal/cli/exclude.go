@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var excludeCmd = &cobra.Command{
+	Use:   "exclude",
+	Short: "Keep repositories out of your exported counts",
+	Long: `Shows and edits the repositories whose contributions are subtracted from
+your daily counts before they are written to .vanity/.
+
+  add       exclude a repository (owner/name) or a whole owner (owner)
+  remove    count a repository again
+
+Patterns may use shell wildcards and match case-insensitively. The list is
+kept in this clone's .git/vanity/config and is never committed, so repository
+names never reach the shared repo. Changes apply on your next 'vanity sync'.`,
+	Example: `  # Show excluded repositories
+  vanity exclude
+
+  # Exclude every repository of an organization
+  vanity exclude add acme
+
+  # Exclude one repository, and a family of them
+  vanity exclude add me/side-project 'acme-labs/*-internal'
+
+  # Count a repository again
+  vanity exclude remove me/side-project`,
+	Args: cobra.NoArgs,
+	RunE: runExcludeShow,
+}
+
+var excludeAddCmd = &cobra.Command{
+	Use:   "add <pattern>...",
+	Short: "Exclude repositories from your exported counts",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, arg := range args {
+			pattern, err := syncpkg.ExcludeRepo(arg)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Excluding %s\n", pattern)
+		}
+		fmt.Println("\nYour next 'vanity sync' re-exports your calendar without them.")
+		return nil
+	},
+}
+
+var excludeRemoveCmd = &cobra.Command{
+	Use:   "remove <pattern>...",
+	Short: "Count excluded repositories again",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, arg := range args {
+			pattern, err := syncpkg.IncludeRepo(arg)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("No longer excluding %s\n", pattern)
+		}
+		fmt.Println("\nYour next 'vanity sync' re-exports your calendar with them.")
+		return nil
+	},
+}
+
+func init() {
+	excludeCmd.AddCommand(excludeAddCmd, excludeRemoveCmd)
+	rootCmd.AddCommand(excludeCmd)
+}
+
+func runExcludeShow(cmd *cobra.Command, args []string) error {
+	patterns, err := syncpkg.ExcludedRepos()
+	if err != nil {
+		return fmt.Errorf("failed to read excluded repositories: %w", err)
+	}
+	if len(patterns) == 0 {
+		fmt.Println("No excluded repositories; every contribution is exported.")
+		return nil
+	}
+	for _, p := range patterns {
+		fmt.Printf("  - %s\n", p)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/wdm0006/vanity/internal/github"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var (
+	windowFrom string
+	windowTo   string
+)
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Choose which contributions you mirror",
+	Long: `Shows and edits your mirror filters. Filters are stored in your own sync
+state, so they only affect what your account mirrors.
+
+  skip       never mirror a source
+  include    undo skip
+  window     only mirror a source between two dates
+  years      only mirror the last N years from every source
+
+Filtered-out contributions are reported by 'vanity status' as skipped rather
+than pending. Changes apply on your next 'vanity sync'.`,
+	Example: `  # Show current filters
+  vanity filter
+
+  # Stop mirroring an account
+  vanity filter skip carol
+
+  # Only mirror an old work account up to the day you left
+  vanity filter window old-work --to 2021-06-30
+
+  # Only mirror the last 3 years
+  vanity filter years 3`,
+	Args: cobra.NoArgs,
+	RunE: runFilterShow,
+}
+
+var filterSkipCmd = &cobra.Command{
+	Use:   "skip <source>",
+	Short: "Never mirror a source",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateFilters(func(f *syncpkg.MirrorFilter, naming *syncpkg.Naming) error {
+			f.SetSkipped(naming.Name(args[0]), true)
+			return naming.Remember(args[0])
+		})
+	},
+}
+
+var filterIncludeCmd = &cobra.Command{
+	Use:   "include <source>",
+	Short: "Mirror a skipped source again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateFilters(func(f *syncpkg.MirrorFilter, naming *syncpkg.Naming) error {
+			f.SetSkipped(naming.Name(args[0]), false)
+			return nil
+		})
+	},
+}
+
+var filterWindowCmd = &cobra.Command{
+	Use:   "window <source>",
+	Short: "Only mirror a source between two dates (no flags removes the window)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateFilters(func(f *syncpkg.MirrorFilter, naming *syncpkg.Naming) error {
+			if err := naming.Remember(args[0]); err != nil {
+				return err
+			}
+			return f.SetWindow(naming.Name(args[0]), syncpkg.DateWindow{From: windowFrom, To: windowTo})
+		})
+	},
+}
+
+var filterYearsCmd = &cobra.Command{
+	Use:   "years <n>",
+	Short: "Only mirror the last N years (0 mirrors everything)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		years, err := strconv.Atoi(args[0])
+		if err != nil || years < 0 {
+			return fmt.Errorf("invalid number of years %q", args[0])
+		}
+		return updateFilters(func(f *syncpkg.MirrorFilter, naming *syncpkg.Naming) error {
+			f.LastYears = years
+			return nil
+		})
+	},
+}
+
+func init() {
+	filterWindowCmd.Flags().StringVar(&windowFrom, "from", "", "First date to mirror (YYYY-MM-DD)")
+	filterWindowCmd.Flags().StringVar(&windowTo, "to", "", "Last date to mirror (YYYY-MM-DD)")
+	filterCmd.AddCommand(filterSkipCmd, filterIncludeCmd, filterWindowCmd, filterYearsCmd)
+	rootCmd.AddCommand(filterCmd)
+}
+
+func runFilterShow(cmd *cobra.Command, args []string) error {
+	state, naming, err := loadOwnState()
+	if err != nil {
+		return err
+	}
+	if state.Filters.IsEmpty() {
+		fmt.Println("No mirror filters; every source is mirrored in full.")
+		return nil
+	}
+	printFilters(state.Filters, naming)
+	return nil
+}
+
+// updateFilters applies a change to the current user's filters and saves it.
+// Sources are stored under their names in this repo, so change gets the naming.
+func updateFilters(change func(*syncpkg.MirrorFilter, *syncpkg.Naming) error) error {
+	state, naming, err := loadOwnState()
+	if err != nil {
+		return err
+	}
+	if state.Filters == nil {
+		state.Filters = &syncpkg.MirrorFilter{}
+	}
+	if err := change(state.Filters, naming); err != nil {
+		return err
+	}
+	if state.Filters.IsEmpty() {
+		state.Filters = nil
+	}
+	if err := syncpkg.SaveSyncState(state); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+
+	if state.Filters.IsEmpty() {
+		fmt.Println("No mirror filters; every source is mirrored in full.")
+	} else {
+		printFilters(state.Filters, naming)
+	}
+	fmt.Println("\nFilters apply on your next 'vanity sync'.")
+	return nil
+}
+
+func loadOwnState() (*syncpkg.SyncState, *syncpkg.Naming, error) {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	username, err := github.GetCurrentUser()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	naming, err := syncpkg.LoadNaming()
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := syncpkg.LoadSyncState(naming.Name(username))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load sync state: %w", err)
+	}
+	return state, naming, nil
+}
+
+func printFilters(f *syncpkg.MirrorFilter, naming *syncpkg.Naming) {
+	for _, source := range f.Skip {
+		fmt.Printf("  - skip %s\n", naming.Display(source))
+	}
+	sources := make([]string, 0, len(f.Windows))
+	for source := range f.Windows {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		fmt.Printf("  - %s only %s\n", naming.Display(source), f.Windows[source])
+	}
+	if f.LastYears > 0 {
+		fmt.Printf("  - only the last %d year(s)\n", f.LastYears)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -13,6 +14,9 @@ import (
 
 var (
 	scrapeContributions bool
+	attestMethod        string
+	attestSignature     string
+	importMerge         string
 )
 
 var importCmd = &cobra.Command{
@@ -27,13 +31,39 @@ mirror commits for their contributions.
 
 By default, this uses the GitHub API which only returns public contributions.
 Use --scrape to fetch all contributions (including private) by scraping the
-profile page directly.`,
+profile page directly.
+
+--attest proves the account is yours before importing it. The first run
+prints a one-time code; publish it from that account and run the same
+command again:
+  bio       put the code in the account's profile bio
+  gist      put the code in a public gist of the account
+  ssh       sign the code with an SSH key listed on the account's profile
+            and pass the signature with --signature
+The attestation is recorded in the contribution file. A repo can require it
+for every imported account by setting policy.requireAttestation to true in
+.vanity/config; unattested imports are then refused by import and sync.
+
+Re-importing an account merges with what is already stored (--merge):
+  max       keep every day at the higher count (default), so an API import
+            after a --scrape never loses the private counts
+  union     keep every day, taking the new count where both have one
+  newer     the new import wins for the days it covered; older days stay
+  replace   keep only the new import
+A summary lists the days that were added, rose, fell or disappeared.`,
 	Example: `  # Import public contributions only (via API)
   vanity import old-work-username
 
   # Import ALL contributions including private (via scraping)
   vanity import --scrape old-work-username
 
+  # Correct counts that dropped since the last import
+  vanity import --merge newer old-work-username
+
+  # Prove the account is yours via its bio, then import
+  vanity import --attest bio old-work-username   # prints a code
+  vanity import --attest bio old-work-username   # after adding it to the bio
+
   # Then sync to create mirror commits
   vanity sync`,
 	Args: cobra.ExactArgs(1),
@@ -42,11 +72,21 @@ profile page directly.`,
 
 func init() {
 	importCmd.Flags().BoolVar(&scrapeContributions, "scrape", false, "Scrape contribution graph to include private contributions")
+	importCmd.Flags().StringVar(&attestMethod, "attest", "", "Prove the account is yours first: bio, gist or ssh")
+	importCmd.Flags().StringVar(&attestSignature, "signature", "", "SSH signature of the attestation code (with --attest ssh)")
+	importCmd.Flags().StringVar(&importMerge, "merge", string(sync.MergeMax), "How to combine with data already stored: max, union, newer or replace")
 	rootCmd.AddCommand(importCmd)
 }
 
 func runImport(cmd *cobra.Command, args []string) error {
 	username := args[0]
+	if err := sync.ValidateLogin(username); err != nil {
+		return err
+	}
+	mergeMode, err := sync.ParseMergeMode(importMerge)
+	if err != nil {
+		return err
+	}
 
 	// Check if .vanity exists
 	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
@@ -63,20 +103,53 @@ func runImport(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("you're logged in as %s - use 'vanity sync' instead", username)
 	}
 
-	var contributions []github.Contribution
+	naming, err := sync.LoadNaming()
+	if err != nil {
+		return err
+	}
+
+	attestation, err := attestImport(username, naming.Name(currentUser))
+	if err != nil || (attestation == nil && attestMethod != "") {
+		return err
+	}
+	if attestation != nil && naming.Opaque() {
+		// A gist URL names the account, which opaque mode keeps out of the repo.
+		attestation.Proof = ""
+	}
+
+	// Show what an earlier import left, and how old it is, before merging
+	existing, err := sync.LoadContributionData(naming.Name(username))
+	if err != nil {
+		if mergeMode != sync.MergeReplace {
+			return fmt.Errorf("existing data for %s can't be merged: %w (use --merge replace to overwrite it)", username, err)
+		}
+		fmt.Printf("Warning: replacing unreadable data for %s: %v\n", username, err)
+		existing = nil
+	} else if !existing.LastUpdated.IsZero() {
+		fmt.Printf("Existing data for %s: %s, %s\n", username,
+			existing.Provenance.Describe(naming), sync.Age(existing.LastUpdated, time.Now()))
+	}
 
+	imp := sync.Import{
+		Login:       username,
+		Method:      sync.SourceAPI,
+		Merge:       mergeMode,
+		ImportedBy:  naming.Name(currentUser),
+		ToolVersion: version,
+		Attestation: attestation,
+	}
 	if scrapeContributions {
+		imp.Method = sync.SourceScrape
 		fmt.Printf("Scraping full contribution history from %s (including private)...\n", username)
-		contributions, err = github.ScrapeAllContributions(username)
-		if err != nil {
-			return fmt.Errorf("failed to scrape contributions for %s: %w", username, err)
-		}
 	} else {
-		fmt.Printf("Importing full contribution history from %s (public only)...\n", username)
-		contributions, err = github.FetchAllContributions(username)
-		if err != nil {
-			return fmt.Errorf("failed to fetch contributions for %s: %w", username, err)
+		fmt.Printf("Importing full contribution history from %s...\n", username)
+	}
+	contributions, private, err := imp.Fetch()
+	if err != nil {
+		if scrapeContributions {
+			return fmt.Errorf("failed to scrape contributions for %s: %w", username, err)
 		}
+		return fmt.Errorf("failed to fetch contributions for %s: %w", username, err)
 	}
 
 	if len(contributions) == 0 {
@@ -88,27 +161,116 @@ func runImport(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	syncContribs, totalCount := sortedContributions(contributions)
-
-	// Save to contribution file
-	contribData := &sync.ContributionData{
-		Username:      username,
-		LastUpdated:   time.Now(),
-		Contributions: syncContribs,
+	_, totalCount := sortedContributions(contributions)
+	if !private {
+		fmt.Printf("  %s doesn't share private contribution counts, so only public ones were found\n", username)
 	}
 
-	if err := sync.SaveContributionData(contribData); err != nil {
-		return fmt.Errorf("failed to save contribution data: %w", err)
+	// Save to contribution file, merged with what was stored before
+	_, summary, err := imp.Store(naming, existing, contributions, private, time.Now())
+	if err != nil {
+		return err
+	}
+	if existing != nil && len(existing.Contributions) > 0 {
+		printMergeSummary(mergeMode, summary)
+	}
+	source := sync.Source{Name: naming.Name(username), Method: imp.Method, Host: imp.Host(), Merge: mergeMode}
+	if err := sync.RecordSource(source); err != nil {
+		return fmt.Errorf("failed to record %s in .vanity/sources: %w", username, err)
 	}
 
 	fmt.Printf("Imported %d contributions across %d days from %s\n", totalCount, len(contributions), username)
 	fmt.Println("\nNext steps:")
-	fmt.Println("  1. Commit the changes: git add .vanity && git commit -m 'Import contributions from", username+"'")
+	message := "Import contributions from " + username
+	if naming.Opaque() {
+		// The commit message is shared too, so it must not name the account.
+		message = "Import contributions"
+	}
+	fmt.Printf("  1. Commit the changes: git add .vanity && git commit -m '%s'\n", message)
 	fmt.Println("  2. Run 'vanity sync' to create mirror commits")
 
 	return nil
 }
 
+// maxListedMergeDates caps how many dates each line of a merge summary lists
+const maxListedMergeDates = 5
+
+func printMergeSummary(mode sync.MergeMode, summary sync.MergeSummary) {
+	if !summary.Changed() {
+		fmt.Printf("Merged (%s): no days changed\n", mode)
+		return
+	}
+	fmt.Printf("Merged (%s):\n", mode)
+	for _, group := range []struct {
+		label string
+		dates []string
+	}{
+		{"added", summary.Added},
+		{"rose", summary.Rose},
+		{"fell", summary.Fell},
+		{"disappeared", summary.Disappeared},
+	} {
+		if len(group.dates) == 0 {
+			continue
+		}
+		listed := group.dates
+		more := ""
+		if len(listed) > maxListedMergeDates {
+			more = fmt.Sprintf(" and %d more", len(listed)-maxListedMergeDates)
+			listed = listed[:maxListedMergeDates]
+		}
+		fmt.Printf("  %d day(s) %s: %s%s\n", len(group.dates), group.label, strings.Join(listed, ", "), more)
+	}
+}
+
+// attestImport runs the --attest step for username. It returns nil without
+// an error when the one-time code was only just printed, and refuses to go on
+// without --attest if the repo requires attestation.
+func attestImport(username, attestedBy string) (*sync.Attestation, error) {
+	required, err := sync.AttestationRequired()
+	if err != nil {
+		return nil, err
+	}
+	if attestMethod == "" {
+		if required {
+			return nil, fmt.Errorf("this repo requires imported accounts to be attested; rerun with --attest bio, gist or ssh")
+		}
+		return nil, nil
+	}
+	method, err := sync.ParseAttestMethod(attestMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	code, created, err := sync.AttestationChallenge(username)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		fmt.Printf("To prove %s is yours, publish this one-time code from that account:\n\n  %s\n\n", username, code)
+		switch method {
+		case sync.AttestBio:
+			fmt.Printf("Add it to the bio at https://github.com/settings/profile while signed in as %s.\n", username)
+		case sync.AttestGist:
+			fmt.Printf("Create a public gist containing it while signed in as %s.\n", username)
+		case sync.AttestSSH:
+			fmt.Printf("Sign it with a key listed on %s's profile:\n", username)
+			fmt.Printf("  printf %%s %s | ssh-keygen -Y sign -f ~/.ssh/id_ed25519 -n vanity-attest > code.sig\n", code)
+			fmt.Println("and pass --signature code.sig.")
+		}
+		fmt.Println("\nThen run this command again. Collaborators' clones check the code too, so keep it published until they have synced.")
+		return nil, nil
+	}
+
+	fmt.Printf("Checking %s's attestation via %s...\n", username, method)
+	attestation, err := sync.Attest(username, method, attestSignature, attestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("attestation failed: %w (the code is still %s)", err, code)
+	}
+	fmt.Printf("  %s is attested\n", username)
+	return attestation, nil
+}
+
 func sortedContributions(contributions []github.Contribution) ([]sync.Contribution, int) {
 	var syncContribs []sync.Contribution
 	totalCount := 0
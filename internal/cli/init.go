@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
 )
 
 var initCmd = &cobra.Command{
@@ -43,6 +44,11 @@ func runInit(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Concurrent syncs change the same files; let vanity merge them
+	if err := syncpkg.InstallMergeDriver(); err != nil {
+		return fmt.Errorf("failed to register merge driver: %w", err)
+	}
+
 	fmt.Println("Initialized vanity in", vanityDir)
 	fmt.Println("\nNext steps:")
 	fmt.Println("  1. Invite collaborators to this repository")
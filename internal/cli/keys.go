@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/wdm0006/vanity/internal/github"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Show the signing keys of every account",
+	Long: `Shows each account's registered signing keys and whether this clone trusts
+them.
+
+Your 'vanity sync' signs your contribution file with an ed25519 key kept in
+this clone's .git/vanity/config, registering its public half in
+.vanity/keys/<you>.pub on first use. Before mirroring another account, sync
+checks its file was signed by that account with a registered key, so a
+collaborator with push access can't inflate someone else's counts.
+
+Keys are trusted the first time this clone sees them. If an account's keys
+change later (a new machine, or a collaborator swapping in their own key),
+its files are refused until you confirm the change:
+
+  trust     trust the keys currently registered for an account
+
+Set signing.require to true in .git/vanity/config to also refuse unsigned
+files of accounts without keys.`,
+	Example: `  # Show keys and trust
+  vanity keys
+
+  # Accept alice's new laptop key after checking with her
+  vanity keys trust alice`,
+	Args: cobra.NoArgs,
+	RunE: runKeysShow,
+}
+
+var keysTrustCmd = &cobra.Command{
+	Use:   "trust <account>",
+	Short: "Trust the keys currently registered for an account",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+			return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+		}
+		naming, err := syncpkg.LoadNaming()
+		if err != nil {
+			return err
+		}
+		fingerprints, err := syncpkg.TrustRegisteredKeys(naming.Name(args[0]))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Trusting %s's keys: %s\n", args[0], strings.Join(fingerprints, ", "))
+		return nil
+	},
+}
+
+func init() {
+	keysCmd.AddCommand(keysTrustCmd)
+	rootCmd.AddCommand(keysCmd)
+}
+
+func runKeysShow(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	username, err := github.GetCurrentUser()
+	if err != nil {
+		return fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	naming, err := syncpkg.LoadNaming()
+	if err != nil {
+		return err
+	}
+	users, err := syncpkg.ListSyncedUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list synced users: %w", err)
+	}
+
+	for _, user := range users {
+		name := naming.Display(user)
+		if user == naming.Name(username) {
+			name += " (you)"
+		}
+		fmt.Println(name)
+
+		keys, err := syncpkg.RegisteredKeys(user)
+		if err != nil {
+			return err
+		}
+		trusted, err := syncpkg.TrustedKeys(user)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			fmt.Println("  no registered keys")
+		}
+		for _, key := range keys {
+			fp := syncpkg.KeyFingerprint(key)
+			status := "not yet seen"
+			if len(trusted) > 0 {
+				status = "NOT TRUSTED"
+				for _, t := range trusted {
+					if t == fp {
+						status = "trusted"
+					}
+				}
+			}
+			fmt.Printf("  - %s %s\n", fp, status)
+		}
+
+		data, err := syncpkg.LoadContributionData(user)
+		if err != nil {
+			fmt.Printf("  file unreadable: %v\n", err)
+			continue
+		}
+		if data.Signature == nil {
+			fmt.Println("  file is unsigned")
+		} else {
+			fmt.Printf("  file signed by %s with %s\n", naming.Display(data.Signature.Signer), data.Signature.Key)
+		}
+	}
+	return nil
+}
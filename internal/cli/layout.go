@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var layoutCmd = &cobra.Command{
+	Use:   "layout [single|sharded]",
+	Short: "Show or change how contribution files are stored",
+	Long: `Shows how each account's contributions are stored in .vanity/, or converts
+every account to another layout and commits the change. Converting needs a
+clean working tree and pulls first, so accounts other clones pushed are
+converted too.
+
+  single    one .vanity/<user>.json per account (the default)
+  sharded   .vanity/<user>/account.json plus one <year>.json per year
+
+In the sharded layout a sync only rewrites the current year and
+account.json, so diffs stay small and collaborators rarely touch the same
+file. Past years are frozen with a checksum: they are only rewritten when
+their counts really change, and a hand edit that doesn't match the checksum
+is refused. New accounts follow the layout chosen here.
+
+Older versions of vanity can't read the sharded layout; once it is used,
+they refuse to sync this repo until they are upgraded.`,
+	Example: `  # Show each account's layout
+  vanity layout
+
+  # Split every account into per-year files, then push
+  vanity layout sharded
+  vanity sync`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLayout,
+}
+
+func init() {
+	rootCmd.AddCommand(layoutCmd)
+}
+
+func runLayout(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+
+	if len(args) == 1 {
+		layout, err := syncpkg.ParseStorageLayout(args[0])
+		if err != nil {
+			return err
+		}
+		settings, err := syncpkg.LoadSettings()
+		if err != nil {
+			return err
+		}
+		engine, err := syncpkg.NewEngine(syncpkg.WithRemote(settings.Remote, settings.Branch))
+		if err != nil {
+			return err
+		}
+		converted, err := engine.ConvertLayout(layout)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Converted %d account(s) to the %s layout. Run 'vanity sync' to push the change.\n", converted, layout)
+		return nil
+	}
+
+	layout, err := syncpkg.RepoLayout()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New accounts use the %s layout\n", layout)
+
+	naming, err := syncpkg.LoadNaming()
+	if err != nil {
+		return err
+	}
+	users, err := syncpkg.ListSyncedUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list synced users: %w", err)
+	}
+	for _, user := range users {
+		layout, err := syncpkg.AccountLayout(user)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  - %s: %s\n", naming.Display(user), layout)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var (
+	leaveStripCommits bool
+	leaveKeepAccess   bool
+)
+
+var leaveCmd = &cobra.Command{
+	Use:   "leave",
+	Short: "Take the current account out of the group",
+	Long: `Removes the account gh is logged into from the group: its contribution
+data and sync state are deleted, every account's sync state forgets it, and
+the departure is recorded in .vanity/departures, signed with the account's
+key, committed and pushed. Its registered keys stay, so other clones can
+check the departure is really its own; unsigned or forged departures are
+ignored. The account then removes itself as a collaborator on the
+repository, unless --keep-access is given or it owns the repository.
+
+With --strip-commits, the next 'vanity sync' of every other account
+rewrites the mirror commits from the departed account out of history and
+force-pushes with a lease, so nothing pushed in the meantime is lost; other
+clones reset to the rewritten branch on their next sync. That only happens
+in a repository that tracks nothing but .vanity/. Without it, those commits
+stay.
+
+Running 'vanity sync' as the account again rejoins the group.`,
+	Example: `  # Retire this account and remove its contributions from everyone's graph
+  vanity leave --strip-commits
+
+  # Leave, but stay a collaborator
+  vanity leave --keep-access`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := syncpkg.LoadSettings()
+		if err != nil {
+			return err
+		}
+		engine, err := syncpkg.NewEngine(
+			syncpkg.WithRemote(settings.Remote, settings.Branch),
+			syncpkg.WithSnapshots(settings.KeepSnapshots),
+		)
+		if err != nil {
+			return err
+		}
+		return engine.Leave(leaveStripCommits, leaveKeepAccess)
+	},
+}
+
+func init() {
+	leaveCmd.Flags().BoolVar(&leaveStripCommits, "strip-commits", false, "Have other accounts rewrite this account's mirror commits out of history")
+	leaveCmd.Flags().BoolVar(&leaveKeepAccess, "keep-access", false, "Stay a collaborator on the repository")
+	rootCmd.AddCommand(leaveCmd)
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var mergeDriverPrefer string
+
+var mergeDriverCmd = &cobra.Command{
+	Use:   "merge-driver <base> <ours> <theirs> <path>",
+	Short: "Merge two versions of a .vanity file (run by git)",
+	Long: `A git merge driver for the JSON files in .vanity/. Git runs it when a pull,
+rebase or merge changes the same file on both sides, with the base, ours and
+theirs versions and the file's path in the repo; the result replaces ours.
+
+  contribution files   merged by date: a day changed on one side takes that
+                       side's count, a day changed on both takes the higher
+                       count, or with --prefer newer the count of the side
+                       updated last
+  state files          mirrored counts add up both sides' increases, since
+                       both sides' mirror commits are kept
+
+Encrypted files are decrypted and written back encrypted. A merged file
+that matches neither side is signed again with this clone's key if either
+side was signed by it, and left unsigned otherwise until its owner syncs.
+When the driver fails, git reports the usual conflict.
+
+'vanity init' and 'vanity sync' register the driver in this clone's
+.git/config and .git/info/attributes; it is never committed, so every
+collaborator needs vanity on their PATH. The merge.prefer setting
+('vanity config') picks the default for --prefer.`,
+	Example: `  # What git runs for a conflicting file
+  vanity merge-driver %O %A %B %P
+
+  # Prefer the newer side for every merge in this repo
+  vanity config set merge.prefer newer`,
+	Args: cobra.ExactArgs(4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := syncpkg.LoadSettings()
+		if err != nil {
+			return err
+		}
+		mode := settings.MergePrefer
+		if cmd.Flags().Changed("prefer") {
+			if mode, err = syncpkg.ParseDriverPreference(mergeDriverPrefer); err != nil {
+				return err
+			}
+		}
+		return syncpkg.MergeVanityFile(args[0], args[1], args[2], args[3], mode)
+	},
+}
+
+func init() {
+	mergeDriverCmd.Flags().StringVar(&mergeDriverPrefer, "prefer", string(syncpkg.MergeMax), "Days changed on both sides take the max or newer count")
+	rootCmd.AddCommand(mergeDriverCmd)
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var opaqueSalt string
+
+var opaqueCmd = &cobra.Command{
+	Use:   "opaque",
+	Short: "Store accounts under pseudonyms instead of logins",
+	Long: `Shows whether this repo stores accounts under their logins or under salted
+pseudonyms such as v-3f9a1c02b7de.
+
+In opaque mode, .vanity/ file names, sync state and mirror commit messages
+only ever contain pseudonyms, so someone who later gets access to the repo
+cannot tell which accounts are linked. Pseudonyms are derived from a salt
+that every collaborator keeps in their clone's .git/vanity/config; it is
+never committed, so share it with collaborators privately.
+
+  enable    migrate the repo to pseudonyms, or join a repo that already uses them
+  salt      print the salt to share with collaborators
+  name      teach this clone the login behind a pseudonym, for display
+
+The migration is a normal commit: earlier commits, including old mirror
+commit messages, still name accounts until history is rebuilt with
+'vanity sync --rebuild'.`,
+	Example: `  # Migrate this repo, then push the migration
+  vanity opaque enable
+  vanity sync
+
+  # A collaborator joins after pulling the migration
+  vanity opaque enable --salt 0123456789abcdef0123456789abcdef
+
+  # Show a collaborator's login instead of their pseudonym
+  vanity opaque name bob`,
+	Args: cobra.NoArgs,
+	RunE: runOpaqueShow,
+}
+
+var opaqueEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Switch this repo to pseudonymous names",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+			return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+		}
+		salt, migrated, err := syncpkg.EnableOpaque(opaqueSalt)
+		if err != nil {
+			return err
+		}
+		if opaqueSalt != "" && migrated == 0 {
+			fmt.Println("Opaque mode enabled for this clone.")
+			return nil
+		}
+		fmt.Printf("Migrated %d account(s) to pseudonymous names and committed the change.\n", migrated)
+		fmt.Printf("\nShare this salt privately with every collaborator:\n  %s\n", salt)
+		fmt.Println("\nThey run 'vanity sync' once (it stops and asks for the salt) and then")
+		fmt.Println("'vanity opaque enable --salt <salt>'. Run 'vanity sync' to push the migration,")
+		fmt.Println("and 'vanity sync --rebuild' to also remove logins from earlier commits.")
+		return nil
+	},
+}
+
+var opaqueSaltCmd = &cobra.Command{
+	Use:   "salt",
+	Short: "Print the salt to share with collaborators",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		salt, err := syncpkg.OpaqueSalt()
+		if err != nil {
+			return err
+		}
+		if salt == "" {
+			return fmt.Errorf("this clone is not in opaque mode")
+		}
+		fmt.Println(salt)
+		return nil
+	},
+}
+
+var opaqueNameCmd = &cobra.Command{
+	Use:   "name <login>...",
+	Short: "Record the login behind a pseudonym in this clone",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		naming, err := syncpkg.LoadNaming()
+		if err != nil {
+			return err
+		}
+		if !naming.Opaque() {
+			return fmt.Errorf("this clone is not in opaque mode")
+		}
+		for _, login := range args {
+			if err := naming.Remember(login); err != nil {
+				return err
+			}
+			fmt.Printf("  %s = %s\n", naming.Name(login), login)
+		}
+		return nil
+	},
+}
+
+func init() {
+	opaqueEnableCmd.Flags().StringVar(&opaqueSalt, "salt", "", "Salt of a repo that is already in opaque mode (hex)")
+	opaqueCmd.AddCommand(opaqueEnableCmd, opaqueSaltCmd, opaqueNameCmd)
+	rootCmd.AddCommand(opaqueCmd)
+}
+
+func runOpaqueShow(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	naming, err := syncpkg.LoadNaming()
+	if err != nil {
+		return err
+	}
+	if !naming.Opaque() {
+		fmt.Println("Plain mode: accounts are stored under their logins.")
+		return nil
+	}
+
+	users, err := syncpkg.ListSyncedUsers()
+	if err != nil {
+		return fmt.Errorf("failed to read .vanity directory: %w", err)
+	}
+	fmt.Println("Opaque mode: accounts are stored under pseudonyms.")
+	for _, user := range users {
+		fmt.Printf("  - %s: %s\n", user, naming.Display(user))
+	}
+	return nil
+}
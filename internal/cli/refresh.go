@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"fmt"
+
+	"time"
+
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var refreshMaxAge time.Duration
+
+var refreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Re-import stale imported accounts",
+	Long: `Re-imports every account listed in .vanity/sources whose data is older
+than --max-age, and commits the result.
+
+'vanity import' records each account it imports in .vanity/sources, with its
+method (api or scrape), host and merge mode, so any collaborator can keep it
+current. Accounts are fetched concurrently; one that fails is reported and
+the others are still refreshed. Re-imports merge with the stored data as
+'vanity import --merge' would.
+
+'vanity sync --refresh' does the same before mirroring.`,
+	Example: `  # Refresh accounts not updated for a day
+  vanity refresh
+
+  # Refresh everything, however recent
+  vanity refresh --max-age 0`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := syncpkg.LoadSettings()
+		if err != nil {
+			return fmt.Errorf("failed to read settings: %w", err)
+		}
+		options, err := settings.Options()
+		if err != nil {
+			return err
+		}
+		engine, err := syncpkg.NewEngine(append(options, syncpkg.WithToolVersion(version))...)
+		if err != nil {
+			return err
+		}
+		return engine.Refresh(refreshMaxAge)
+	},
+}
+
+func init() {
+	refreshCmd.Flags().DurationVar(&refreshMaxAge, "max-age", syncpkg.DefaultRefreshAge, "Refresh accounts whose data is older than this")
+	rootCmd.AddCommand(refreshCmd)
+}
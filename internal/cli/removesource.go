@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var removeRewriteHistory bool
+
+var removeSourceCmd = &cobra.Command{
+	Use:   "remove-source <user>",
+	Short: "Stop mirroring an account and forget its data",
+	Long: `Deletes an account's contribution data and its entry in .vanity/sources,
+drops what every account's sync state recorded for it (mirrored counts and
+filters), and commits the change.
+
+The mirror commits already created from the account stay in history unless
+--rewrite-history is given. Then every account's 'mirror from <user>'
+commits are rewritten out of the current branch, keeping all other commits
+and their dates, and the result is force-pushed with a lease, so nothing
+pushed in the meantime is lost. Like 'vanity sync --rebuild', this is
+refused unless the repository only tracks .vanity/. Other clones reset to
+the rewritten branch on their next sync.
+
+An account that still runs 'vanity sync' itself will store its data again
+on its next sync.`,
+	Example: `  # Stop mirroring an old account, keeping its past commits
+  vanity remove-source old-account
+  vanity sync
+
+  # Also remove its mirror commits from everyone's graph
+  vanity remove-source old-account --rewrite-history`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := syncpkg.LoadSettings()
+		if err != nil {
+			return err
+		}
+		engine, err := syncpkg.NewEngine(
+			syncpkg.WithRemote(settings.Remote, settings.Branch),
+			syncpkg.WithSnapshots(settings.KeepSnapshots),
+		)
+		if err != nil {
+			return err
+		}
+		return engine.DropSource(args[0], removeRewriteHistory)
+	},
+}
+
+func init() {
+	removeSourceCmd.Flags().BoolVar(&removeRewriteHistory, "rewrite-history", false, "Also rewrite the account's mirror commits out of history and force push")
+	rootCmd.AddCommand(removeSourceCmd)
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wdm0006/vanity/internal/git"
+	syncpkg "github.com/wdm0006/vanity/internal/sync"
+)
+
+var restoreForce bool
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List the snapshots 'vanity undo' can return to",
+	Long: `Lists the snapshots of the sync branch in this clone, oldest first.
+
+Every sync and rebuild first records where the branch was (after pulling)
+as a local ref under refs/vanity/snapshots/. The .vanity/ files are
+committed, so a snapshot also holds the sync state and contribution data
+matching its history. The newest sync.keepSnapshots snapshots are kept (20
+by default; see 'vanity config').`,
+	Args: cobra.NoArgs,
+	RunE: runSnapshots,
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Return the branch to before the last sync or rebuild",
+	Long: `Restores the latest snapshot that differs from the current branch, like
+'vanity restore' does; run it again to go back one more sync. The commits it
+drops are listed, and --force is needed when any were made by other accounts.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		engine, err := newSnapshotEngine()
+		if err != nil {
+			return err
+		}
+		return engine.Undo(restoreForce)
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <snapshot>",
+	Short: "Reset the branch and sync state to a snapshot",
+	Long: `Resets the current branch, and with it the .vanity/ state and data, to a
+snapshot from 'vanity snapshots', then force-pushes it.
+
+The restore is refused while the remote has commits this clone hasn't
+integrated, and the push only goes ahead while the remote is still where
+this clone saw it, so other accounts' work is never dropped unseen. Every
+commit the restore drops is listed; when any was authored by another account
+(by email), the restore stops unless --force is given. The commit the branch
+was at is printed, so a restore can itself be undone.`,
+	Example: `  # Go back to before the last sync
+  vanity undo
+
+  # Pick a snapshot
+  vanity snapshots
+  vanity restore 20261018T090000Z`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		engine, err := newSnapshotEngine()
+		if err != nil {
+			return err
+		}
+		return engine.Restore(args[0], restoreForce)
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{undoCmd, restoreCmd} {
+		cmd.Flags().BoolVar(&restoreForce, "force", false, "Drop commits made by other accounts too")
+	}
+	rootCmd.AddCommand(snapshotsCmd, undoCmd, restoreCmd)
+}
+
+func newSnapshotEngine() (*syncpkg.Engine, error) {
+	settings, err := syncpkg.LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return syncpkg.NewEngine(
+		syncpkg.WithRemote(settings.Remote, settings.Branch),
+		syncpkg.WithSnapshots(settings.KeepSnapshots),
+	)
+}
+
+func runSnapshots(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(".vanity"); os.IsNotExist(err) {
+		return fmt.Errorf("vanity not initialized (run 'vanity init' first)")
+	}
+	snapshots, err := syncpkg.ListSnapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots yet; every sync and rebuild records one.")
+		return nil
+	}
+
+	head, _ := git.ResolveRef("HEAD")
+	for _, s := range snapshots {
+		marker := ""
+		if s.Hash == head {
+			marker = " (current)"
+		}
+		fmt.Printf("  - %s  %s  %s%s\n", s.Name, s.Hash[:12], s.Time().Local().Format("2006-01-02 15:04"), marker)
+	}
+	return nil
+}
@@ -1,11 +1,10 @@
 package cli
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wdm0006/vanity/internal/github"
@@ -20,8 +19,9 @@ var statusCmd = &cobra.Command{
 Displays:
   - Your GitHub username (via gh CLI)
   - All synced users and their contribution counts
-  - When each user last synced
-  - How many contributions you've mirrored from each user`,
+  - When each user last synced, and where their data came from
+  - How many contributions you've mirrored from each user
+  - How many are still pending, and how many your mirror filters skip`,
 	Example: `  vanity status`,
 	RunE:    runStatus,
 }
@@ -40,34 +40,45 @@ func runStatus(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Current user: %s\n\n", username)
 
-	// List all contribution files
-	entries, err := os.ReadDir(".vanity")
+	users, err := syncpkg.ListSyncedUsers()
 	if err != nil {
 		return fmt.Errorf("failed to read .vanity directory: %w", err)
 	}
 
-	var users []string
-	for _, entry := range entries {
-		if strings.HasSuffix(entry.Name(), ".json") && !strings.HasSuffix(entry.Name(), "-state.json") {
-			users = append(users, strings.TrimSuffix(entry.Name(), ".json"))
-		}
-	}
-
 	if len(users) == 0 {
 		fmt.Println("No synced users yet. Run 'vanity sync' to get started.")
 		return nil
 	}
 
-	fmt.Println("Synced users:")
+	naming, err := syncpkg.LoadNaming()
+	if err != nil {
+		return err
+	}
+	self := naming.Name(username)
+
+	state, err := syncpkg.LoadSyncState(self)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+	settings, err := syncpkg.LoadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to read settings: %w", err)
+	}
+	state.SetFilterDefaults(settings.Filters(), naming)
+
+	now := time.Now()
+	loaded := make(map[string]*syncpkg.ContributionData)
 	for _, user := range users {
-		contribPath := filepath.Join(".vanity", user+".json")
-		data, err := os.ReadFile(contribPath)
-		if err != nil {
-			continue
+		if contribs, err := syncpkg.LoadContributionData(user); err == nil {
+			loaded[user] = contribs
 		}
+	}
+	target := mirrorTargets(settings, state, self, loaded, now)
 
-		var contribs syncpkg.ContributionData
-		if err := json.Unmarshal(data, &contribs); err != nil {
+	fmt.Println("Synced users:")
+	for _, user := range users {
+		contribs, ok := loaded[user]
+		if !ok {
 			continue
 		}
 
@@ -77,33 +88,85 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		}
 
 		marker := ""
-		if user == username {
+		if user == self {
 			marker = " (you)"
 		}
 
-		fmt.Printf("  - %s%s: %d contributions, last updated %s\n",
-			user, marker, totalContribs, contribs.LastUpdated.Format("2006-01-02 15:04"))
+		fmt.Printf("  - %s%s: %d contributions, last updated %s%s\n",
+			naming.Display(user), marker, totalContribs, contribs.LastUpdated.Format("2006-01-02 15:04"),
+			mirrorProgress(state, user, self, contribs, target, now))
+		fmt.Printf("      %s, %s\n", contribs.Provenance.Describe(naming), syncpkg.Age(contribs.LastUpdated, now))
+		if !contribs.Consent.IsEmpty() {
+			fmt.Printf("      consent: %s\n", contribs.Consent.Describe(naming))
+		}
 	}
 
 	// Show state info for current user
-	statePath := filepath.Join(".vanity", username+"-state.json")
-	if data, err := os.ReadFile(statePath); err == nil {
-		var state syncpkg.SyncState
-		if err := json.Unmarshal(data, &state); err == nil {
-			fmt.Printf("\nLast sync: %s\n", state.LastSync.Format("2006-01-02 15:04"))
-
-			if len(state.MirroredCounts) > 0 {
-				fmt.Println("Mirrored from:")
-				for user, dateCounts := range state.MirroredCounts {
-					totalCommits := 0
-					for _, count := range dateCounts {
-						totalCommits += count
-					}
-					fmt.Printf("  - %s: %d dates, %d commits\n", user, len(dateCounts), totalCommits)
+	if !state.LastSync.IsZero() {
+		fmt.Printf("\nLast sync: %s\n", state.LastSync.Format("2006-01-02 15:04"))
+
+		if len(state.MirroredCounts) > 0 {
+			fmt.Println("Mirrored from:")
+			for user, dateCounts := range state.MirroredCounts {
+				totalCommits := 0
+				for _, count := range dateCounts {
+					totalCommits += count
 				}
+				fmt.Printf("  - %s: %d dates, %d commits\n", naming.Display(user), len(dateCounts), totalCommits)
 			}
 		}
 	}
 
+	if filters := state.EffectiveFilters(); !filters.IsEmpty() {
+		fmt.Println("\nMirror filters:")
+		printFilters(filters, naming)
+	}
+
 	return nil
 }
+
+// mirrorTargets works out what a sync under the configured aggregation mode
+// mirrors from each of the loaded accounts, leaving out those it wouldn't
+// mirror at all
+func mirrorTargets(settings syncpkg.Settings, state *syncpkg.SyncState, self string, loaded map[string]*syncpkg.ContributionData, now time.Time) func(string, syncpkg.Contribution) int {
+	own := loaded[self]
+	if own == nil {
+		own = &syncpkg.ContributionData{}
+	}
+	sources := make(map[string]*syncpkg.ContributionData)
+	for user, data := range loaded {
+		if user == self || state.EffectiveFilters().SkipsSource(user) || data.Consent.Refuses(self, now) != "" {
+			continue
+		}
+		sources[user] = data
+	}
+	return syncpkg.MirrorTargets(settings.Aggregation, settings.Scales, own, sources, state, now)
+}
+
+// mirrorProgress summarizes what is still to be mirrored from a source,
+// keeping what the filters skip on purpose apart from what is pending.
+// target is how many commits a sync mirrors in total for a source day.
+func mirrorProgress(state *syncpkg.SyncState, source, self string, data *syncpkg.ContributionData, target func(string, syncpkg.Contribution) int, now time.Time) string {
+	if source == self {
+		return ""
+	}
+	if state.EffectiveFilters().SkipsSource(source) {
+		return " (skipped by filter)"
+	}
+	if reason := data.Consent.Refuses(self, now); reason != "" {
+		return " (not mirrored: " + reason + ")"
+	}
+
+	pending, skipped := state.PendingMirrors(source, data, target, now)
+	var parts []string
+	if pending > 0 {
+		parts = append(parts, fmt.Sprintf("%d pending", pending))
+	}
+	if skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped by filter", skipped))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(parts, ", ")
+}
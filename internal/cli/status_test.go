@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/sync"
+)
+
+func TestMirrorProgressFollowsAggregationMode(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	loaded := map[string]*sync.ContributionData{
+		"alice": {Username: "alice", Contributions: []sync.Contribution{{Date: "2024-01-01", Count: 1}}},
+		"bob":   {Username: "bob", Contributions: []sync.Contribution{{Date: "2024-01-01", Count: 5}, {Date: "2024-01-02", Count: 3}}},
+		"carol": {Username: "carol", Contributions: []sync.Contribution{{Date: "2024-01-01", Count: 3}}},
+	}
+
+	tests := []struct {
+		mode       sync.AggregationMode
+		bob, carol string
+	}{
+		{sync.AggregateSum, ", 8 pending", ", 3 pending"},
+		{sync.AggregatePresence, ", 2 pending", ", 1 pending"},
+		// The busiest account lifts each day to its count; the others add nothing
+		{sync.AggregateMax, ", 7 pending", ""},
+	}
+	for _, tt := range tests {
+		state := &sync.SyncState{Username: "alice"}
+		target := mirrorTargets(sync.Settings{Aggregation: tt.mode}, state, "alice", loaded, now)
+		if got := mirrorProgress(state, "bob", "alice", loaded["bob"], target, now); got != tt.bob {
+			t.Errorf("%s: bob progress = %q, want %q", tt.mode, got, tt.bob)
+		}
+		if got := mirrorProgress(state, "carol", "alice", loaded["carol"], target, now); got != tt.carol {
+			t.Errorf("%s: carol progress = %q, want %q", tt.mode, got, tt.carol)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/wdm0006/vanity/internal/sync"
@@ -11,6 +12,24 @@ var (
 	dryRun    bool
 	batchSize int
 	rebuild   bool
+	integrate string
+
+	timestampStrategy string
+	timezone          string
+	timestampSeed     int64
+
+	aggregate string
+	scales    map[string]string
+
+	exportPolicy string
+
+	maxDayCommits int
+	maxRunCommits int
+
+	refreshSources bool
+
+	syncRemote string
+	syncBranch string
 )
 
 var syncCmd = &cobra.Command{
@@ -20,7 +39,7 @@ var syncCmd = &cobra.Command{
 imports other collaborators' contributions, and creates mirror commits.
 
 The sync process:
-  1. Pulls latest changes from the remote
+  1. Pulls latest changes from the remote, keeping mirror commit dates intact
   2. Fetches your contribution data via GitHub API (using gh CLI)
   3. Saves your contributions to .vanity/<username>.json
   4. Reads other collaborators' contribution files
@@ -29,13 +48,62 @@ The sync process:
 
 Syncs are incremental - only new contributions since your last sync are
 processed. If a collaborator's contribution count for a day increases,
-only the delta commits are created.`,
+only the delta commits are created.
+
+Remote changes are integrated by rebasing with each commit's committer date
+kept equal to its author date (--integrate rebase), or by merging
+(--integrate merge). A plain 'git pull --rebase' would re-date unpushed
+mirror commits to today, so sync refuses a history where that has happened.
+
+Mirror commits are placed within their day by --timestamps: spread (across
+the whole day, never sharing a timestamp), working-hours (09:00-17:00) or
+jitter (seeded random times, see --timestamp-seed). Days are calendar days in
+--timezone, which defaults to the local timezone.
+
+--aggregate decides how other accounts' contributions combine with yours:
+  sum       add every source's count (default)
+  max       raise each day to the busiest single account's count, so work
+            that appears on several accounts is not counted twice
+  presence  add at most one contribution per active source day
+  scaled    multiply each source's count by its --scale (default 1)
+Switching modes never removes mirror commits that already exist.
+
+--export-policy coarsens your own counts before they are exported, so
+collaborators see less exact activity. Steps are comma-separated and apply
+in this order:
+  weekly    spread each week's total evenly over its days
+  noise=N   add up to ±N per active day (seeded per clone, stable across syncs)
+  bucket=N  report only the bottom of each range of N (active days stay >= 1)
+  cap=N     never report more than N per day
+The policy is recorded in your contribution file and kept by later syncs;
+'--export-policy none' removes it. Changing it re-exports your whole calendar.
+
+Contribution files are validated before anything is mirrored from them, and
+two limits guard against a corrupted or inflated file: a source asking for
+more than --max-day-commits on any one day is refused, and a run stops after
+--max-run-commits mirror commits, leaving the rest for the next sync.
+
+--refresh first re-imports the accounts in .vanity/sources that haven't
+been updated for a day, like 'vanity refresh'.
+
+Every option except --dry-run, --rebuild, --scale, --export-policy and
+--refresh can also be set in config with 'vanity config set', for the whole
+group in .vanity/config or just for you. Flags override config.`,
 	Example: `  # Full sync
   vanity sync
 
   # Preview what would happen
   vanity sync --dry-run
 
+  # Place mirror commits within working hours in a fixed timezone
+  vanity sync --timestamps working-hours --timezone Europe/Berlin
+
+  # Count shared work once, and an old account at half weight
+  vanity sync --aggregate scaled --scale old-work=0.5
+
+  # Export only rough weekly activity, capped at 10 a day
+  vanity sync --export-policy weekly,bucket=5,cap=10
+
   # Rebuild all mirror commits from scratch (fixes missing contributions)
   vanity sync --rebuild --batch-size 100`,
 	RunE: runSync,
@@ -45,13 +113,49 @@ func init() {
 	syncCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be done without making changes")
 	syncCmd.Flags().IntVar(&batchSize, "batch-size", 100, "Push every N mirror commits (avoids GitHub dropping backdated commits)")
 	syncCmd.Flags().BoolVar(&rebuild, "rebuild", false, "Wipe commit history and rebuild all mirror commits from scratch")
+	syncCmd.Flags().StringVar(&integrate, "integrate", string(sync.IntegrateRebase), "How to integrate remote changes: rebase (dates preserved) or merge")
+	syncCmd.Flags().StringVar(&timestampStrategy, "timestamps", string(sync.TimestampsSpread), "How to place mirror commits within a day: spread, working-hours or jitter")
+	syncCmd.Flags().StringVar(&timezone, "timezone", "", "IANA timezone whose calendar days mirror commits land in (default local)")
+	syncCmd.Flags().Int64Var(&timestampSeed, "timestamp-seed", 0, "Seed for the jitter timestamp strategy")
+	syncCmd.Flags().StringVar(&aggregate, "aggregate", string(sync.AggregateSum), "How sources combine with your count: sum, max, presence or scaled")
+	syncCmd.Flags().StringToStringVar(&scales, "scale", nil, "Per-source multiplier for --aggregate scaled (e.g. old-work=0.5)")
+	syncCmd.Flags().StringVar(&exportPolicy, "export-policy", "", "Transform your counts before export (e.g. weekly,noise=2,bucket=5,cap=20, or none)")
+	syncCmd.Flags().IntVar(&maxDayCommits, "max-day-commits", sync.DefaultMaxDayCommits, "Refuse a source asking for more mirror commits than this on one day (0 for no limit)")
+	syncCmd.Flags().BoolVar(&refreshSources, "refresh", false, "Re-import stale accounts listed in .vanity/sources before mirroring")
+	syncCmd.Flags().StringVar(&syncRemote, "remote", "", "Remote to pull from and push to (default the current branch's upstream)")
+	syncCmd.Flags().StringVar(&syncBranch, "branch", "", "Branch on --remote to push to (default the current branch's name)")
+	syncCmd.Flags().IntVar(&maxRunCommits, "max-run-commits", sync.DefaultMaxRunCommits, "Stop after this many mirror commits; the next sync continues (0 for no limit)")
 }
 
 func runSync(cmd *cobra.Command, args []string) error {
-	engine, err := sync.NewEngine(
-		sync.WithBatchSize(batchSize),
+	settings, err := sync.LoadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := applySyncFlags(cmd, &settings); err != nil {
+		return err
+	}
+
+	options, err := settings.Options()
+	if err != nil {
+		return err
+	}
+	options = append(options,
 		sync.WithRebuild(rebuild),
+		sync.WithToolVersion(version),
 	)
+	if refreshSources {
+		options = append(options, sync.WithRefresh(sync.DefaultRefreshAge))
+	}
+	if cmd.Flags().Changed("export-policy") {
+		policy, err := sync.ParseExportPolicy(exportPolicy)
+		if err != nil {
+			return err
+		}
+		options = append(options, sync.WithExportPolicy(policy))
+	}
+
+	engine, err := sync.NewEngine(options...)
 	if err != nil {
 		return err
 	}
@@ -65,3 +169,66 @@ func runSync(cmd *cobra.Command, args []string) error {
 
 	return engine.Sync(dryRun)
 }
+
+// applySyncFlags overrides the settings read from config with the flags given
+// on the command line. Flags left at their defaults don't override anything.
+func applySyncFlags(cmd *cobra.Command, settings *sync.Settings) error {
+	flags := cmd.Flags()
+	var err error
+	if flags.Changed("batch-size") {
+		settings.BatchSize = batchSize
+	}
+	if flags.Changed("integrate") {
+		if settings.Integration, err = sync.ParseIntegrationStrategy(integrate); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("timestamps") {
+		if settings.Timestamps, err = sync.ParseTimestampStrategy(timestampStrategy); err != nil {
+			return err
+		}
+	}
+	if flags.Changed("timezone") {
+		settings.Timezone = timezone
+	}
+	if flags.Changed("timestamp-seed") {
+		settings.TimestampSeed = timestampSeed
+	}
+	if flags.Changed("aggregate") {
+		if settings.Aggregation, err = sync.ParseAggregationMode(aggregate); err != nil {
+			return err
+		}
+	}
+	if settings.Scales, err = parseScales(scales); err != nil {
+		return err
+	}
+	if flags.Changed("max-day-commits") {
+		settings.MaxDayCommits = maxDayCommits
+	}
+	if flags.Changed("max-run-commits") {
+		settings.MaxRunCommits = maxRunCommits
+	}
+	if maxDayCommits < 0 || maxRunCommits < 0 {
+		return fmt.Errorf("--max-day-commits and --max-run-commits must not be negative")
+	}
+	if flags.Changed("remote") {
+		settings.Remote = syncRemote
+	}
+	if flags.Changed("branch") {
+		settings.Branch = syncBranch
+	}
+	return nil
+}
+
+// parseScales converts --scale source=multiplier pairs into numbers
+func parseScales(raw map[string]string) (map[string]float64, error) {
+	parsed := make(map[string]float64, len(raw))
+	for source, value := range raw {
+		scale, err := strconv.ParseFloat(value, 64)
+		if err != nil || scale < 0 {
+			return nil, fmt.Errorf("invalid scale %q for %s (want a non-negative number)", value, source)
+		}
+		parsed[source] = scale
+	}
+	return parsed, nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wdm0006/vanity/internal/sync"
+)
+
+var (
+	heal            bool
+	verifyBatchSize int
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that synced contributions show up on your graph",
+	Long: `Refetches your contribution calendar and compares each day with what was
+synced: your own contribution file and the mirror commits created onto it.
+
+GitHub's indexer can drop backdated commits, especially when many are pushed
+at once. Days that fell short are listed; with --heal, the mirror commits
+that are certainly missing are recreated and pushed in batches. The healed
+commits are recorded in your sync state and committed, so later syncs and
+verifies count them and the same day is not healed twice. Healing follows
+the same settings as 'vanity sync': timezone, timestamps, remote, branch and
+integration; --batch-size overrides sync.batchSize.
+
+The calendar covers the last year, so older days are not checked.`,
+	Example: `  # List days that fell short
+  vanity verify
+
+  # Recreate the missing mirror commits
+  vanity verify --heal --batch-size 50`,
+	RunE: runVerify,
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&heal, "heal", false, "Recreate and push the mirror commits missing from the graph")
+	verifyCmd.Flags().IntVar(&verifyBatchSize, "batch-size", 100, "Push every N recreated commits")
+	rootCmd.AddCommand(verifyCmd)
+}
+
+func runVerify(cmd *cobra.Command, args []string) error {
+	settings, err := sync.LoadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to read settings: %w", err)
+	}
+	options, err := settings.Options()
+	if err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("batch-size") {
+		options = append(options, sync.WithBatchSize(verifyBatchSize))
+	}
+	options = append(options, sync.WithToolVersion(version))
+
+	engine, err := sync.NewEngine(options...)
+	if err != nil {
+		return err
+	}
+	return engine.Verify(heal)
+}
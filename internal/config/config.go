@@ -0,0 +1,77 @@
+// Package config reads and writes vanity settings that belong to one clone and
+// must never reach the shared repository. Settings use git's config file
+// format, so they can also be inspected with `git config --file`.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// LocalPath returns this clone's private settings file. It lives in .git/, so
+// it is never committed or pushed.
+func LocalPath() (string, error) {
+	gitDir, err := git.GitDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate .git directory: %w", err)
+	}
+	return filepath.Join(gitDir, "vanity", "config"), nil
+}
+
+// Get returns a local setting, or an empty string when it is not set
+func Get(key string) (string, error) {
+	path, err := LocalPath()
+	if err != nil {
+		return "", err
+	}
+	return git.ConfigFileGet(path, key)
+}
+
+// Set stores a local setting
+func Set(key, value string) error {
+	path, err := LocalPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return git.ConfigFileSet(path, key, value)
+}
+
+// GetAll returns every value of a multi-valued local setting
+func GetAll(key string) ([]string, error) {
+	path, err := LocalPath()
+	if err != nil {
+		return nil, err
+	}
+	return git.ConfigFileGetAll(path, key)
+}
+
+// Add appends a value to a multi-valued local setting
+func Add(key, value string) error {
+	path, err := LocalPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return git.ConfigFileAdd(path, key, value)
+}
+
+// Unset removes a local setting, or only its entries equal to value when value
+// is not empty
+func Unset(key, value string) error {
+	path, err := LocalPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return git.ConfigFileUnset(path, key, value)
+}
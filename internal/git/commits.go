@@ -1,10 +1,14 @@
 package git
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // IsGitRepo checks if the current directory is a git repository
@@ -13,22 +17,203 @@ func IsGitRepo() bool {
 	return err == nil
 }
 
-// Pull pulls the latest changes from the remote
-func Pull() error {
-	cmd := exec.Command("git", "pull", "--rebase")
+// GitDir returns the path of the repository's .git directory, where local-only
+// files that must never be committed can live
+func GitDir() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-dir")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Fetch downloads the latest changes from the remote without integrating them
+func Fetch() error {
+	cmd := exec.Command("git", "fetch")
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-// Push pushes changes to the remote
-func Push() error {
-	cmd := exec.Command("git", "push")
+// FetchFrom downloads the latest changes from a named remote
+func FetchFrom(remote string) error {
+	if err := CheckRemote(remote); err != nil {
+		return err
+	}
+	cmd := exec.Command("git", "fetch", "--", remote)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+// RefExists reports whether ref names an existing object
+func RefExists(ref string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", ref)
+	return cmd.Run() == nil
+}
+
+// PathExistsAt reports whether path exists in the tree of rev
+func PathExistsAt(rev, path string) bool {
+	cmd := exec.Command("git", "cat-file", "-e", rev+":"+path)
+	return cmd.Run() == nil
+}
+
+// Upstream returns the upstream the current branch tracks (e.g. "origin/main"),
+// or an empty string when none is configured
+func Upstream() string {
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// RebasePreservingDates replays local commits onto upstream. Unlike a plain
+// `git pull --rebase`, it keeps each replayed commit's committer date equal to
+// its author date, so backdated mirror commits stay on their original day. A
+// rebase that stops on a conflict is aborted rather than left half-applied.
+func RebasePreservingDates(upstream string) error {
+	cmd := exec.Command("git", "rebase", "--committer-date-is-author-date", upstream)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		abortInProgress("rebase")
+		return err
+	}
+	return nil
+}
+
+// Merge merges upstream into the current branch, leaving every existing commit
+// untouched. A merge that stops on a conflict is aborted.
+func Merge(upstream string) error {
+	cmd := exec.Command("git", "merge", "--no-edit", upstream)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		abortInProgress("merge")
+		return err
+	}
+	return nil
+}
+
+// abortInProgress backs out of an interrupted rebase or merge. It is best
+// effort: when nothing is in progress the abort fails harmlessly.
+func abortInProgress(operation string) {
+	cmd := exec.Command("git", operation, "--abort")
+	_ = cmd.Run()
+}
+
+// Push pushes changes to the remote
+func Push() error {
+	return runPush("push")
+}
+
+// ErrPushRejected reports a push the remote refused because it does not
+// fast-forward, or because a lease no longer holds: someone else pushed first
+var ErrPushRejected = errors.New("push rejected")
+
+// runPush runs git with args, streaming its output, and wraps ErrPushRejected
+// when the remote refused the update rather than the push failing outright
+func runPush(args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	output := stderr.String()
+	for _, marker := range []string{"non-fast-forward", "(fetch first)", "(stale info)"} {
+		if strings.Contains(output, marker) {
+			return fmt.Errorf("%w: %v", ErrPushRejected, err)
+		}
+	}
+	return err
+}
+
+// PushTo pushes the current branch to branch on remote, setting upstream
+// tracking
+func PushTo(remote, branch string) error {
+	if err := checkPushTarget(remote, branch); err != nil {
+		return err
+	}
+	return runPush("push", "-u", "--", remote, "HEAD:refs/heads/"+branch)
+}
+
+// PushWithLease force-pushes the current branch to branch on remote, setting
+// upstream tracking, but only while the remote branch is still at expected,
+// so commits pushed by someone else in the meantime are never overwritten. An
+// empty expected requires that the remote branch doesn't exist yet.
+func PushWithLease(remote, branch, expected string) error {
+	if err := checkPushTarget(remote, branch); err != nil {
+		return err
+	}
+	return runPush("push", "-u", "--force-with-lease=refs/heads/"+branch+":"+expected, "--", remote, "HEAD:refs/heads/"+branch)
+}
+
+// MergeFile merges the changes from base to theirs into ours, line by line as
+// git merges a text file, and returns the result. Conflicting changes are an
+// error.
+func MergeFile(ours, base, theirs string) ([]byte, error) {
+	cmd := exec.Command("git", "merge-file", "-p", ours, base, theirs)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+			return nil, fmt.Errorf("%d conflicting change(s)", exitErr.ExitCode())
+		}
+		return nil, fmt.Errorf("git merge-file failed: %w", err)
+	}
+	return output, nil
+}
+
+// IsAncestor reports whether ancestor is reachable from rev
+func IsAncestor(ancestor, rev string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ancestor, rev)
+	return cmd.Run() == nil
+}
+
+// CheckRemote returns an error unless remote names a remote configured in the
+// repository. Remote names can come from shared settings, so anything else,
+// such as a value starting with "-", is never handed to git.
+func CheckRemote(remote string) error {
+	if remote == "" || strings.HasPrefix(remote, "-") {
+		return fmt.Errorf("invalid remote name %q", remote)
+	}
+	output, err := exec.Command("git", "remote").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list remotes: %w", err)
+	}
+	for _, name := range strings.Fields(string(output)) {
+		if name == remote {
+			return nil
+		}
+	}
+	return fmt.Errorf("no remote named %q (see 'git remote')", remote)
+}
+
+// CheckBranchName returns an error unless branch is a valid branch name that
+// can't be mistaken for an option
+func CheckBranchName(branch string) error {
+	if branch == "" || strings.HasPrefix(branch, "-") {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	if err := exec.Command("git", "check-ref-format", "refs/heads/"+branch).Run(); err != nil {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	return nil
+}
+
+// checkPushTarget validates the remote and branch a push goes to
+func checkPushTarget(remote, branch string) error {
+	if err := CheckRemote(remote); err != nil {
+		return err
+	}
+	return CheckBranchName(branch)
+}
+
 // HasRemote checks if the repository has a remote configured
 func HasRemote() bool {
 	cmd := exec.Command("git", "remote")
@@ -54,40 +239,256 @@ func Commit(message string) error {
 	return cmd.Run()
 }
 
-// CreateBackdatedCommit creates an empty commit with a specific date
-// The date should be in ISO 8601 format (e.g., "2024-01-15T12:00:00")
-func CreateBackdatedCommit(date string, message string) error {
+// MirrorMessagePrefix starts the message of every mirror commit, followed by
+// the source account and the commit's position in its day
+const MirrorMessagePrefix = "vanity: mirror from "
+
+// LogEntry describes a commit in the repository's history
+type LogEntry struct {
+	Hash          string
+	Subject       string
+	AuthorEmail   string
+	AuthorDate    time.Time
+	CommitterDate time.Time
+}
+
+// LogCommits lists the commits reachable from revs, newest first. Revisions
+// that do not exist (such as an unborn HEAD) are ignored.
+func LogCommits(revs ...string) ([]LogEntry, error) {
+	args := append([]string{"log", "--ignore-missing", "--format=%H%x00%s%x00%ae%x00%aI%x00%cI"}, revs...)
+	cmd := exec.Command("git", args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []LogEntry
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+		authorDate, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse author date of %s: %w", fields[0], err)
+		}
+		committerDate, err := time.Parse(time.RFC3339, fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse committer date of %s: %w", fields[0], err)
+		}
+		commits = append(commits, LogEntry{
+			Hash:          fields[0],
+			Subject:       fields[1],
+			AuthorEmail:   fields[2],
+			AuthorDate:    authorDate,
+			CommitterDate: committerDate,
+		})
+	}
+	return commits, nil
+}
+
+// Identity is a commit author or committer. A zero Identity leaves the choice
+// to git's own configuration.
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// ConfiguredIdentity returns the user.name and user.email git resolves in the
+// current repository; either may be empty when unset
+func ConfiguredIdentity() Identity {
+	return Identity{
+		Name:  configValue("user.name"),
+		Email: configValue("user.email"),
+	}
+}
+
+// ConfigFileGet reads key from a git-format config file. A key that is not set,
+// or a file that does not exist, yields an empty string and no error.
+func ConfigFileGet(path, key string) (string, error) {
+	cmd := exec.Command("git", "config", "--file", path, "--get", key)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", configError(path, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ConfigFileSet writes key to a git-format config file, creating the file if needed
+func ConfigFileSet(path, key, value string) error {
+	cmd := exec.Command("git", "config", "--file", path, key, value)
+	if _, err := cmd.Output(); err != nil {
+		return configError(path, err)
+	}
+	return nil
+}
+
+// ConfigFileGetAll reads every value of a multi-valued key from a git-format
+// config file. A missing key or file yields no values and no error.
+func ConfigFileGetAll(path, key string) ([]string, error) {
+	cmd := exec.Command("git", "config", "--file", path, "--get-all", key)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, configError(path, err)
+	}
+	var values []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			values = append(values, line)
+		}
+	}
+	return values, nil
+}
+
+// ConfigFileAdd appends a value to a multi-valued key
+func ConfigFileAdd(path, key, value string) error {
+	cmd := exec.Command("git", "config", "--file", path, "--add", key, value)
+	if _, err := cmd.Output(); err != nil {
+		return configError(path, err)
+	}
+	return nil
+}
+
+// ConfigFileUnset removes key, or only its entries equal to value when value
+// is not empty. Removing something that is not set is not an error.
+func ConfigFileUnset(path, key, value string) error {
+	args := []string{"config", "--file", path, "--unset-all", key}
+	if value != "" {
+		args = []string{"config", "--file", path, "--fixed-value", "--unset-all", key, value}
+	}
+	cmd := exec.Command("git", args...)
+	if _, err := cmd.Output(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 5 {
+			return nil
+		}
+		return configError(path, err)
+	}
+	return nil
+}
+
+// ConfigEntry is one key and value of a config file, with the section and
+// variable name lowercased as git reports them
+type ConfigEntry struct {
+	Key   string
+	Value string
+}
+
+// ConfigFileList returns every entry of a git-format config file in file
+// order. A missing file has no entries.
+func ConfigFileList(path string) ([]ConfigEntry, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	cmd := exec.Command("git", "config", "--file", path, "--list", "-z")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, configError(path, err)
+	}
+	var entries []ConfigEntry
+	for _, item := range strings.Split(string(output), "\x00") {
+		if item == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(item, "\n")
+		entries = append(entries, ConfigEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// ConfigFileRemoveSection removes a section (such as source.alice) and all
+// its keys. Removing a section that does not exist is not an error.
+func ConfigFileRemoveSection(path, section string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	cmd := exec.Command("git", "config", "--file", path, "--remove-section", section)
+	if _, err := cmd.Output(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && strings.Contains(string(exitErr.Stderr), "no such section") {
+			return nil
+		}
+		return configError(path, err)
+	}
+	return nil
+}
+
+func configError(path string, err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("git config %s: %s", path, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+func configValue(key string) string {
+	cmd := exec.Command("git", "config", "--get", key)
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// CreateBackdatedCommit creates an empty commit with a specific date, authored
+// and committed by author when it is set
+// The date should be in ISO 8601 format (e.g., "2024-01-15T12:00:00-05:00")
+func CreateBackdatedCommit(date string, message string, author Identity) error {
 	cmd := exec.Command("git", "commit", "--allow-empty", "-m", message)
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("GIT_AUTHOR_DATE=%s", date),
 		fmt.Sprintf("GIT_COMMITTER_DATE=%s", date),
 	)
+	if author.Email != "" {
+		cmd.Env = append(cmd.Env,
+			fmt.Sprintf("GIT_AUTHOR_NAME=%s", author.Name),
+			fmt.Sprintf("GIT_AUTHOR_EMAIL=%s", author.Email),
+			fmt.Sprintf("GIT_COMMITTER_NAME=%s", author.Name),
+			fmt.Sprintf("GIT_COMMITTER_EMAIL=%s", author.Email),
+		)
+	}
 	return cmd.Run()
 }
 
-// CreateBackdatedCommits creates multiple empty commits for a given date
-// count specifies how many commits to create. It returns how many commits were
-// actually created, so callers can record partial progress when one fails.
-func CreateBackdatedCommits(date string, count int, sourceUser string) (int, error) {
-	for i := 0; i < count; i++ {
-		// Spread commits throughout the day to make them look more natural
-		hour := (i * 2) % 24
-		timestamp := fmt.Sprintf("%sT%02d:00:00", date, hour)
-		message := fmt.Sprintf("vanity: mirror from %s (%d/%d)", sourceUser, i+1, count)
+// CreateBackdatedCommits creates one empty mirror commit from sourceUser at each
+// of the given timestamps, attributed to author. It returns how many commits
+// were actually created, so callers can record partial progress when one fails.
+func CreateBackdatedCommits(timestamps []time.Time, sourceUser string, author Identity) (int, error) {
+	count := len(timestamps)
+	for i, ts := range timestamps {
+		message := fmt.Sprintf("%s%s (%d/%d)", MirrorMessagePrefix, sourceUser, i+1, count)
 
-		if err := CreateBackdatedCommit(timestamp, message); err != nil {
+		if err := CreateBackdatedCommit(ts.Format(time.RFC3339), message, author); err != nil {
 			return i, fmt.Errorf("failed to create commit %d/%d: %w", i+1, count, err)
 		}
 	}
 	return count, nil
 }
 
-// ForcePush force-pushes the current branch to the remote, setting upstream tracking
-func ForcePush() error {
-	cmd := exec.Command("git", "push", "--force", "-u", "origin", "HEAD")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+// dropCommitsFilter is a filter-branch commit filter that skips commits whose
+// message starts with $VANITY_DROP_PREFIX and recreates every other one
+const dropCommitsFilter = `msg=$(cat)
+case "$msg" in
+"$VANITY_DROP_PREFIX"*) skip_commit "$@" ;;
+*) printf '%s\n' "$msg" | git commit-tree "$@" ;;
+esac`
+
+// DropCommits rewrites branch without the commits whose subject starts with
+// prefix. The commits kept keep their author and committer dates, and the
+// dropped ones' children are reattached to their parents, so only empty
+// commits should be dropped.
+func DropCommits(branch, prefix string) error {
+	cmd := exec.Command("git", "filter-branch", "-f", "--commit-filter", dropCommitsFilter, "--", "refs/heads/"+branch)
+	cmd.Env = append(os.Environ(), "VANITY_DROP_PREFIX="+prefix, "FILTER_BRANCH_SQUELCH_WARNING=1")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	// filter-branch keeps the old history under refs/original; it is not needed
+	// once the rewrite succeeded.
+	return DeleteRef("refs/original/refs/heads/" + branch)
 }
 
 // CheckoutOrphan creates a new orphan branch (no history)
@@ -132,6 +533,61 @@ func GetCurrentBranch() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
+// ResolveRef returns the commit hash rev points at
+func ResolveRef(rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s is not a commit", rev)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// UpdateRef points ref at hash, creating it if needed
+func UpdateRef(ref, hash string) error {
+	cmd := exec.Command("git", "update-ref", ref, hash)
+	return cmd.Run()
+}
+
+// DeleteRef deletes ref
+func DeleteRef(ref string) error {
+	cmd := exec.Command("git", "update-ref", "-d", ref)
+	return cmd.Run()
+}
+
+// Ref is a reference and the commit it points at
+type Ref struct {
+	Name string
+	Hash string
+}
+
+// ListRefs returns the references under prefix (such as "refs/tags/"),
+// sorted by name
+func ListRefs(prefix string) ([]Ref, error) {
+	cmd := exec.Command("git", "for-each-ref", "--sort=refname", "--format=%(refname)%00%(objectname)", prefix)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var refs []Ref
+	for _, line := range strings.Split(string(output), "\n") {
+		name, hash, ok := strings.Cut(line, "\x00")
+		if ok {
+			refs = append(refs, Ref{Name: name, Hash: hash})
+		}
+	}
+	return refs, nil
+}
+
+// ResetHard moves the current branch to rev and makes the index and working
+// tree match it
+func ResetHard(rev string) error {
+	cmd := exec.Command("git", "reset", "--hard", "--quiet", rev)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
 // HasUncommittedChanges checks if there are uncommitted changes
 func HasUncommittedChanges() bool {
 	cmd := exec.Command("git", "status", "--porcelain")
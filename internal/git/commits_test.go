@@ -45,6 +45,30 @@ func TestListTrackedFilesIsEmptyForAnEmptyIndex(t *testing.T) {
 	})
 }
 
+func TestPushTargetsAreValidated(t *testing.T) {
+	repo := initTestRepo(t)
+	runGit(t, repo, "remote", "add", "origin", t.TempDir())
+
+	withWorkingDirectory(t, repo, func() {
+		if err := CheckRemote("origin"); err != nil {
+			t.Errorf("CheckRemote(origin) error = %v", err)
+		}
+		for _, remote := range []string{"--upload-pack=touch pwned", "upstream", ""} {
+			if err := FetchFrom(remote); err == nil {
+				t.Errorf("FetchFrom(%q) accepted a remote that isn't configured", remote)
+			}
+		}
+		for _, branch := range []string{"--delete", "a..b", "main:evil", ""} {
+			if err := PushTo("origin", branch); err == nil || !strings.Contains(err.Error(), "invalid branch name") {
+				t.Errorf("PushTo(origin, %q) error = %v, want it refused", branch, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(repo, "pwned")); err == nil {
+			t.Error("a remote name was run as a command")
+		}
+	})
+}
+
 func initTestRepo(t *testing.T) string {
 	t.Helper()
 	repo := t.TempDir()
@@ -92,3 +116,72 @@ func withWorkingDirectory(t *testing.T, dir string, fn func()) {
 	}()
 	fn()
 }
+
+func TestConfigFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vanity", "config")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := ConfigFileGet(path, "export.noiseSeed"); err != nil || value != "" {
+		t.Fatalf("ConfigFileGet() on a missing file = %q, %v; want empty and no error", value, err)
+	}
+	if err := ConfigFileSet(path, "export.noiseSeed", "42"); err != nil {
+		t.Fatalf("ConfigFileSet() error = %v", err)
+	}
+	if value, err := ConfigFileGet(path, "export.noiseSeed"); err != nil || value != "42" {
+		t.Fatalf("ConfigFileGet() = %q, %v; want %q", value, err, "42")
+	}
+}
+
+func TestConfigFileMultiValued(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	for _, value := range []string{"acme/*", "me/dotfiles"} {
+		if err := ConfigFileAdd(path, "export.excludeRepo", value); err != nil {
+			t.Fatalf("ConfigFileAdd(%q) error = %v", value, err)
+		}
+	}
+	if err := ConfigFileUnset(path, "export.excludeRepo", "acme/*"); err != nil {
+		t.Fatalf("ConfigFileUnset() error = %v", err)
+	}
+	if err := ConfigFileUnset(path, "export.excludeRepo", "not/listed"); err != nil {
+		t.Fatalf("ConfigFileUnset() of a missing value error = %v", err)
+	}
+
+	got, err := ConfigFileGetAll(path, "export.excludeRepo")
+	if err != nil {
+		t.Fatalf("ConfigFileGetAll() error = %v", err)
+	}
+	if want := []string{"me/dotfiles"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFileGetAll() = %v, want %v", got, want)
+	}
+}
+
+func TestConfigFileSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if entries, err := ConfigFileList(path); err != nil || entries != nil {
+		t.Fatalf("ConfigFileList() of a missing file = %v, %v", entries, err)
+	}
+
+	for _, kv := range [][2]string{{"source.Old-Work.method", "scrape"}, {"source.Old-Work.host", "github.com"}, {"source.bob.method", "api"}} {
+		if err := ConfigFileSet(path, kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ConfigFileRemoveSection(path, "source.bob"); err != nil {
+		t.Fatalf("ConfigFileRemoveSection() error = %v", err)
+	}
+	if err := ConfigFileRemoveSection(path, "source.nobody"); err != nil {
+		t.Fatalf("ConfigFileRemoveSection() of a missing section error = %v", err)
+	}
+
+	got, err := ConfigFileList(path)
+	if err != nil {
+		t.Fatalf("ConfigFileList() error = %v", err)
+	}
+	want := []ConfigEntry{{Key: "source.Old-Work.method", Value: "scrape"}, {Key: "source.Old-Work.host", Value: "github.com"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigFileList() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package github
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CurrentRepository returns the owner/name of the GitHub repository the
+// current directory's remote points at
+func CurrentRepository() (string, error) {
+	cmd := exec.Command("gh", "repo", "view", "--json", "nameWithOwner", "--jq", ".nameWithOwner")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("gh repo view failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to run gh: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// RemoveCollaborator removes login's access to repo (owner/name). An account
+// may remove itself; removing anyone else needs admin access.
+func RemoveCollaborator(repo, login string) error {
+	_, err := ghAPI("-X", "DELETE", fmt.Sprintf("repos/%s/collaborators/%s", repo, login))
+	return err
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
@@ -26,13 +27,22 @@ type ContributionCalendar struct {
 }
 
 type ContributionsCollection struct {
-	ContributionCalendar ContributionCalendar `json:"contributionCalendar"`
+	ContributionCalendar          ContributionCalendar `json:"contributionCalendar"`
+	HasAnyRestrictedContributions bool                 `json:"hasAnyRestrictedContributions"`
 }
 
 type UserData struct {
+	IsViewer                bool                    `json:"isViewer"`
 	ContributionsCollection ContributionsCollection `json:"contributionsCollection"`
 }
 
+// includesPrivate reports whether the calendar counts private contributions:
+// your own calendar counts those your token can see, and another account's
+// only does when it shares its private contribution counts
+func (u UserData) includesPrivate() bool {
+	return u.IsViewer || u.ContributionsCollection.HasAnyRestrictedContributions
+}
+
 type GraphQLResponse struct {
 	Data struct {
 		User UserData `json:"user"`
@@ -72,19 +82,102 @@ func GetCurrentUser() (string, error) {
 	return username, nil
 }
 
+// Account identifies the authenticated GitHub account
+type Account struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+// accountEmail is one entry of the authenticated account's email list
+type accountEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// GetCurrentAccount returns the ID, login and display name of the authenticated account
+func GetCurrentAccount() (*Account, error) {
+	cmd := exec.Command("gh", "api", "user")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("gh api failed: %s", string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("failed to run gh: %w", err)
+	}
+
+	var account Account
+	if err := json.Unmarshal(output, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+	return &account, nil
+}
+
+// GetVerifiedEmails returns the authenticated account's verified email
+// addresses, primary first. It needs the user:email scope, which gh tokens
+// do not always carry.
+func GetVerifiedEmails() ([]string, error) {
+	cmd := exec.Command("gh", "api", "user/emails")
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("gh api failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run gh: %w", err)
+	}
+
+	var emails []accountEmail
+	if err := json.Unmarshal(output, &emails); err != nil {
+		return nil, fmt.Errorf("failed to parse emails: %w", err)
+	}
+
+	var verified []string
+	for _, e := range emails {
+		if !e.Verified {
+			continue
+		}
+		if e.Primary {
+			verified = append([]string{e.Email}, verified...)
+		} else {
+			verified = append(verified, e.Email)
+		}
+	}
+	return verified, nil
+}
+
+// NoReplyEmail returns the account's GitHub-provided noreply address, which is
+// always attributed to the account whatever its email settings
+func NoReplyEmail(id int64, login string) string {
+	return fmt.Sprintf("%d+%s@users.noreply.github.com", id, login)
+}
+
+// DefaultHost is the GitHub host profiles are scraped from
+const DefaultHost = "github.com"
+
+// Host returns the GitHub host gh talks to, which GH_HOST overrides
+func Host() string {
+	if host := os.Getenv("GH_HOST"); host != "" {
+		return host
+	}
+	return DefaultHost
+}
+
 // FetchContributions fetches contribution data for a user (last year only)
-// If since is not zero, only fetches contributions after that date
-func FetchContributions(username string, since time.Time) ([]Contribution, error) {
+// If since is not zero, only fetches contributions after that date. private
+// reports whether the counts include private contributions.
+func FetchContributions(username string, since time.Time) (contributions []Contribution, private bool, err error) {
 	return fetchContributionsForYear(username, time.Time{}, time.Time{}, since)
 }
 
 // FetchAllContributions fetches the complete contribution history for a user
-// by iterating through years from their account creation date
-func FetchAllContributions(username string) ([]Contribution, error) {
+// by iterating through years from their account creation date. private
+// reports whether any year's counts include private contributions.
+func FetchAllContributions(username string) (contributions []Contribution, private bool, err error) {
 	// First, get the user's account creation date
 	createdAt, err := getUserCreatedAt(username)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account creation date: %w", err)
+		return nil, false, fmt.Errorf("failed to get account creation date: %w", err)
 	}
 
 	var allContributions []Contribution
@@ -102,15 +195,16 @@ func FetchAllContributions(username string) ([]Contribution, error) {
 			to = now
 		}
 
-		contributions, err := fetchContributionsForYear(username, from, to, time.Time{})
+		contributions, yearPrivate, err := fetchContributionsForYear(username, from, to, time.Time{})
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch contributions for %d: %w", year, err)
+			return nil, false, fmt.Errorf("failed to fetch contributions for %d: %w", year, err)
 		}
 
 		allContributions = append(allContributions, contributions...)
+		private = private || yearPrivate
 	}
 
-	return allContributions, nil
+	return allContributions, private, nil
 }
 
 // getUserCreatedAt fetches the account creation date for a user
@@ -134,7 +228,7 @@ func getUserCreatedAt(username string) (time.Time, error) {
 }
 
 // fetchContributionsForYear fetches contributions for a specific date range
-func fetchContributionsForYear(username string, from, to time.Time, since time.Time) ([]Contribution, error) {
+func fetchContributionsForYear(username string, from, to time.Time, since time.Time) ([]Contribution, bool, error) {
 	var query string
 	var cmd *exec.Cmd
 
@@ -143,7 +237,9 @@ func fetchContributionsForYear(username string, from, to time.Time, since time.T
 		query = `
 query($user: String!) {
   user(login: $user) {
+    isViewer
     contributionsCollection {
+      hasAnyRestrictedContributions
       contributionCalendar {
         weeks {
           contributionDays {
@@ -163,7 +259,9 @@ query($user: String!) {
 		query = `
 query($user: String!, $from: DateTime!, $to: DateTime!) {
   user(login: $user) {
+    isViewer
     contributionsCollection(from: $from, to: $to) {
+      hasAnyRestrictedContributions
       contributionCalendar {
         weeks {
           contributionDays {
@@ -185,14 +283,14 @@ query($user: String!, $from: DateTime!, $to: DateTime!) {
 	output, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("gh graphql failed: %s", string(exitErr.Stderr))
+			return nil, false, fmt.Errorf("gh graphql failed: %s", string(exitErr.Stderr))
 		}
-		return nil, fmt.Errorf("failed to run gh: %w", err)
+		return nil, false, fmt.Errorf("failed to run gh: %w", err)
 	}
 
 	var resp GraphQLResponse
 	if err := json.Unmarshal(output, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, false, fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	var contributions []Contribution
@@ -220,7 +318,7 @@ query($user: String!, $from: DateTime!, $to: DateTime!) {
 		}
 	}
 
-	return contributions, nil
+	return contributions, resp.Data.User.includesPrivate(), nil
 }
 
 // ScrapeAllContributions fetches the complete contribution history by scraping
@@ -1,6 +1,7 @@
 package github
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 )
@@ -63,3 +64,24 @@ func TestParseScrapedContributions(t *testing.T) {
 		})
 	}
 }
+
+func TestCalendarIncludesPrivate(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		want bool
+	}{
+		{"own calendar", `{"isViewer":true}`, true},
+		{"shared private counts", `{"contributionsCollection":{"hasAnyRestrictedContributions":true}}`, true},
+		{"public only", `{"isViewer":false,"contributionsCollection":{"hasAnyRestrictedContributions":false}}`, false},
+	}
+	for _, tt := range tests {
+		var resp GraphQLResponse
+		if err := json.Unmarshal([]byte(`{"data":{"user":`+tt.user+`}}`), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Data.User.includesPrivate(); got != tt.want {
+			t.Errorf("%s: includesPrivate() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
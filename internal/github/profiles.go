@@ -0,0 +1,109 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Gist is a public gist found on a profile
+type Gist struct {
+	ID  string `json:"id"`
+	URL string `json:"html_url"`
+}
+
+// maxSearchedGists bounds how many of a user's most recent gists are read
+// when looking for a published code
+const maxSearchedGists = 30
+
+// ghAPI runs 'gh api' with args and returns its output
+func ghAPI(args ...string) ([]byte, error) {
+	cmd := exec.Command("gh", append([]string{"api"}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("gh api failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run gh: %w", err)
+	}
+	return output, nil
+}
+
+// GetUserBio returns the bio on a user's public profile
+func GetUserBio(username string) (string, error) {
+	output, err := ghAPI(fmt.Sprintf("users/%s", username))
+	if err != nil {
+		return "", err
+	}
+	var profile struct {
+		Bio string `json:"bio"`
+	}
+	if err := json.Unmarshal(output, &profile); err != nil {
+		return "", fmt.Errorf("failed to parse profile: %w", err)
+	}
+	return profile.Bio, nil
+}
+
+// FindGistContaining returns the user's most recent public gist whose
+// description or files contain text, or nil if none does
+func FindGistContaining(username, text string) (*Gist, error) {
+	output, err := ghAPI(fmt.Sprintf("users/%s/gists?per_page=%d", username, maxSearchedGists))
+	if err != nil {
+		return nil, err
+	}
+	var gists []struct {
+		Gist
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(output, &gists); err != nil {
+		return nil, fmt.Errorf("failed to parse gists: %w", err)
+	}
+
+	for _, g := range gists {
+		if strings.Contains(g.Description, text) {
+			return &g.Gist, nil
+		}
+		// The list leaves out file contents, so each gist is fetched in full.
+		output, err := ghAPI(fmt.Sprintf("gists/%s", g.ID))
+		if err != nil {
+			return nil, err
+		}
+		var full struct {
+			Files map[string]struct {
+				Content string `json:"content"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(output, &full); err != nil {
+			return nil, fmt.Errorf("failed to parse gist %s: %w", g.ID, err)
+		}
+		for _, f := range full.Files {
+			if strings.Contains(f.Content, text) {
+				return &g.Gist, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// GetSSHKeys returns the public SSH keys listed on a user's profile, both
+// authentication and signing keys, in authorized_keys format
+func GetSSHKeys(username string) ([]string, error) {
+	var keys []string
+	for _, endpoint := range []string{"users/%s/keys", "users/%s/ssh_signing_keys"} {
+		output, err := ghAPI(fmt.Sprintf(endpoint, username))
+		if err != nil {
+			return nil, err
+		}
+		var listed []struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(output, &listed); err != nil {
+			return nil, fmt.Errorf("failed to parse keys: %w", err)
+		}
+		for _, k := range listed {
+			keys = append(keys, k.Key)
+		}
+	}
+	return keys, nil
+}
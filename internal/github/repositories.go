@@ -0,0 +1,275 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// repositoryWindowDays bounds each per-repository query. A repository has at
+// most one commit contribution node per day, so the first 100 nodes always
+// cover a whole window.
+const repositoryWindowDays = 90
+
+// maxRepositoriesPerWindow is the most repositories GitHub reports commit
+// contributions for in one contributionsCollection
+const maxRepositoriesPerWindow = 100
+
+// RepositoryContribution is how many contributions a user made to one
+// repository on one day
+type RepositoryContribution struct {
+	Repository string // owner/name
+	Date       string
+	Count      int
+}
+
+// repositoryRef is a repository as returned by the GraphQL API
+type repositoryRef struct {
+	NameWithOwner string `json:"nameWithOwner"`
+}
+
+// repositoryContributionNode is one issue, pull request, review or repository
+// creation. Only the field matching its connection is set.
+type repositoryContributionNode struct {
+	OccurredAt time.Time      `json:"occurredAt"`
+	Repository *repositoryRef `json:"repository"`
+	Issue      *struct {
+		Repository repositoryRef `json:"repository"`
+	} `json:"issue"`
+	PullRequest *struct {
+		Repository repositoryRef `json:"repository"`
+	} `json:"pullRequest"`
+}
+
+func (n repositoryContributionNode) repository() string {
+	switch {
+	case n.Issue != nil:
+		return n.Issue.Repository.NameWithOwner
+	case n.PullRequest != nil:
+		return n.PullRequest.Repository.NameWithOwner
+	case n.Repository != nil:
+		return n.Repository.NameWithOwner
+	}
+	return ""
+}
+
+type repositoryContributionConnection struct {
+	PageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []repositoryContributionNode `json:"nodes"`
+}
+
+type commitContributionsByRepository struct {
+	Repository    repositoryRef `json:"repository"`
+	Contributions struct {
+		PageInfo struct {
+			HasNextPage bool `json:"hasNextPage"`
+		} `json:"pageInfo"`
+		Nodes []struct {
+			OccurredAt  time.Time `json:"occurredAt"`
+			CommitCount int       `json:"commitCount"`
+		} `json:"nodes"`
+	} `json:"contributions"`
+}
+
+// repositoryConnections are the contributionsCollection connections, besides
+// commits, whose contributions belong to a repository, with the selection that
+// names it
+var repositoryConnections = []struct {
+	field     string
+	selection string
+}{
+	{"issueContributions", "issue { repository { nameWithOwner } }"},
+	{"pullRequestContributions", "pullRequest { repository { nameWithOwner } }"},
+	{"pullRequestReviewContributions", "repository { nameWithOwner }"},
+	{"repositoryContributions", "repository { nameWithOwner }"},
+}
+
+// FetchRepositoryContributions returns a user's contributions between from and
+// to broken down by repository and day. Days are UTC calendar days, matching
+// the calendar returned by FetchContributions.
+func FetchRepositoryContributions(username string, from, to time.Time) ([]RepositoryContribution, error) {
+	type repoDay struct{ repository, date string }
+	counts := make(map[repoDay]int)
+
+	for start := from; !start.After(to); start = start.AddDate(0, 0, repositoryWindowDays) {
+		// Windows are inclusive at both ends, so stop a second short of the next
+		end := start.AddDate(0, 0, repositoryWindowDays).Add(-time.Second)
+		if end.After(to) {
+			end = to
+		}
+
+		byRepo, err := fetchCommitContributionsByRepository(username, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range byRepo {
+			for _, node := range repo.Contributions.Nodes {
+				counts[repoDay{repo.Repository.NameWithOwner, node.OccurredAt.UTC().Format("2006-01-02")}] += node.CommitCount
+			}
+		}
+
+		for _, conn := range repositoryConnections {
+			nodes, err := fetchRepositoryConnection(username, start, end, conn.field, conn.selection)
+			if err != nil {
+				return nil, err
+			}
+			for _, node := range nodes {
+				counts[repoDay{node.repository(), node.OccurredAt.UTC().Format("2006-01-02")}]++
+			}
+		}
+	}
+
+	var contributions []RepositoryContribution
+	for key, count := range counts {
+		contributions = append(contributions, RepositoryContribution{Repository: key.repository, Date: key.date, Count: count})
+	}
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].Date != contributions[j].Date {
+			return contributions[i].Date < contributions[j].Date
+		}
+		return contributions[i].Repository < contributions[j].Repository
+	})
+	return contributions, nil
+}
+
+// fetchCommitContributionsByRepository returns one window's commit
+// contributions grouped by repository. GitHub reports at most
+// maxRepositoriesPerWindow repositories and has no cursor to page through the
+// rest, so a window that hits the limit is split in half and each half fetched
+// on its own, down to single days.
+func fetchCommitContributionsByRepository(username string, from, to time.Time) ([]commitContributionsByRepository, error) {
+	byRepo, err := queryCommitContributions(username, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(byRepo) < maxRepositoriesPerWindow {
+		return byRepo, nil
+	}
+	if to.Sub(from) < 24*time.Hour {
+		return nil, fmt.Errorf("committed to %d or more repositories on %s; per-repository counts would be incomplete",
+			maxRepositoriesPerWindow, from.Format("2006-01-02"))
+	}
+
+	mid := from.Add(to.Sub(from) / 2).Truncate(24 * time.Hour)
+	if !mid.After(from) {
+		mid = from.Add(24 * time.Hour)
+	}
+	first, err := fetchCommitContributionsByRepository(username, from, mid.Add(-time.Second))
+	if err != nil {
+		return nil, err
+	}
+	second, err := fetchCommitContributionsByRepository(username, mid, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// queryCommitContributions runs the commit contributions query for one window;
+// tests replace it
+var queryCommitContributions = queryCommitContributionsByRepository
+
+func queryCommitContributionsByRepository(username string, from, to time.Time) ([]commitContributionsByRepository, error) {
+	query := fmt.Sprintf(`
+query($user: String!, $from: DateTime!, $to: DateTime!) {
+  user(login: $user) {
+    contributionsCollection(from: $from, to: $to) {
+      commitContributionsByRepository(maxRepositories: %d) {
+        repository { nameWithOwner }
+        contributions(first: 100) {
+          pageInfo { hasNextPage }
+          nodes { occurredAt commitCount }
+        }
+      }
+    }
+  }
+}`, maxRepositoriesPerWindow)
+
+	var resp struct {
+		Data struct {
+			User struct {
+				ContributionsCollection struct {
+					CommitContributionsByRepository []commitContributionsByRepository `json:"commitContributionsByRepository"`
+				} `json:"contributionsCollection"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := runWindowQuery(query, username, from, to, "", &resp); err != nil {
+		return nil, err
+	}
+
+	byRepo := resp.Data.User.ContributionsCollection.CommitContributionsByRepository
+	for _, repo := range byRepo {
+		if repo.Contributions.PageInfo.HasNextPage {
+			return nil, fmt.Errorf("more commit contribution days than expected for %s between %s and %s",
+				repo.Repository.NameWithOwner, from.Format("2006-01-02"), to.Format("2006-01-02"))
+		}
+	}
+	return byRepo, nil
+}
+
+// fetchRepositoryConnection pages through one window of a contribution connection
+func fetchRepositoryConnection(username string, from, to time.Time, field, selection string) ([]repositoryContributionNode, error) {
+	query := fmt.Sprintf(`
+query($user: String!, $from: DateTime!, $to: DateTime!, $after: String) {
+  user(login: $user) {
+    contributionsCollection(from: $from, to: $to) {
+      %s(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes { occurredAt %s }
+      }
+    }
+  }
+}`, field, selection)
+
+	var nodes []repositoryContributionNode
+	after := ""
+	for {
+		var resp struct {
+			Data struct {
+				User struct {
+					ContributionsCollection map[string]repositoryContributionConnection `json:"contributionsCollection"`
+				} `json:"user"`
+			} `json:"data"`
+		}
+		if err := runWindowQuery(query, username, from, to, after, &resp); err != nil {
+			return nil, err
+		}
+
+		conn := resp.Data.User.ContributionsCollection[field]
+		nodes = append(nodes, conn.Nodes...)
+		if !conn.PageInfo.HasNextPage {
+			return nodes, nil
+		}
+		after = conn.PageInfo.EndCursor
+	}
+}
+
+// runWindowQuery runs a contributionsCollection query for one date window
+func runWindowQuery(query, username string, from, to time.Time, after string, resp any) error {
+	args := []string{"api", "graphql",
+		"-f", fmt.Sprintf("query=%s", query),
+		"-f", fmt.Sprintf("user=%s", username),
+		"-f", fmt.Sprintf("from=%s", from.Format(time.RFC3339)),
+		"-f", fmt.Sprintf("to=%s", to.Format(time.RFC3339))}
+	if after != "" {
+		args = append(args, "-f", fmt.Sprintf("after=%s", after))
+	}
+
+	output, err := exec.Command("gh", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("gh graphql failed: %s", string(exitErr.Stderr))
+		}
+		return fmt.Errorf("failed to run gh: %w", err)
+	}
+	if err := json.Unmarshal(output, resp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
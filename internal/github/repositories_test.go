@@ -0,0 +1,60 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchCommitContributionsByRepositorySplitsFullWindows(t *testing.T) {
+	// One repository per day, so any window longer than 99 days is full
+	original := queryCommitContributions
+	t.Cleanup(func() { queryCommitContributions = original })
+	var windows []string
+	queryCommitContributions = func(username string, from, to time.Time) ([]commitContributionsByRepository, error) {
+		windows = append(windows, from.Format("2006-01-02")+".."+to.Format("2006-01-02"))
+		var byRepo []commitContributionsByRepository
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			var repo commitContributionsByRepository
+			repo.Repository.NameWithOwner = "alice/" + day.Format("2006-01-02")
+			byRepo = append(byRepo, repo)
+		}
+		return byRepo, nil
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 120).Add(-time.Second)
+	byRepo, err := fetchCommitContributionsByRepository("alice", from, to)
+	if err != nil {
+		t.Fatalf("fetchCommitContributionsByRepository() error = %v", err)
+	}
+	if len(byRepo) != 120 {
+		t.Fatalf("fetched %d repositories, want 120 (windows %v)", len(byRepo), windows)
+	}
+	seen := make(map[string]bool)
+	for _, repo := range byRepo {
+		if seen[repo.Repository.NameWithOwner] {
+			t.Fatalf("%s fetched twice; split windows overlap (windows %v)", repo.Repository.NameWithOwner, windows)
+		}
+		seen[repo.Repository.NameWithOwner] = true
+	}
+}
+
+func TestFetchCommitContributionsByRepositoryFailsOnFullDay(t *testing.T) {
+	original := queryCommitContributions
+	t.Cleanup(func() { queryCommitContributions = original })
+	queryCommitContributions = func(username string, from, to time.Time) ([]commitContributionsByRepository, error) {
+		byRepo := make([]commitContributionsByRepository, maxRepositoriesPerWindow)
+		for i := range byRepo {
+			byRepo[i].Repository.NameWithOwner = fmt.Sprintf("alice/repo-%d", i)
+		}
+		return byRepo, nil
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := fetchCommitContributionsByRepository("alice", from, from.AddDate(0, 0, 4).Add(-time.Second))
+	if err == nil || !strings.Contains(err.Error(), "on 2024-01-01") {
+		t.Fatalf("fetchCommitContributionsByRepository() error = %v, want a full single day reported", err)
+	}
+}
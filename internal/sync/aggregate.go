@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// AggregationMode decides how another account's contributions combine with yours
+type AggregationMode string
+
+const (
+	// AggregateSum adds every source's count to yours
+	AggregateSum AggregationMode = "sum"
+	// AggregateMax raises each day to the highest count of any single account,
+	// so work that shows up on several accounts is not counted twice
+	AggregateMax AggregationMode = "max"
+	// AggregatePresence adds at most one contribution per active source day
+	AggregatePresence AggregationMode = "presence"
+	// AggregateScaled multiplies each source's count by its configured scale
+	AggregateScaled AggregationMode = "scaled"
+)
+
+// ParseAggregationMode validates a mode name from the command line
+func ParseAggregationMode(name string) (AggregationMode, error) {
+	switch m := AggregationMode(name); m {
+	case AggregateSum, AggregateMax, AggregatePresence, AggregateScaled:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown aggregation mode %q (want %s, %s, %s or %s)",
+		name, AggregateSum, AggregateMax, AggregatePresence, AggregateScaled)
+}
+
+// targetCount is how many commits should be mirrored in total from source on
+// the contribution's day. mirrorUser creates only the difference from what is
+// already in MirroredCounts, and never removes commits when a target drops.
+func (e *Engine) targetCount(source string, c Contribution) int {
+	return aggregateTarget(e.aggregation, e.scales, e.maxTargets, source, c)
+}
+
+// aggregateTarget is targetCount under mode, with maxTargets planned by
+// planMaxTargets for max mode
+func aggregateTarget(mode AggregationMode, scales map[string]float64, maxTargets map[string]map[string]int, source string, c Contribution) int {
+	switch mode {
+	case AggregatePresence:
+		return min(c.Count, 1)
+	case AggregateScaled:
+		scale, ok := scales[source]
+		if !ok {
+			scale = 1
+		}
+		return int(math.Round(float64(c.Count) * scale))
+	case AggregateMax:
+		return maxTargets[source][c.Date]
+	default:
+		return c.Count
+	}
+}
+
+// MirrorTargets returns how many commits a sync under mode mirrors in total
+// from a source on a day, worked out as the sync does. Max mode plans every
+// day at once, from your own file and the sources a sync would mirror.
+func MirrorTargets(mode AggregationMode, scales map[string]float64, own *ContributionData, sources map[string]*ContributionData, state *SyncState, now time.Time) func(source string, c Contribution) int {
+	var maxTargets map[string]map[string]int
+	if mode == AggregateMax {
+		maxTargets = planMaxTargets(own, sources, state, now)
+	}
+	return func(source string, c Contribution) int {
+		return aggregateTarget(mode, scales, maxTargets, source, c)
+	}
+}
+
+// planMaxTargets works out max-mode targets for every source and day. Your own
+// file records the calendar including mirror commits already counted, so your
+// native count for a day is what remains after subtracting them. The day needs
+// enough mirror commits to lift that native count to the busiest source's
+// count; any shortfall is assigned to that source, and every other source keeps
+// what it already has.
+func planMaxTargets(own *ContributionData, sources map[string]*ContributionData, state *SyncState, now time.Time) map[string]map[string]int {
+	ownByDate := make(map[string]int)
+	for _, c := range own.Contributions {
+		ownByDate[c.Date] = c.Count
+	}
+
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	filters := state.EffectiveFilters()
+	targets := make(map[string]map[string]int)
+	best := make(map[string]string) // date -> busiest source
+	bestCount := make(map[string]int)
+	for _, name := range names {
+		targets[name] = make(map[string]int)
+		for _, c := range sources[name].Contributions {
+			targets[name][c.Date] = state.GetMirroredCount(name, c.Date)
+			if !filters.Allows(name, c.Date, now) {
+				continue
+			}
+			if c.Count > bestCount[c.Date] {
+				best[c.Date] = name
+				bestCount[c.Date] = c.Count
+			}
+		}
+	}
+
+	for date, name := range best {
+		mirrored := 0
+		for source := range state.MirroredCounts {
+			mirrored += state.GetMirroredCount(source, date)
+		}
+		native := max(0, ownByDate[date]-mirrored)
+		if needed := bestCount[date] - native - mirrored; needed > 0 {
+			targets[name][date] += needed
+		}
+	}
+	return targets
+}
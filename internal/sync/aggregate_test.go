@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTargetCount(t *testing.T) {
+	c := Contribution{Date: "2024-01-02", Count: 5}
+	tests := []struct {
+		name   string
+		engine *Engine
+		want   int
+	}{
+		{name: "default is sum", engine: &Engine{}, want: 5},
+		{name: "sum", engine: &Engine{aggregation: AggregateSum}, want: 5},
+		{name: "presence", engine: &Engine{aggregation: AggregatePresence}, want: 1},
+		{name: "scaled", engine: &Engine{aggregation: AggregateScaled, scales: map[string]float64{"bob": 0.5}}, want: 3},
+		{name: "scaled without a multiplier", engine: &Engine{aggregation: AggregateScaled}, want: 5},
+		{name: "max", engine: &Engine{aggregation: AggregateMax, maxTargets: map[string]map[string]int{"bob": {"2024-01-02": 2}}}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.engine.targetCount("bob", c); got != tt.want {
+				t.Errorf("targetCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanMaxTargets(t *testing.T) {
+	own := &ContributionData{Contributions: []Contribution{
+		{Date: "2024-01-01", Count: 4}, // native 4, busiest source 6: mirror 2
+		{Date: "2024-01-02", Count: 9}, // native 9 beats every source: mirror nothing
+		{Date: "2024-01-03", Count: 5}, // 3 of these are bob's mirrors: native 2, carol has 7
+	}}
+	sources := map[string]*ContributionData{
+		"bob": {Contributions: []Contribution{
+			{Date: "2024-01-01", Count: 6},
+			{Date: "2024-01-02", Count: 3},
+			{Date: "2024-01-03", Count: 3},
+		}},
+		"carol": {Contributions: []Contribution{
+			{Date: "2024-01-01", Count: 6},
+			{Date: "2024-01-03", Count: 7},
+		}},
+	}
+	state := &SyncState{MirroredCounts: map[string]map[string]int{"bob": {"2024-01-03": 3}}}
+
+	got := planMaxTargets(own, sources, state, time.Now())
+	want := map[string]map[string]int{
+		// Ties go to the first source by name.
+		"bob":   {"2024-01-01": 2, "2024-01-02": 0, "2024-01-03": 3},
+		"carol": {"2024-01-01": 0, "2024-01-03": 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("planMaxTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestMirrorUserPresenceKeepsExistingCommits(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json",
+		`{"username":"bob","contributions":[{"date":"2024-01-02","count":4},{"date":"2024-01-03","count":2}]}`)
+
+	state := &SyncState{Username: "alice"}
+	state.SetMirroredCount("bob", "2024-01-02", 4)
+	batchCount := 0
+	var mirrored int
+	withWorkingDirectory(t, repo, func() {
+		var err error
+		mirrored, err = (&Engine{username: "alice", aggregation: AggregatePresence}).mirrorUser("bob", state, false, &batchCount)
+		if err != nil {
+			t.Fatalf("mirrorUser() error = %v", err)
+		}
+	})
+
+	if mirrored != 1 {
+		t.Errorf("mirrored %d commits, want 1", mirrored)
+	}
+	// Switching to presence never lowers what was already mirrored.
+	if got := state.GetMirroredCount("bob", "2024-01-02"); got != 4 {
+		t.Errorf("mirrored count for 2024-01-02 = %d, want 4", got)
+	}
+	if got := state.GetMirroredCount("bob", "2024-01-03"); got != 1 {
+		t.Errorf("mirrored count for 2024-01-03 = %d, want 1", got)
+	}
+}
@@ -0,0 +1,253 @@
+package sync
+
+import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/git"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// AttestMethod is how an imported account proves it belongs to the importer
+type AttestMethod string
+
+const (
+	AttestBio  AttestMethod = "bio"  // the code is in the account's profile bio
+	AttestGist AttestMethod = "gist" // the code is in one of its public gists
+	AttestSSH  AttestMethod = "ssh"  // the code is signed with an SSH key on its profile
+)
+
+// Attestation records how an imported account was shown to be the importer's.
+// It keeps the published code, and for AttestSSH the signature, so every clone
+// can check the proof for itself instead of taking the importer's word.
+type Attestation struct {
+	Method     AttestMethod `json:"method"`
+	Code       string       `json:"code,omitempty"`      // the one-time code the account published
+	Proof      string       `json:"proof,omitempty"`     // gist URL or SSH key fingerprint
+	Signature  string       `json:"signature,omitempty"` // AttestSSH: the code signed by the account
+	AttestedBy string       `json:"attested_by"`
+	AttestedAt time.Time    `json:"attested_at"`
+}
+
+// sharedConfigPath is the committed settings file every collaborator follows
+var sharedConfigPath = filepath.Join(vanityDir, "config")
+
+const (
+	requireAttestationKey = "policy.requireAttestation"
+	attestNamespace       = "vanity-attest" // ssh-keygen -Y namespace
+)
+
+var sshFingerprintPattern = regexp.MustCompile(`SHA256:[A-Za-z0-9+/]+`)
+
+// ParseAttestMethod parses an attestation method name
+func ParseAttestMethod(s string) (AttestMethod, error) {
+	switch m := AttestMethod(s); m {
+	case AttestBio, AttestGist, AttestSSH:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid attestation method %q (want bio, gist or ssh)", s)
+}
+
+// AttestationRequired reports whether the shared config requires imported
+// accounts to be attested
+func AttestationRequired() (bool, error) {
+	value, err := git.ConfigFileGet(sharedConfigPath, requireAttestationKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", requireAttestationKey, err)
+	}
+	return value == "true", nil
+}
+
+func challengeKey(login string) string {
+	return "attest." + strings.ToLower(login) + ".challenge"
+}
+
+// AttestationChallenge returns the one-time code login must publish, and
+// whether it was just created. The code is kept in local config until an
+// attestation with it succeeds.
+func AttestationChallenge(login string) (code string, created bool, err error) {
+	code, err = config.Get(challengeKey(login))
+	if err != nil || code != "" {
+		return code, false, err
+	}
+	raw := make([]byte, 8)
+	if _, err := cryptorand.Read(raw); err != nil {
+		return "", false, fmt.Errorf("failed to generate code: %w", err)
+	}
+	code = "vanity-attest-" + hex.EncodeToString(raw)
+	if err := config.Set(challengeKey(login), code); err != nil {
+		return "", false, err
+	}
+	return code, true, nil
+}
+
+// Attest checks that login has published its pending code by method and
+// returns the attestation, consuming the code. For AttestSSH, signatureFile
+// holds the code signed with 'ssh-keygen -Y sign -n vanity-attest'.
+func Attest(login string, method AttestMethod, signatureFile, attestedBy string) (*Attestation, error) {
+	code, err := config.Get(challengeKey(login))
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, fmt.Errorf("no attestation code is pending for %s", login)
+	}
+
+	a := &Attestation{Method: method, Code: code, AttestedBy: attestedBy, AttestedAt: time.Now().UTC()}
+	if method == AttestSSH {
+		if signatureFile == "" {
+			return nil, fmt.Errorf("an SSH signature file is required")
+		}
+		signature, err := os.ReadFile(signatureFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH signature: %w", err)
+		}
+		a.Signature = string(signature)
+	}
+	if a.Proof, err = checkPublishedCode(login, a); err != nil {
+		return nil, err
+	}
+
+	if err := config.Unset(challengeKey(login), ""); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// checkPublishedCode checks that login published a's code by a's method, and
+// returns what proves it: the gist's URL or the SSH key's fingerprint
+func checkPublishedCode(login string, a *Attestation) (string, error) {
+	switch a.Method {
+	case AttestBio:
+		bio, err := github.GetUserBio(login)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s's profile: %w", login, err)
+		}
+		if !strings.Contains(bio, a.Code) {
+			return "", fmt.Errorf("%s's bio does not contain %s", login, a.Code)
+		}
+		return "", nil
+	case AttestGist:
+		gist, err := github.FindGistContaining(login, a.Code)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s's gists: %w", login, err)
+		}
+		if gist == nil {
+			return "", fmt.Errorf("none of %s's recent public gists contains %s", login, a.Code)
+		}
+		return gist.URL, nil
+	case AttestSSH:
+		keys, err := github.GetSSHKeys(login)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s's SSH keys: %w", login, err)
+		}
+		return verifySSHSignature(login, a.Code, keys, a.Signature)
+	}
+	return "", fmt.Errorf("invalid attestation method %q", a.Method)
+}
+
+// verifySSHSignature checks signature is a signature of code by one of keys,
+// and returns the fingerprint of the key that made it
+func verifySSHSignature(login, code string, keys []string, signature string) (string, error) {
+	if len(keys) == 0 {
+		return "", fmt.Errorf("%s lists no SSH keys on their profile", login)
+	}
+	dir, err := os.MkdirTemp("", "vanity-attest-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var allowed strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&allowed, "%s namespaces=%q %s\n", login, attestNamespace, key)
+	}
+	allowedPath := filepath.Join(dir, "allowed_signers")
+	signaturePath := filepath.Join(dir, "code.sig")
+	if err := os.WriteFile(allowedPath, []byte(allowed.String()), 0600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(signaturePath, []byte(signature), 0600); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", allowedPath, "-I", login,
+		"-n", attestNamespace, "-s", signaturePath)
+	cmd.Stdin = strings.NewReader(code)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("SSH signature does not verify against %s's profile keys: %s", login, strings.TrimSpace(string(output)))
+	}
+	return sshFingerprintPattern.FindString(string(output)), nil
+}
+
+// attestationCheckedKey records, per stored name, the attestation this clone
+// has already checked, so the account's profile is read once rather than on
+// every sync
+func attestationCheckedKey(name string) string {
+	return "attest." + name + ".checked"
+}
+
+// attestationFingerprint identifies an attestation's content
+func attestationFingerprint(a *Attestation) string {
+	raw, _ := json.Marshal(a)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkAttestation refuses an imported file without a valid attestation when
+// the shared config requires one. Files signed by their owner were written by
+// that account's own sync and need none. An attestation is checked against the
+// account's profile by this clone itself, since anyone who can push could
+// write one into a file.
+func checkAttestation(data *ContributionData, owner string) error {
+	if data.Signature != nil && data.Signature.Signer == owner {
+		return nil
+	}
+	required, err := AttestationRequired()
+	if err != nil || !required {
+		return err
+	}
+	var a *Attestation
+	if data.Provenance != nil {
+		a = data.Provenance.Attestation
+	}
+	if a == nil {
+		return fmt.Errorf("file was imported without an attestation, which %s requires", requireAttestationKey)
+	}
+	if a.Code == "" {
+		return fmt.Errorf("its attestation has no code to check; import it again with --attest")
+	}
+
+	fingerprint := attestationFingerprint(a)
+	checked, err := config.Get(attestationCheckedKey(owner))
+	if err != nil || checked == fingerprint {
+		return err
+	}
+
+	naming, err := LoadNaming()
+	if err != nil {
+		return err
+	}
+	login, known := naming.Login(owner)
+	if !naming.Opaque() {
+		login, known = owner, true
+	}
+	if !known {
+		return fmt.Errorf("this clone doesn't know its login, so can't check its attestation (run 'vanity opaque name <login>')")
+	}
+	if _, err := checkPublishedCode(login, a); err != nil {
+		return fmt.Errorf("its attestation does not check out: %w", err)
+	}
+	return config.Set(attestationCheckedKey(owner), fingerprint)
+}
@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubGitHubProfile puts a gh on PATH that answers profile lookups for bob
+// with the given bio and SSH key
+func stubGitHubProfile(t *testing.T, bio, sshKey string) {
+	t.Helper()
+	binDir := t.TempDir()
+	script := fmt.Sprintf(`#!/bin/sh
+case "$2" in
+users/bob) printf '{"login":"bob","bio":%%s}' '%q' ;;
+users/bob/keys) printf '[{"key":"%s"}]' ;;
+users/bob/ssh_signing_keys) echo '[]' ;;
+*) echo "stub gh: unexpected $*" >&2; exit 1 ;;
+esac
+`, bio, sshKey)
+	if err := os.WriteFile(filepath.Join(binDir, "gh"), []byte(script), 0755); err != nil {
+		t.Fatalf("write gh stub: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestAttestViaBio(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		code, created, err := AttestationChallenge("bob")
+		if err != nil || !created {
+			t.Fatalf("AttestationChallenge() = %q, %v, %v", code, created, err)
+		}
+		if again, created, _ := AttestationChallenge("bob"); again != code || created {
+			t.Errorf("a second challenge gave %q, want the pending %q", again, code)
+		}
+
+		stubGitHubProfile(t, "just a developer", "")
+		if _, err := Attest("bob", AttestBio, "", "alice"); err == nil {
+			t.Error("Attest() passed without the code in the bio")
+		}
+
+		stubGitHubProfile(t, "developer "+code, "")
+		a, err := Attest("bob", AttestBio, "", "alice")
+		if err != nil {
+			t.Fatalf("Attest() error = %v", err)
+		}
+		if a.Method != AttestBio || a.Code != code || a.AttestedBy != "alice" {
+			t.Errorf("Attest() = %+v", a)
+		}
+		if _, err := Attest("bob", AttestBio, "", "alice"); err == nil {
+			t.Error("the code was accepted twice")
+		}
+	})
+}
+
+func TestAttestViaSSHSignature(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	repo := initTestRepo(t, "main")
+	keyDir := t.TempDir()
+	key := filepath.Join(keyDir, "id_ed25519")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v\n%s", err, out)
+	}
+	pub, _ := os.ReadFile(key + ".pub")
+	fields := strings.Fields(string(pub))
+	stubGitHubProfile(t, "", fields[0]+" "+fields[1])
+
+	withWorkingDirectory(t, repo, func() {
+		code, _, err := AttestationChallenge("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sign := exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", attestNamespace)
+		sign.Stdin = strings.NewReader(code)
+		sig, err := sign.Output()
+		if err != nil {
+			t.Fatalf("ssh-keygen -Y sign: %v", err)
+		}
+		sigFile := filepath.Join(keyDir, "code.sig")
+		if err := os.WriteFile(sigFile, sig, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := Attest("bob", AttestSSH, sigFile, "alice")
+		if err != nil {
+			t.Fatalf("Attest() error = %v", err)
+		}
+		if !strings.HasPrefix(a.Proof, "SHA256:") {
+			t.Errorf("proof = %q, want the key fingerprint", a.Proof)
+		}
+		// The stored signature lets another clone check it again.
+		if _, err := checkPublishedCode("bob", a); err != nil || a.Signature != string(sig) {
+			t.Errorf("checkPublishedCode() of the stored signature error = %v", err)
+		}
+	})
+}
+
+func TestRequiredAttestationRefusesImports(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/carol.json", `{"username":"carol","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[],
+		"provenance":{"attestation":{"method":"bio","code":"vanity-attest-0011223344556677","attested_by":"alice","attested_at":"2024-01-01T00:00:00Z"}}}`)
+	writeTestFile(t, repo, ".vanity/config", "[policy]\n\trequireAttestation = true\n")
+
+	withWorkingDirectory(t, repo, func() {
+		if _, _, err := loadVerifiedContribution("carol"); err == nil || !strings.Contains(err.Error(), "attestation") {
+			t.Errorf("unattested import error = %v, want it refused", err)
+		}
+
+		// Anyone can write an attestation; only one whose code bob published passes.
+		stubGitHubProfile(t, "just a developer", "")
+		if _, _, err := loadVerifiedContribution("bob"); err == nil || !strings.Contains(err.Error(), "does not check out") {
+			t.Errorf("forged attestation error = %v, want it refused", err)
+		}
+		stubGitHubProfile(t, "developer vanity-attest-0011223344556677", "")
+		if _, _, err := loadVerifiedContribution("bob"); err != nil {
+			t.Errorf("attested import error = %v", err)
+		}
+		// Once checked, the profile isn't read again.
+		stubGitHubProfile(t, "bio changed since", "")
+		if _, _, err := loadVerifiedContribution("bob"); err != nil {
+			t.Errorf("checked attestation error = %v", err)
+		}
+
+		// An account's own sync needs no attestation.
+		var key ed25519.PrivateKey
+		captureStdout(t, func() {
+			key, _ = ensureSigningKey("carol")
+		})
+		data, _ := LoadContributionData("carol")
+		_ = signContribution(data, "carol", key)
+		_ = SaveContributionData(data)
+		if _, _, err := loadVerifiedContribution("carol"); err != nil {
+			t.Errorf("self-synced file error = %v", err)
+		}
+	})
+}
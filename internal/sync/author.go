@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wdm0006/vanity/internal/git"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// resolveAuthor works out the identity mirror commits must carry for GitHub to
+// count them toward the authenticated account. The clone's configured email is
+// kept when it is verified on the account; otherwise the account's noreply
+// address is used, since it is always attributed and never rejected by email
+// privacy settings. The returned warning explains any substitution.
+func resolveAuthor(account *github.Account, configured git.Identity) (git.Identity, string) {
+	noreply := github.NoReplyEmail(account.ID, account.Login)
+
+	verified, err := github.GetVerifiedEmails()
+	email, warning := chooseAuthorEmail(configured.Email, verified, noreply)
+	if err != nil && configured.Email != "" && email != configured.Email {
+		warning = fmt.Sprintf("could not list the verified emails of %s (%v), so git user.email %q cannot be checked; mirror commits will use %s",
+			account.Login, err, configured.Email, email)
+	}
+
+	name := configured.Name
+	if name == "" {
+		name = account.Name
+	}
+	if name == "" {
+		name = account.Login
+	}
+	return git.Identity{Name: name, Email: email}, warning
+}
+
+// chooseAuthorEmail picks the mirror commit email from the configured one, the
+// account's verified emails and its noreply address.
+func chooseAuthorEmail(configured string, verified []string, noreply string) (string, string) {
+	if configured != "" {
+		if strings.EqualFold(configured, noreply) {
+			return configured, ""
+		}
+		for _, v := range verified {
+			if strings.EqualFold(configured, v) {
+				return configured, ""
+			}
+		}
+	}
+
+	if configured == "" {
+		return noreply, ""
+	}
+	return noreply, fmt.Sprintf("git user.email %q is not a verified email of this GitHub account, so GitHub would not count mirror commits; using %s instead",
+		configured, noreply)
+}
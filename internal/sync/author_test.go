@@ -0,0 +1,65 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+func TestChooseAuthorEmail(t *testing.T) {
+	const noreply = "42+alice@users.noreply.github.com"
+	tests := []struct {
+		name        string
+		configured  string
+		verified    []string
+		want        string
+		wantWarning bool
+	}{
+		{name: "verified configured email", configured: "Alice@Example.com", verified: []string{"alice@example.com"}, want: "Alice@Example.com"},
+		{name: "configured noreply", configured: noreply, want: noreply},
+		{name: "unverified configured email", configured: "alice@work.example", verified: []string{"alice@example.com"}, want: noreply, wantWarning: true},
+		{name: "emails unavailable", configured: "alice@example.com", want: noreply, wantWarning: true},
+		{name: "nothing configured", verified: []string{"alice@example.com"}, want: noreply},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warning := chooseAuthorEmail(tt.configured, tt.verified, noreply)
+			if got != tt.want {
+				t.Errorf("chooseAuthorEmail() = %q, want %q", got, tt.want)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("chooseAuthorEmail() warning = %q, want warning: %v", warning, tt.wantWarning)
+			}
+			if tt.wantWarning && !strings.Contains(warning, tt.configured) {
+				t.Errorf("warning %q does not name the configured email %q", warning, tt.configured)
+			}
+		})
+	}
+}
+
+func TestMirrorUserAuthorsCommitsAsResolvedIdentity(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json",
+		`{"username":"bob","contributions":[{"date":"2024-01-02","count":2}]}`)
+
+	engine := &Engine{
+		username: "alice",
+		author:   git.Identity{Name: "Alice", Email: "42+alice@users.noreply.github.com"},
+	}
+	batchCount := 0
+	withWorkingDirectory(t, repo, func() {
+		if _, err := engine.mirrorUser("bob", &SyncState{Username: "alice"}, false, &batchCount); err != nil {
+			t.Fatalf("mirrorUser() error = %v", err)
+		}
+	})
+
+	identities := runGit(t, repo, "log", "--format=%an <%ae> %cn <%ce>")
+	for _, line := range strings.Split(identities, "\n") {
+		want := "Alice <42+alice@users.noreply.github.com> Alice <42+alice@users.noreply.github.com>"
+		if line != want {
+			t.Errorf("commit identity = %q, want %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Consent is what an account lets others do with its contributions. It is set
+// by the account in its own contribution file, which it signs, and every
+// other account's sync honours it before creating mirror commits.
+type Consent struct {
+	Deny        bool     `json:"deny,omitempty"`         // nobody mirrors it
+	AllowInto   []string `json:"allow_into,omitempty"`   // only these accounts mirror it
+	PausedUntil string   `json:"paused_until,omitempty"` // nobody mirrors it before this day
+}
+
+// IsEmpty reports whether the consent lets every account mirror
+func (c *Consent) IsEmpty() bool {
+	return c == nil || (!c.Deny && len(c.AllowInto) == 0 && c.PausedUntil == "")
+}
+
+// Refuses returns why into may not mirror the account now, or an empty
+// string if it may. A paused account's days are mirrored once the pause ends.
+func (c *Consent) Refuses(into string, now time.Time) string {
+	if c == nil {
+		return ""
+	}
+	if c.Deny {
+		return "it denies mirroring"
+	}
+	if len(c.AllowInto) > 0 {
+		allowed := false
+		for _, name := range c.AllowInto {
+			allowed = allowed || name == into
+		}
+		if !allowed {
+			return "it only allows mirroring into other accounts"
+		}
+	}
+	if c.PausedUntil != "" && now.Format("2006-01-02") < c.PausedUntil {
+		return "it paused mirroring until " + c.PausedUntil
+	}
+	return ""
+}
+
+// Describe summarizes the consent for people, showing stored names through
+// naming
+func (c *Consent) Describe(naming *Naming) string {
+	if c.IsEmpty() {
+		return "every account may mirror it"
+	}
+	var parts []string
+	if c.Deny {
+		parts = append(parts, "nobody may mirror it")
+	}
+	if len(c.AllowInto) > 0 {
+		logins := make([]string, len(c.AllowInto))
+		for i, name := range c.AllowInto {
+			logins[i] = naming.Display(name)
+		}
+		parts = append(parts, "only "+strings.Join(logins, ", ")+" may mirror it")
+	}
+	if c.PausedUntil != "" {
+		parts = append(parts, "paused until "+c.PausedUntil)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// validate checks the consent's accounts and date
+func (c *Consent) validate() error {
+	for _, name := range c.AllowInto {
+		if err := ValidateLogin(name); err != nil {
+			return fmt.Errorf("allow_into: %w", err)
+		}
+	}
+	if c.PausedUntil != "" {
+		if _, err := time.Parse("2006-01-02", c.PausedUntil); err != nil {
+			return fmt.Errorf("invalid paused_until %q (want YYYY-MM-DD)", c.PausedUntil)
+		}
+	}
+	return nil
+}
+
+// UpdateConsent applies change to the consent in name's own contribution
+// file, then signs and saves it. The change is pushed by the next sync.
+func UpdateConsent(name string, change func(*Consent) error) (*Consent, error) {
+	data, untrusted, err := loadOwnContribution(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contribution data: %w", err)
+	}
+	if !hasContributionData(name) {
+		return nil, fmt.Errorf("%s has not synced yet (run 'vanity sync' first)", name)
+	}
+	if untrusted {
+		return nil, fmt.Errorf("%s.json is unsigned; run 'vanity sync' to refetch and sign it first", name)
+	}
+
+	consent := &Consent{}
+	if data.Consent != nil {
+		*consent = *data.Consent
+	}
+	if err := change(consent); err != nil {
+		return nil, err
+	}
+	sort.Strings(consent.AllowInto)
+	if err := consent.validate(); err != nil {
+		return nil, err
+	}
+	data.Consent = consent
+	if consent.IsEmpty() {
+		data.Consent = nil
+	}
+
+	if err := SignWithLocalKey(data, name); err != nil {
+		return nil, fmt.Errorf("failed to sign contribution data: %w", err)
+	}
+	if err := SaveContributionData(data); err != nil {
+		return nil, fmt.Errorf("failed to save contribution data: %w", err)
+	}
+	return data.Consent, nil
+}
@@ -0,0 +1,101 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsentRefuses(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		consent *Consent
+		into    string
+		refused bool
+	}{
+		{"no consent", nil, "alice", false},
+		{"deny", &Consent{Deny: true}, "alice", true},
+		{"allowed", &Consent{AllowInto: []string{"alice", "carol"}}, "alice", false},
+		{"not allowed", &Consent{AllowInto: []string{"carol"}}, "alice", true},
+		{"paused", &Consent{PausedUntil: "2026-06-02"}, "alice", true},
+		{"pause over", &Consent{PausedUntil: "2026-06-01"}, "alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := tt.consent.Refuses(tt.into, now); (reason != "") != tt.refused {
+				t.Errorf("Refuses(%s) = %q, want refused %v", tt.into, reason, tt.refused)
+			}
+		})
+	}
+}
+
+func TestMirrorUserHonoursConsent(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json",
+		`{"username":"bob","contributions":[{"date":"2024-01-02","count":2}],"consent":{"allow_into":["carol"]}}`)
+
+	state := &SyncState{Username: "alice"}
+	batchCount := 0
+	withWorkingDirectory(t, repo, func() {
+		var mirrored int
+		var err error
+		output := captureStdout(t, func() {
+			mirrored, err = (&Engine{username: "alice"}).mirrorUser("bob", state, false, &batchCount)
+		})
+		if err != nil || mirrored != 0 {
+			t.Fatalf("mirrorUser() = %d, %v, want nothing mirrored", mirrored, err)
+		}
+		if !strings.Contains(output, "only allows mirroring into other accounts") {
+			t.Errorf("mirrorUser() output = %q", output)
+		}
+
+		captureStdout(t, func() {
+			mirrored, err = (&Engine{username: "carol"}).mirrorUser("bob", &SyncState{Username: "carol"}, false, &batchCount)
+		})
+		if err != nil || mirrored != 2 {
+			t.Errorf("allowed mirrorUser() = %d, %v, want 2", mirrored, err)
+		}
+	})
+}
+
+func TestUpdateConsentKeepsFileSigned(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			key, _ := ensureSigningKey("bob")
+			data := &ContributionData{Username: "bob", Contributions: []Contribution{{Date: "2024-01-02", Count: 1}}}
+			_ = signContribution(data, "bob", key)
+			_ = SaveContributionData(data)
+		})
+
+		consent, err := UpdateConsent("bob", func(c *Consent) error {
+			c.PausedUntil = "2030-01-01"
+			return nil
+		})
+		if err != nil || consent.PausedUntil != "2030-01-01" {
+			t.Fatalf("UpdateConsent() = %+v, %v", consent, err)
+		}
+		data, _, err := loadVerifiedContribution("bob")
+		if err != nil {
+			t.Fatalf("file no longer verifies: %v", err)
+		}
+		if data.Consent == nil || data.Consent.PausedUntil != "2030-01-01" {
+			t.Errorf("stored consent = %+v", data.Consent)
+		}
+
+		if _, err := UpdateConsent("bob", func(c *Consent) error {
+			c.PausedUntil = "soon"
+			return nil
+		}); err == nil {
+			t.Error("UpdateConsent() accepted an invalid date")
+		}
+		consent, err = UpdateConsent("bob", func(c *Consent) error {
+			c.PausedUntil = ""
+			return nil
+		})
+		if err != nil || consent != nil {
+			t.Errorf("clearing the pause = %+v, %v, want no consent stored", consent, err)
+		}
+	})
+}
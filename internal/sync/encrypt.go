@@ -0,0 +1,744 @@
+package sync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// Encryption modes. With a group key every collaborator holds the same secret;
+// with X25519 each file key is wrapped for every recipient's public key, so
+// members can be added or removed without sharing a secret.
+const (
+	EncryptGroup  = "group"
+	EncryptX25519 = "x25519"
+)
+
+// The repo's encryption settings live in .vanity/encryption (git config
+// format, no secrets); keys live in each clone's local config.
+const (
+	encryptionFile        = "encryption"
+	encryptionModeKey     = "encryption.mode"
+	encryptionCheckKey    = "encryption.check"
+	encryptionRecipKey    = "encryption.recipient"
+	localGroupKeyKey      = "encryption.groupKey"
+	localIdentityKey      = "encryption.identity"
+	recipientPrefix       = "x25519:"
+	encryptionCheckInput  = "vanity encryption check"
+	recipientWrapInfo     = "vanity x25519 file key"
+	encryptedFormatMarker = 2
+)
+
+// legacyFormatMarker is the first envelope format, whose X25519 wrap keys were
+// salted with the ephemeral key alone. It is still read, and rewritten in the
+// current format on the next save.
+const legacyFormatMarker = 1
+
+// envelope is what an encrypted .vanity file holds. The file's base name is
+// authenticated with the ciphertext, so files cannot be swapped between
+// accounts.
+type envelope struct {
+	Encrypted  int              `json:"vanity_encrypted"`
+	Mode       string           `json:"mode"`
+	Nonce      string           `json:"nonce"`
+	Ciphertext string           `json:"ciphertext"`
+	Recipients []wrappedFileKey `json:"recipients,omitempty"`
+}
+
+// wrappedFileKey is the file key encrypted for one X25519 recipient
+type wrappedFileKey struct {
+	ID         string `json:"id"` // fingerprint of the recipient's public key
+	Ephemeral  string `json:"ephemeral"`
+	Nonce      string `json:"nonce"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// Recipient is a member of an X25519-encrypted repo
+type Recipient struct {
+	Key   *ecdh.PublicKey
+	Label string
+}
+
+// String formats the recipient as stored in .vanity/encryption
+func (r Recipient) String() string {
+	s := recipientPrefix + base64.StdEncoding.EncodeToString(r.Key.Bytes())
+	if r.Label != "" {
+		s += " " + r.Label
+	}
+	return s
+}
+
+// ID fingerprints the recipient's public key
+func (r Recipient) ID() string {
+	sum := sha256.Sum256(r.Key.Bytes())
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParseRecipient parses "x25519:<base64 public key> [label]"
+func ParseRecipient(s string) (Recipient, error) {
+	key, label, _ := strings.Cut(strings.TrimSpace(s), " ")
+	encoded, ok := strings.CutPrefix(key, recipientPrefix)
+	if !ok {
+		return Recipient{}, fmt.Errorf("invalid recipient %q (want %s<key>)", key, recipientPrefix)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("invalid recipient key %q: %w", key, err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("invalid recipient key %q: %w", key, err)
+	}
+	return Recipient{Key: pub, Label: strings.TrimSpace(label)}, nil
+}
+
+// EncryptionSettings describes how the repo's .vanity files are encrypted
+type EncryptionSettings struct {
+	Mode       string
+	Check      string // group mode: identifies the key without revealing it
+	Recipients []Recipient
+}
+
+func encryptionPath() string {
+	return filepath.Join(vanityDir, encryptionFile)
+}
+
+// LoadEncryptionSettings returns the repo's encryption settings, or nil when
+// .vanity files are stored in plain JSON
+func LoadEncryptionSettings() (*EncryptionSettings, error) {
+	path := encryptionPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	mode, err := git.ConfigFileGet(path, encryptionModeKey)
+	if err != nil {
+		return nil, err
+	}
+	settings := &EncryptionSettings{Mode: mode}
+	switch mode {
+	case EncryptGroup:
+		if settings.Check, err = git.ConfigFileGet(path, encryptionCheckKey); err != nil {
+			return nil, err
+		}
+	case EncryptX25519:
+		lines, err := git.ConfigFileGetAll(path, encryptionRecipKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			r, err := ParseRecipient(line)
+			if err != nil {
+				return nil, err
+			}
+			settings.Recipients = append(settings.Recipients, r)
+		}
+		if len(settings.Recipients) == 0 {
+			return nil, fmt.Errorf("%s lists no recipients", path)
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %q in %s", mode, path)
+	}
+	return settings, nil
+}
+
+// save writes the settings to .vanity/encryption
+func (s *EncryptionSettings) save() error {
+	path := encryptionPath()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := git.ConfigFileSet(path, encryptionModeKey, s.Mode); err != nil {
+		return err
+	}
+	if s.Check != "" {
+		if err := git.ConfigFileSet(path, encryptionCheckKey, s.Check); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.Recipients {
+		if err := git.ConfigFileAdd(path, encryptionRecipKey, r.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVanityFile reads a .vanity file, decrypting it when it is encrypted.
+// Errors from reading the file itself are returned unwrapped, so callers can
+// still test them with os.IsNotExist.
+func readVanityFile(path string) ([]byte, error) {
+	return readVanityFileAs(path, path)
+}
+
+// readVanityFileAs reads file, which holds the content of the .vanity file at
+// path, such as one side of a merge
+func readVanityFileAs(file, path string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if json.Unmarshal(data, &env) != nil || env.Encrypted == 0 {
+		// Plain JSON in an encrypted repo is refused rather than trusted:
+		// anyone who can push could otherwise plant unencrypted data.
+		settings, err := LoadEncryptionSettings()
+		if err != nil {
+			return nil, err
+		}
+		if settings != nil {
+			return nil, fmt.Errorf("%s is not encrypted, but this repository is", path)
+		}
+		return data, nil
+	}
+	if env.Encrypted != encryptedFormatMarker && env.Encrypted != legacyFormatMarker {
+		return nil, fmt.Errorf("%s uses an unsupported encryption format %d", path, env.Encrypted)
+	}
+
+	plaintext, err := openEnvelope(&env, envelopeName(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+// envelopeName is the name a file's ciphertext is bound to: its path inside
+// .vanity/, so neither a top-level file nor one account's year file can be
+// swapped for another's
+func envelopeName(path string) string {
+	rel, err := filepath.Rel(vanityDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeVanityFile writes a .vanity file, encrypted when the repo is
+func writeVanityFile(path string, plaintext []byte) error {
+	return writeVanityFileAs(path, path, plaintext)
+}
+
+// writeVanityFileAs writes the content of the .vanity file at path to file
+func writeVanityFileAs(file, path string, plaintext []byte) error {
+	settings, err := LoadEncryptionSettings()
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		return os.WriteFile(file, plaintext, 0644)
+	}
+
+	env, err := sealEnvelope(settings, plaintext, envelopeName(path))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// withVanityConfig runs fn on the git-config-format .vanity file at path,
+// such as the sources manifest. In an encrypted repo fn gets a decrypted copy
+// inside .git, which is encrypted back to path when modify is set; a missing
+// file stays missing for fn, as it would be for path itself.
+func withVanityConfig(path string, modify bool, fn func(file string) error) error {
+	settings, err := LoadEncryptionSettings()
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		return fn(path)
+	}
+
+	plaintext, err := readVanityFile(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	gitDir, err := git.GitDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate .git directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(gitDir, "vanity-config-")
+	if err != nil {
+		return err
+	}
+	file := tmp.Name()
+	defer os.Remove(file)
+	_, err = tmp.Write(plaintext)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(file); err != nil {
+		return err
+	}
+	if !modify {
+		return nil
+	}
+	updated, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeVanityFile(path, updated)
+}
+
+// vanityConfigList is git.ConfigFileList for a .vanity config file
+func vanityConfigList(path string) ([]git.ConfigEntry, error) {
+	var entries []git.ConfigEntry
+	err := withVanityConfig(path, false, func(file string) error {
+		var err error
+		entries, err = git.ConfigFileList(file)
+		return err
+	})
+	return entries, err
+}
+
+// vanityConfigSet writes every key and value of pairs to a .vanity config
+// file, skipping empty values
+func vanityConfigSet(path string, pairs [][2]string) error {
+	return withVanityConfig(path, true, func(file string) error {
+		for _, kv := range pairs {
+			if kv[1] == "" {
+				continue
+			}
+			if err := git.ConfigFileSet(file, kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// vanityConfigRemoveSection is git.ConfigFileRemoveSection for a .vanity
+// config file
+func vanityConfigRemoveSection(path, section string) error {
+	return withVanityConfig(path, true, func(file string) error {
+		return git.ConfigFileRemoveSection(file, section)
+	})
+}
+
+func sealEnvelope(settings *EncryptionSettings, plaintext []byte, name string) (*envelope, error) {
+	env := &envelope{Encrypted: encryptedFormatMarker, Mode: settings.Mode}
+
+	var fileKey []byte
+	switch settings.Mode {
+	case EncryptGroup:
+		key, err := localGroupKey(settings)
+		if err != nil {
+			return nil, err
+		}
+		fileKey = key
+	case EncryptX25519:
+		fileKey = make([]byte, 32)
+		if _, err := cryptorand.Read(fileKey); err != nil {
+			return nil, err
+		}
+		for _, r := range settings.Recipients {
+			wrapped, err := wrapFileKey(fileKey, r)
+			if err != nil {
+				return nil, err
+			}
+			env.Recipients = append(env.Recipients, wrapped)
+		}
+	}
+
+	nonce, ciphertext, err := aesGCMSeal(fileKey, plaintext, []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	env.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+	return env, nil
+}
+
+func openEnvelope(env *envelope, name string) ([]byte, error) {
+	var fileKey []byte
+	switch env.Mode {
+	case EncryptGroup:
+		settings, err := LoadEncryptionSettings()
+		if err != nil {
+			return nil, err
+		}
+		if settings == nil || settings.Mode != EncryptGroup {
+			return nil, fmt.Errorf("file is group-encrypted but the repository is not in group mode")
+		}
+		if fileKey, err = localGroupKey(settings); err != nil {
+			return nil, err
+		}
+	case EncryptX25519:
+		identity, err := localIdentity()
+		if err != nil {
+			return nil, err
+		}
+		if identity == nil {
+			return nil, fmt.Errorf("this clone has no X25519 identity; run 'vanity encrypt keygen' and ask a member to add you")
+		}
+		if fileKey, err = unwrapFileKey(env.Recipients, identity, env.Encrypted); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %q", env.Mode)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	return aesGCMOpen(fileKey, nonce, ciphertext, []byte(name))
+}
+
+// wrapFileKey encrypts the file key for one recipient with a fresh ephemeral
+// X25519 key, in the manner of age
+func wrapFileKey(fileKey []byte, r Recipient) (wrappedFileKey, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return wrappedFileKey{}, err
+	}
+	wrapKey, err := deriveWrapKey(ephemeral, r.Key, ephemeral.PublicKey(), r.Key, encryptedFormatMarker)
+	if err != nil {
+		return wrappedFileKey{}, err
+	}
+	nonce, wrapped, err := aesGCMSeal(wrapKey, fileKey, nil)
+	if err != nil {
+		return wrappedFileKey{}, err
+	}
+	return wrappedFileKey{
+		ID:         r.ID(),
+		Ephemeral:  base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+	}, nil
+}
+
+func unwrapFileKey(wrapped []wrappedFileKey, identity *ecdh.PrivateKey, format int) ([]byte, error) {
+	self := Recipient{Key: identity.PublicKey()}
+	for _, w := range wrapped {
+		if w.ID != self.ID() {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(w.Ephemeral)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ephemeral key: %w", err)
+		}
+		wrapKey, err := deriveWrapKey(identity, ephemeral, ephemeral, identity.PublicKey(), format)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := base64.StdEncoding.DecodeString(w.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nonce: %w", err)
+		}
+		key, err := base64.StdEncoding.DecodeString(w.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wrapped key: %w", err)
+		}
+		return aesGCMOpen(wrapKey, nonce, key, nil)
+	}
+	return nil, fmt.Errorf("not encrypted to this clone's identity (%s); ask a member to run 'vanity encrypt add'", self.ID())
+}
+
+// deriveWrapKey runs X25519 and HKDF-SHA256 (RFC 5869) over the shared
+// secret. As in age, the salt is the ephemeral public key followed by the
+// recipient's, so each wrap uses a distinct key that is bound to the recipient
+// it was made for. The legacy format salted with the ephemeral key alone.
+func deriveWrapKey(private *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey, format int) ([]byte, error) {
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	salt := append([]byte(nil), ephemeral.Bytes()...)
+	if format != legacyFormatMarker {
+		salt = append(salt, recipient.Bytes()...)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(shared)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(recipientWrapInfo))
+	expand.Write([]byte{1})
+	return expand.Sum(nil), nil
+}
+
+func aesGCMSeal(key, plaintext, additional []byte) ([]byte, []byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := cryptorand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additional), nil
+}
+
+func aesGCMOpen(key, nonce, ciphertext, additional []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(nonce))
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, fmt.Errorf("wrong key or tampered file")
+	}
+	return plaintext, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// groupKeyCheck identifies a group key without revealing it
+func groupKeyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encryptionCheckInput))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// localGroupKey returns this clone's group key, checked against the repo
+func localGroupKey(settings *EncryptionSettings) ([]byte, error) {
+	value, err := config.Get(localGroupKeyKey)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, fmt.Errorf("this repository is encrypted with a group key; get it from a collaborator and run 'vanity encrypt join --key <key>'")
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid %s (want 64 hex characters)", localGroupKeyKey)
+	}
+	if groupKeyCheck(key) != settings.Check {
+		return nil, fmt.Errorf("%s does not match the key this repository is encrypted with", localGroupKeyKey)
+	}
+	return key, nil
+}
+
+// localIdentity returns this clone's X25519 private key, or nil if it has none
+func localIdentity() (*ecdh.PrivateKey, error) {
+	value, err := config.Get(localIdentityKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", localIdentityKey, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", localIdentityKey, err)
+	}
+	return key, nil
+}
+
+// Identity returns this clone's recipient, creating its X25519 identity on
+// first use. The private key stays in local config.
+func Identity() (Recipient, error) {
+	identity, err := localIdentity()
+	if err != nil {
+		return Recipient{}, err
+	}
+	if identity == nil {
+		if identity, err = ecdh.X25519().GenerateKey(cryptorand.Reader); err != nil {
+			return Recipient{}, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(identity.Bytes())
+		if err := config.Set(localIdentityKey, encoded); err != nil {
+			return Recipient{}, err
+		}
+	}
+	return Recipient{Key: identity.PublicKey()}, nil
+}
+
+// EnableGroupEncryption encrypts every .vanity file with a new group key and
+// commits the result. It returns the key, which collaborators need to join.
+func EnableGroupEncryption() (string, error) {
+	key := make([]byte, 32)
+	if _, err := cryptorand.Read(key); err != nil {
+		return "", err
+	}
+	keyHex := hex.EncodeToString(key)
+
+	err := reencryptAll(&EncryptionSettings{Mode: EncryptGroup, Check: groupKeyCheck(key)}, func() error {
+		return config.Set(localGroupKeyKey, keyHex)
+	}, "vanity: encrypt contribution data")
+	if err != nil {
+		return "", err
+	}
+	return keyHex, nil
+}
+
+// JoinGroupEncryption stores the group key of an already encrypted repo
+func JoinGroupEncryption(keyHex string) error {
+	settings, err := LoadEncryptionSettings()
+	if err != nil {
+		return err
+	}
+	if settings == nil || settings.Mode != EncryptGroup {
+		return fmt.Errorf("this repository is not encrypted with a group key")
+	}
+	key, err := hex.DecodeString(keyHex)
+	if err != nil || len(key) != 32 {
+		return fmt.Errorf("invalid group key (want 64 hex characters)")
+	}
+	if groupKeyCheck(key) != settings.Check {
+		return fmt.Errorf("that key does not match the key this repository is encrypted with")
+	}
+	return config.Set(localGroupKeyKey, keyHex)
+}
+
+// EnableRecipientEncryption encrypts every .vanity file to this clone's
+// identity and commits the result. Others are added with AddRecipient.
+func EnableRecipientEncryption(label string) error {
+	self, err := Identity()
+	if err != nil {
+		return err
+	}
+	self.Label = label
+	return reencryptAll(&EncryptionSettings{Mode: EncryptX25519, Recipients: []Recipient{self}}, nil,
+		"vanity: encrypt contribution data")
+}
+
+// AddRecipient re-encrypts every .vanity file so r can read it too
+func AddRecipient(r Recipient) error {
+	settings, err := recipientSettings()
+	if err != nil {
+		return err
+	}
+	for _, existing := range settings.Recipients {
+		if existing.ID() == r.ID() {
+			return fmt.Errorf("%s is already a recipient", r.ID())
+		}
+	}
+	updated := *settings
+	updated.Recipients = append(append([]Recipient(nil), settings.Recipients...), r)
+	return reencryptAll(&updated, nil, "vanity: add encryption recipient")
+}
+
+// RemoveRecipient re-encrypts every .vanity file without the recipient whose
+// label or ID matches. Copies the recipient already has stay readable to them.
+func RemoveRecipient(match string) error {
+	settings, err := recipientSettings()
+	if err != nil {
+		return err
+	}
+	updated := *settings
+	updated.Recipients = nil
+	for _, r := range settings.Recipients {
+		if r.ID() != match && r.Label != match {
+			updated.Recipients = append(updated.Recipients, r)
+		}
+	}
+	if len(updated.Recipients) == len(settings.Recipients) {
+		return fmt.Errorf("no recipient matches %q", match)
+	}
+	if len(updated.Recipients) == 0 {
+		return fmt.Errorf("cannot remove the last recipient")
+	}
+	return reencryptAll(&updated, nil, "vanity: remove encryption recipient")
+}
+
+func recipientSettings() (*EncryptionSettings, error) {
+	settings, err := LoadEncryptionSettings()
+	if err != nil {
+		return nil, err
+	}
+	if settings == nil || settings.Mode != EncryptX25519 {
+		return nil, fmt.Errorf("this repository is not encrypted to X25519 recipients")
+	}
+	return settings, nil
+}
+
+// isEncryptedVanityFile reports whether the .vanity file at path is encrypted
+// in an encrypted repo: contribution and state files, the sources manifest
+// and the departures list. Settings, keys and encryption settings stay plain.
+func isEncryptedVanityFile(path string) bool {
+	path = filepath.Clean(path)
+	return strings.HasSuffix(path, ".json") || path == sourcesPath || path == departuresPath
+}
+
+// reencryptAll reads every .vanity file with the current settings, switches to
+// the new ones (running before in between, to install any local key), writes
+// every file again and commits the change
+func reencryptAll(settings *EncryptionSettings, before func() error, message string) error {
+	plaintexts := make(map[string][]byte)
+	err := filepath.WalkDir(vanityDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isEncryptedVanityFile(path) {
+			return err
+		}
+		data, err := readVanityFile(path)
+		if err != nil {
+			return err
+		}
+		plaintexts[path] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if before != nil {
+		if err := before(); err != nil {
+			return err
+		}
+	}
+	if err := settings.save(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", encryptionPath(), err)
+	}
+	for path, data := range plaintexts {
+		if err := writeVanityFile(path, data); err != nil {
+			return err
+		}
+	}
+
+	if err := git.Add("-A", vanityDir); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", vanityDir, err)
+	}
+	if git.HasUncommittedChanges() {
+		if err := git.Commit(message); err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"crypto/ecdh"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/config"
+)
+
+func TestGroupEncryptionRoundTrip(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[{"date":"2024-01-01","count":7}]}`)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			key, err := EnableGroupEncryption()
+			if err != nil {
+				t.Fatalf("EnableGroupEncryption() error = %v", err)
+			}
+
+			raw, _ := os.ReadFile(filepath.Join(vanityDir, "alice.json"))
+			if strings.Contains(string(raw), "alice") || strings.Contains(string(raw), "2024-01-01") {
+				t.Errorf("encrypted file still holds plaintext:\n%s", raw)
+			}
+			data, err := LoadContributionData("alice")
+			if err != nil || len(data.Contributions) != 1 || data.Contributions[0].Count != 7 {
+				t.Fatalf("LoadContributionData() = %+v, %v", data, err)
+			}
+
+			// Without the key, nothing can be read or written.
+			if err := config.Unset(localGroupKeyKey, ""); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadContributionData("alice"); err == nil || !strings.Contains(err.Error(), "vanity encrypt join") {
+				t.Errorf("LoadContributionData() without the key error = %v", err)
+			}
+			if err := SaveSyncState(&SyncState{Username: "alice"}); err == nil {
+				t.Error("SaveSyncState() wrote a file without the key")
+			}
+
+			if err := JoinGroupEncryption(strings.Repeat("00", 32)); err == nil {
+				t.Error("JoinGroupEncryption() accepted the wrong key")
+			}
+			if err := JoinGroupEncryption(key); err != nil {
+				t.Fatalf("JoinGroupEncryption() error = %v", err)
+			}
+			if _, err := LoadContributionData("alice"); err != nil {
+				t.Errorf("LoadContributionData() after joining error = %v", err)
+			}
+		})
+		if out := runGit(t, repo, "status", "--porcelain"); out != "" {
+			t.Errorf("encryption left uncommitted changes:\n%s", out)
+		}
+	})
+}
+
+func TestEncryptedFilesCannotBeSwapped(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[]}`)
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			if _, err := EnableGroupEncryption(); err != nil {
+				t.Fatalf("EnableGroupEncryption() error = %v", err)
+			}
+		})
+		bob, _ := os.ReadFile(filepath.Join(vanityDir, "bob.json"))
+		writeTestFile(t, repo, ".vanity/alice.json", string(bob))
+		if _, err := LoadContributionData("alice"); err == nil {
+			t.Error("bob's ciphertext decrypted as alice's file")
+		}
+	})
+}
+
+func TestRecipientEncryption(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[{"date":"2024-01-01","count":3}]}`)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+
+	bobKey, err := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := Recipient{Key: bobKey.PublicKey(), Label: "bob"}
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			if err := EnableRecipientEncryption("alice"); err != nil {
+				t.Fatalf("EnableRecipientEncryption() error = %v", err)
+			}
+			aliceIdentity, _ := config.Get(localIdentityKey)
+
+			// Become bob: not yet a recipient, so the file cannot be read.
+			if err := config.Set(localIdentityKey, base64.StdEncoding.EncodeToString(bobKey.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadContributionData("alice"); err == nil || !strings.Contains(err.Error(), "not encrypted to this clone") {
+				t.Errorf("LoadContributionData() as a non-recipient error = %v", err)
+			}
+
+			// Alice adds bob, after which he can read it.
+			if err := config.Set(localIdentityKey, aliceIdentity); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddRecipient(bob); err != nil {
+				t.Fatalf("AddRecipient() error = %v", err)
+			}
+			if err := config.Set(localIdentityKey, base64.StdEncoding.EncodeToString(bobKey.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			data, err := LoadContributionData("alice")
+			if err != nil || len(data.Contributions) != 1 {
+				t.Fatalf("LoadContributionData() as bob = %+v, %v", data, err)
+			}
+
+			if err := RemoveRecipient("alice"); err != nil {
+				t.Fatalf("RemoveRecipient() error = %v", err)
+			}
+			if err := RemoveRecipient("bob"); err == nil {
+				t.Error("RemoveRecipient() removed the last recipient")
+			}
+		})
+	})
+}
+
+func TestEncryptedRepoRefusesPlaintextFiles(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[]}`)
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			if _, err := EnableGroupEncryption(); err != nil {
+				t.Fatalf("EnableGroupEncryption() error = %v", err)
+			}
+		})
+		writeTestFile(t, repo, ".vanity/mallory.json", `{"username":"mallory","contributions":[{"date":"2024-01-01","count":50}]}`)
+		if _, err := LoadContributionData("mallory"); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+			t.Fatalf("LoadContributionData() of a plaintext file error = %v, want it refused", err)
+		}
+	})
+}
+
+func TestEncryptionCoversSourcesAndDepartures(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/sources", "[source \"bob\"]\n\tmethod = api\n")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			if _, err := EnableGroupEncryption(); err != nil {
+				t.Fatalf("EnableGroupEncryption() error = %v", err)
+			}
+		})
+		if err := RecordSource(Source{Name: "carol", Method: SourceScrape}); err != nil {
+			t.Fatalf("RecordSource() error = %v", err)
+		}
+		if err := recordDeparture(Departure{Name: "dave", At: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}); err != nil {
+			t.Fatalf("recordDeparture() error = %v", err)
+		}
+		for path, name := range map[string]string{sourcesPath: "bob", departuresPath: "dave"} {
+			if raw, _ := os.ReadFile(path); strings.Contains(string(raw), name) {
+				t.Errorf("%s still holds plaintext:\n%s", path, raw)
+			}
+		}
+
+		sources, err := LoadSources()
+		if err != nil || len(sources) != 2 || sources[0].Name != "bob" || sources[1].Name != "carol" {
+			t.Errorf("LoadSources() = %+v, %v", sources, err)
+		}
+		if err := RemoveSource("bob"); err != nil {
+			t.Fatalf("RemoveSource() error = %v", err)
+		}
+		if found, err := hasManifestEntry("bob"); err != nil || found {
+			t.Errorf("hasManifestEntry(bob) after removal = %v, %v", found, err)
+		}
+		if departures, err := LoadDepartures(); err != nil || len(departures) != 1 || departures[0].Name != "dave" {
+			t.Errorf("LoadDepartures() = %+v, %v", departures, err)
+		}
+
+		writeTestFile(t, repo, ".vanity/departures", "[departure \"mallory\"]\n\tat = 2024-01-01T00:00:00Z\n")
+		if _, err := LoadDepartures(); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+			t.Errorf("LoadDepartures() of a plaintext file error = %v, want it refused", err)
+		}
+	})
+}
+
+func TestWrapKeyIsBoundToRecipient(t *testing.T) {
+	ephemeral, _ := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	alice, _ := ecdh.X25519().GenerateKey(cryptorand.Reader)
+	other, _ := ecdh.X25519().GenerateKey(cryptorand.Reader)
+
+	key, err := deriveWrapKey(ephemeral, alice.PublicKey(), ephemeral.PublicKey(), alice.PublicKey(), encryptedFormatMarker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, _ := deriveWrapKey(alice, ephemeral.PublicKey(), ephemeral.PublicKey(), alice.PublicKey(), encryptedFormatMarker)
+	if string(key) != string(unwrapped) {
+		t.Fatal("the recipient derived a different wrap key")
+	}
+	mislabelled, _ := deriveWrapKey(ephemeral, alice.PublicKey(), ephemeral.PublicKey(), other.PublicKey(), encryptedFormatMarker)
+	if string(key) == string(mislabelled) {
+		t.Error("the wrap key does not depend on the recipient's public key")
+	}
+	legacy, _ := deriveWrapKey(alice, ephemeral.PublicKey(), ephemeral.PublicKey(), alice.PublicKey(), legacyFormatMarker)
+	if string(key) == string(legacy) {
+		t.Error("the legacy format derived the current format's wrap key")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/wdm0006/vanity/internal/config"
 	"github.com/wdm0006/vanity/internal/git"
 	"github.com/wdm0006/vanity/internal/github"
 )
@@ -16,11 +17,45 @@ import (
 // maxReportedTrackedPaths caps how many offending paths a rebuild refusal lists.
 const maxReportedTrackedPaths = 10
 
+// maxPushAttempts bounds how many times a rejected push is retried after pulling
+// the remote changes that caused the rejection.
+const maxPushAttempts = 5
+
+// rebuildBranch is the orphan branch a rebuild builds the new history on
+const rebuildBranch = "temp-rebuild"
+
+// pushRetryDelay is the base backoff between push attempts; it grows linearly
+// with each attempt so concurrent runs stop colliding.
+var pushRetryDelay = 2 * time.Second
+
 // Engine handles the sync process
 type Engine struct {
-	username  string
-	batchSize int
-	rebuild   bool
+	username      string
+	batchSize     int
+	rebuild       bool
+	integration   IntegrationStrategy
+	timestamps    TimestampStrategy
+	location      *time.Location
+	timestampSeed int64
+	author        git.Identity
+	aggregation   AggregationMode
+	scales        map[string]float64
+	maxTargets    map[string]map[string]int // planned per run in max mode
+	naming        *Naming                   // nil stores accounts under their logins
+	maxDayCommits int                       // per source and day; 0 is unlimited
+	maxRunCommits int                       // 0 is unlimited
+	runCommits    int                       // mirror commits planned or created this run
+	toolVersion   string
+	refresh       bool
+	refreshAge    time.Duration // sources updated more recently are not refreshed
+	remote        string        // empty uses the current branch's upstream
+	branch        string        // on remote; empty is the current branch's name
+	keepSnapshots int           // 0 keeps every snapshot
+
+	filterDefaults *MirrorFilter // from the sync settings, by login
+
+	exportPolicy    *ExportPolicy
+	exportPolicySet bool
 }
 
 // Option configures the sync engine
@@ -40,6 +75,102 @@ func WithRebuild(rebuild bool) Option {
 	}
 }
 
+// WithIntegration sets how remote changes are integrated before syncing
+func WithIntegration(strategy IntegrationStrategy) Option {
+	return func(e *Engine) {
+		e.integration = strategy
+	}
+}
+
+// WithTimestamps sets how mirror commits are placed within their day
+func WithTimestamps(strategy TimestampStrategy) Option {
+	return func(e *Engine) {
+		e.timestamps = strategy
+	}
+}
+
+// WithTimezone sets the timezone whose calendar days mirror commits land in
+func WithTimezone(loc *time.Location) Option {
+	return func(e *Engine) {
+		e.location = loc
+	}
+}
+
+// WithTimestampSeed seeds the jitter timestamp strategy
+func WithTimestampSeed(seed int64) Option {
+	return func(e *Engine) {
+		e.timestampSeed = seed
+	}
+}
+
+// WithAggregation sets how sources' contributions combine with yours, with a
+// per-source multiplier for the scaled mode
+func WithAggregation(mode AggregationMode, scales map[string]float64) Option {
+	return func(e *Engine) {
+		e.aggregation = mode
+		e.scales = scales
+	}
+}
+
+// WithExportPolicy replaces the export policy recorded in your contribution
+// file; nil removes it. Without this option the recorded policy is kept.
+func WithExportPolicy(policy *ExportPolicy) Option {
+	return func(e *Engine) {
+		e.exportPolicy = policy
+		e.exportPolicySet = true
+	}
+}
+
+// WithCommitLimits sets the most mirror commits a source may ask for on one
+// day, and the most a single run creates; 0 disables a limit
+func WithCommitLimits(perDay, perRun int) Option {
+	return func(e *Engine) {
+		e.maxDayCommits = perDay
+		e.maxRunCommits = perRun
+	}
+}
+
+// WithToolVersion sets the vanity version recorded in your file's provenance
+func WithToolVersion(version string) Option {
+	return func(e *Engine) {
+		e.toolVersion = version
+	}
+}
+
+// WithRefresh re-imports the sources in .vanity/sources last updated more
+// than maxAge ago before mirroring
+func WithRefresh(maxAge time.Duration) Option {
+	return func(e *Engine) {
+		e.refresh = true
+		e.refreshAge = maxAge
+	}
+}
+
+// WithRemote pulls from and pushes to branch on remote instead of the current
+// branch's upstream. An empty remote keeps the upstream; an empty branch uses
+// the current branch's name.
+func WithRemote(remote, branch string) Option {
+	return func(e *Engine) {
+		e.remote = remote
+		e.branch = branch
+	}
+}
+
+// WithSnapshots sets how many snapshots of the branch are kept; 0 keeps them
+// all
+func WithSnapshots(keep int) Option {
+	return func(e *Engine) {
+		e.keepSnapshots = keep
+	}
+}
+
+// WithFilterDefaults adds filters from the sync settings to the account's own
+func WithFilterDefaults(filters *MirrorFilter) Option {
+	return func(e *Engine) {
+		e.filterDefaults = filters
+	}
+}
+
 // NewEngine creates a new sync engine
 func NewEngine(opts ...Option) (*Engine, error) {
 	// Check prerequisites
@@ -56,9 +187,27 @@ func NewEngine(opts ...Option) (*Engine, error) {
 		return nil, fmt.Errorf("failed to get GitHub user: %w", err)
 	}
 
+	account, err := github.GetCurrentAccount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub account details: %w", err)
+	}
+	author, warning := resolveAuthor(account, git.ConfiguredIdentity())
+	if warning != "" {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
 	e := &Engine{
-		username:  username,
-		batchSize: 100,
+		username:    username,
+		author:      author,
+		batchSize:   100,
+		integration: IntegrateRebase,
+		timestamps:  TimestampsSpread,
+		location:    time.Local,
+		aggregation: AggregateSum,
+
+		maxDayCommits: DefaultMaxDayCommits,
+		maxRunCommits: DefaultMaxRunCommits,
+		keepSnapshots: DefaultKeepSnapshots,
 	}
 	for _, opt := range opts {
 		opt(e)
@@ -68,8 +217,32 @@ func NewEngine(opts ...Option) (*Engine, error) {
 }
 
 // Sync performs the full sync process
-func (e *Engine) Sync(dryRun bool) error {
-	fmt.Printf("Syncing as %s...\n\n", e.username)
+func (e *Engine) Sync(dryRun bool) (err error) {
+	fmt.Printf("Syncing as %s...\n", e.username)
+	if e.author.Email != "" {
+		fmt.Printf("Mirror commits are authored as %s <%s>\n", e.author.Name, e.author.Email)
+	}
+	fmt.Println()
+
+	// Overlapping runs in the same clone would interleave commits and state
+	// writes, so everything that mutates the repository happens under a lock.
+	if !dryRun {
+		lock, lockErr := acquireLock(e.username)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer func() {
+			if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}()
+
+		// Clones made before the merge driver existed get it here, so the
+		// pull below can resolve .vanity conflicts.
+		if err := InstallMergeDriver(); err != nil {
+			fmt.Printf("Warning: failed to register merge driver: %v\n", err)
+		}
+	}
 
 	// Step 1: Pull latest changes. Everything below mutates the repository and the
 	// run needs the remote again to push, so a failed pull is a prerequisite
@@ -78,42 +251,134 @@ func (e *Engine) Sync(dryRun bool) error {
 	if git.HasRemote() && !e.rebuild {
 		fmt.Println("Pulling latest changes...")
 		if !dryRun {
-			if err := git.Pull(); err != nil {
+			if err := e.integrateRemote(); err != nil {
 				return fmt.Errorf("git pull failed: %w", err)
 			}
 		}
 	}
 
-	// Step 2: Load current state
-	state, err := LoadSyncState(e.username)
+	// Step 1.5: Snapshot the branch and the state committed on it, so a sync or
+	// rebuild that goes wrong can be undone with 'vanity undo'
+	if !dryRun {
+		if err := e.recordSnapshot(time.Now()); err != nil {
+			return fmt.Errorf("failed to record snapshot: %w", err)
+		}
+	}
+
+	// Step 2: Load current state, under the names this repo stores accounts by
+	if err := e.loadNaming(); err != nil {
+		return err
+	}
+	state, err := LoadSyncState(e.self())
 	if err != nil {
 		return fmt.Errorf("failed to load sync state: %w", err)
 	}
+	state.SetFilterDefaults(e.filterDefaults, e.naming)
 
-	// Step 3: Fetch own contributions
-	fmt.Println("Fetching your contributions from GitHub...")
-	contributions, err := github.FetchContributions(e.username, state.LastSync)
+	// Step 2.5: Honour accounts that left the group. Rewriting their mirror
+	// commits out of history means the push below has to force.
+	rewritten, err := e.applyDepartures(state, dryRun)
 	if err != nil {
-		return fmt.Errorf("failed to fetch contributions: %w", err)
+		return err
 	}
-	fmt.Printf("  Found %d contribution days\n", len(contributions))
 
-	// Step 4: Update own contribution data
-	contribData, err := LoadContributionData(e.username)
+	// Step 3: Fetch own contributions. With an export policy or excluded
+	// repositories in place (or just removed) the calendar is refetched, so every
+	// exported day is computed from raw counts rather than from counts that were
+	// already transformed. Setting, changing or removing a policy, or changing
+	// the excluded repositories, refetches your whole history and replaces what
+	// was stored, so no day keeps exact counts or the old policy's numbers. So
+	// does an unsigned file of yours, whose days may not be what you exported.
+	contribData, untrusted, err := loadOwnContribution(e.self())
 	if err != nil {
 		return fmt.Errorf("failed to load contribution data: %w", err)
 	}
+	if untrusted {
+		fmt.Printf("Warning: your %s.json is unsigned although you have signing keys; its days will be refetched rather than trusted\n", e.self())
+	}
+	policy := contribData.ExportPolicy
+	if e.exportPolicySet {
+		policy = e.exportPolicy
+	}
+	excludedRepos, err := ExcludedRepos()
+	if err != nil {
+		return fmt.Errorf("failed to read excluded repositories: %w", err)
+	}
+	refetch, err := config.Get(excludeRefetchKey)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", excludeRefetchKey, err)
+	}
+	since := state.LastSync
+	if policy != nil || contribData.ExportPolicy != nil || len(excludedRepos) > 0 || refetch != "" {
+		since = time.Time{}
+	}
+	wholeHistory := policy.String() != contribData.ExportPolicy.String() || refetch != "" || untrusted
+
+	var contributions []github.Contribution
+	var private bool
+	if wholeHistory {
+		fmt.Println("Fetching your whole contribution history from GitHub...")
+		contributions, private, err = github.FetchAllContributions(e.username)
+		contribData.Contributions = nil
+	} else {
+		fmt.Println("Fetching your contributions from GitHub...")
+		contributions, private, err = github.FetchContributions(e.username, since)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch contributions: %w", err)
+	}
+	fmt.Printf("  Found %d contribution days\n", len(contributions))
+	recordOwnCounts(state, contributions)
+
+	// Step 4: Update own contribution data. Excluded repositories are subtracted
+	// from the raw counts, before any export policy sees them.
+	if len(excludedRepos) > 0 {
+		if contributions, err = e.excludeRepositories(contributions, excludedRepos, time.Now()); err != nil {
+			return err
+		}
+	}
+	if policy != nil {
+		seed, err := exportNoiseSeed(policy)
+		if err != nil {
+			return err
+		}
+		contributions = applyExportPolicy(policy, contributions, seed, time.Now())
+		fmt.Printf("  Applied export policy %s\n", policy)
+	}
 
 	// Merge new contributions
 	contribData = e.mergeContributions(contribData, contributions)
 	contribData.LastUpdated = time.Now()
+	contribData.ExportPolicy = policy
+	contribData.Provenance = e.syncProvenance(contribData.Provenance, contributions, private, contribData.LastUpdated)
 
 	if !dryRun {
+		// Sign the file, so collaborators can tell it was written by you
+		key, err := ensureSigningKey(e.self())
+		if err != nil {
+			return fmt.Errorf("failed to load signing key: %w", err)
+		}
+		if err := signContribution(contribData, e.self(), key); err != nil {
+			return fmt.Errorf("failed to sign contribution data: %w", err)
+		}
 		if err := SaveContributionData(contribData); err != nil {
 			return fmt.Errorf("failed to save contribution data: %w", err)
 		}
+		if refetch != "" {
+			if err := config.Unset(excludeRefetchKey, ""); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", excludeRefetchKey, err)
+			}
+		}
+	}
+	fmt.Printf("  Updated %s.json with %d total contribution days\n", e.self(), len(contribData.Contributions))
+
+	// Step 4.2: Refresh imported accounts. A source that can't be refreshed is
+	// still mirrored from what is stored.
+	var refreshErr error
+	if e.refresh {
+		fmt.Println()
+		_, refreshErr = e.refreshSources(e.refreshAge, dryRun)
 	}
-	fmt.Printf("  Updated %s.json with %d total contribution days\n", e.username, len(contribData.Contributions))
 
 	// Step 4.5: Rebuild — wipe commit history, keep .vanity/ data
 	if err := e.prepareRebuild(state, dryRun); err != nil {
@@ -149,7 +414,7 @@ func (e *Engine) Sync(dryRun bool) error {
 		if err := git.Add(".vanity/"); err != nil {
 			return fmt.Errorf("failed to stage changes: %w", err)
 		}
-		if err := git.Commit(fmt.Sprintf("vanity: sync %s", e.username)); err != nil {
+		if err := git.Commit(e.selfMessage("vanity: sync %s", "vanity: sync")); err != nil {
 			return fmt.Errorf("failed to commit: %w", err)
 		}
 	}
@@ -157,34 +422,53 @@ func (e *Engine) Sync(dryRun bool) error {
 	// Step 8: Push changes
 	if !dryRun && git.HasRemote() {
 		fmt.Println("Pushing changes...")
-		if e.rebuild {
-			if err := git.ForcePush(); err != nil {
+		if e.rebuild || rewritten {
+			if err := e.forcePushWithLease(); err != nil {
 				return fmt.Errorf("failed to force push: %w", err)
 			}
-		} else if batchCount > 0 {
-			// Already pushed during batching; do a final push for any remaining
-			if err := git.Push(); err != nil {
-				return fmt.Errorf("failed to push: %w", err)
-			}
-		} else {
-			if err := git.Push(); err != nil {
-				return fmt.Errorf("failed to push: %w", err)
-			}
+		} else if err := e.pushWithRetry(); err != nil {
+			return fmt.Errorf("failed to push: %w", err)
 		}
 	}
 
 	// State, commits and pushes above still happen on a partial failure, so the
 	// mirror commits that were created are recorded and the next run resumes from
 	// there. The run itself is not a success: report it and exit non-zero.
-	if mirrorErr != nil {
-		fmt.Printf("\nSync incomplete: %v\n", mirrorErr)
-		return mirrorErr
+	if incomplete := errors.Join(refreshErr, mirrorErr); incomplete != nil {
+		fmt.Printf("\nSync incomplete: %v\n", incomplete)
+		return incomplete
 	}
 
 	fmt.Println("\nSync complete!")
 	return nil
 }
 
+// pushWithRetry pushes the current branch. Another account syncing at the same
+// time makes the push fail non-fast-forward, so a rejected push integrates the
+// remote changes and tries again, up to maxPushAttempts. Any other failure,
+// such as a refused login, is returned at once.
+func (e *Engine) pushWithRetry() error {
+	var pushErr error
+	for attempt := 1; attempt <= maxPushAttempts; attempt++ {
+		if pushErr = e.push(); pushErr == nil {
+			return nil
+		}
+		if !errors.Is(pushErr, git.ErrPushRejected) {
+			return pushErr
+		}
+		if attempt == maxPushAttempts {
+			break
+		}
+
+		fmt.Printf("  Push rejected (attempt %d/%d), pulling remote changes and retrying...\n", attempt, maxPushAttempts)
+		time.Sleep(time.Duration(attempt) * pushRetryDelay)
+		if err := e.integrateRemote(); err != nil {
+			return fmt.Errorf("push rejected (%v) and pulling before retry failed: %w", pushErr, err)
+		}
+	}
+	return fmt.Errorf("push still rejected after %d attempts: %w", maxPushAttempts, pushErr)
+}
+
 // mirrorAllUsers mirrors every stored source account other than the current user.
 // A source that fails is warned about and skipped so the remaining sources are
 // still attempted; the returned error names every source that failed.
@@ -193,8 +477,22 @@ func (e *Engine) mirrorAllUsers(users []string, state *SyncState, dryRun bool, b
 	attempted := 0
 	var failures []error
 
+	if e.aggregation == AggregateMax {
+		if err := e.planMax(users, state); err != nil {
+			return 0, err
+		}
+	}
+
 	for _, user := range users {
-		if user == e.username {
+		if user == e.self() {
+			continue
+		}
+		if e.runLimitReached() {
+			fmt.Printf("\nReached the limit of %d mirror commits per run; the next sync continues from here\n", e.maxRunCommits)
+			break
+		}
+		if state.EffectiveFilters().SkipsSource(user) {
+			fmt.Printf("  Skipping %s (excluded by filter)\n", user)
 			continue
 		}
 		attempted++
@@ -215,6 +513,32 @@ func (e *Engine) mirrorAllUsers(users []string, state *SyncState, dryRun bool, b
 	return totalMirrored, nil
 }
 
+// planMax loads every source up front, since max mode compares their counts
+// day by day before any of them is mirrored.
+func (e *Engine) planMax(users []string, state *SyncState) error {
+	own, err := LoadContributionData(e.self())
+	if err != nil {
+		return fmt.Errorf("failed to load contribution data: %w", err)
+	}
+	sources := make(map[string]*ContributionData)
+	for _, user := range users {
+		if user == e.self() || state.EffectiveFilters().SkipsSource(user) {
+			continue
+		}
+		data, _, err := loadVerifiedContribution(user)
+		if err != nil {
+			// mirrorUser reports the same failure for this source on its own.
+			continue
+		}
+		if data.Consent.Refuses(e.self(), time.Now()) != "" {
+			continue
+		}
+		sources[user] = data
+	}
+	e.maxTargets = planMaxTargets(own, sources, state, time.Now())
+	return nil
+}
+
 // prepareRebuild puts the state into rebuild mode before the mirror loop runs.
 // A dry run only clears the in-memory mirrored counts, so the preview reports the
 // full re-mirror a real rebuild would perform; nothing is persisted because
@@ -273,31 +597,43 @@ func (e *Engine) rebuildHistory(state *SyncState) error {
 	if currentBranch == "" {
 		return fmt.Errorf("cannot rebuild from detached HEAD")
 	}
+	if currentBranch == rebuildBranch {
+		return fmt.Errorf("an earlier rebuild was interrupted on %s; check out your sync branch again, or run 'vanity undo'", rebuildBranch)
+	}
 
 	if err := ensureDedicatedSyncRepo(); err != nil {
 		return err
 	}
 
-	// Read all .vanity/ files into memory
-	vanityFiles := make(map[string][]byte)
-	entries, err := os.ReadDir(vanityDir)
-	if err != nil {
-		return fmt.Errorf("failed to read .vanity/: %w", err)
+	// An interrupted rebuild leaves its orphan branch behind; the history it
+	// was building is redone below.
+	if git.RefExists("refs/heads/" + rebuildBranch) {
+		fmt.Printf("  Removing the %s branch left by an interrupted rebuild\n", rebuildBranch)
+		if err := git.DeleteBranch(rebuildBranch); err != nil {
+			return fmt.Errorf("failed to delete stale %s branch: %w", rebuildBranch, err)
+		}
 	}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+
+	// Read all .vanity/ files into memory, including those in the per-account
+	// and keys directories, exactly as they are on disk
+	vanityFiles := make(map[string][]byte)
+	err = filepath.WalkDir(vanityDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
 		}
-		path := filepath.Join(vanityDir, entry.Name())
 		data, err := os.ReadFile(path)
 		if err != nil {
 			return fmt.Errorf("failed to read %s: %w", path, err)
 		}
-		vanityFiles[entry.Name()] = data
+		vanityFiles[path] = data
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read .vanity/: %w", err)
 	}
 
 	// Create orphan branch
-	if err := git.CheckoutOrphan("temp-rebuild"); err != nil {
+	if err := git.CheckoutOrphan(rebuildBranch); err != nil {
 		return fmt.Errorf("failed to create orphan branch: %w", err)
 	}
 	if err := git.RemoveAllTrackedFiles(); err != nil {
@@ -308,8 +644,10 @@ func (e *Engine) rebuildHistory(state *SyncState) error {
 	if err := os.MkdirAll(vanityDir, 0755); err != nil {
 		return fmt.Errorf("failed to create .vanity/: %w", err)
 	}
-	for name, data := range vanityFiles {
-		path := filepath.Join(vanityDir, name)
+	for path, data := range vanityFiles {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+		}
 		if err := os.WriteFile(path, data, 0644); err != nil {
 			return fmt.Errorf("failed to write %s: %w", path, err)
 		}
@@ -338,7 +676,9 @@ func (e *Engine) rebuildHistory(state *SyncState) error {
 	return nil
 }
 
-// mergeContributions merges new contributions into existing data
+// mergeContributions merges new contributions into existing data. Days whose
+// new count is zero are dropped, which is how an export policy that moves
+// counts between days clears the days it emptied.
 func (e *Engine) mergeContributions(existing *ContributionData, new []github.Contribution) *ContributionData {
 	// Create a map of existing contributions by date
 	byDate := make(map[string]int)
@@ -354,6 +694,9 @@ func (e *Engine) mergeContributions(existing *ContributionData, new []github.Con
 	// Convert back to slice, sorted by date so the JSON stays stable across syncs
 	var contributions []Contribution
 	for date, count := range byDate {
+		if count <= 0 {
+			continue
+		}
 		contributions = append(contributions, Contribution{
 			Date:  date,
 			Count: count,
@@ -363,36 +706,82 @@ func (e *Engine) mergeContributions(existing *ContributionData, new []github.Con
 		return contributions[i].Date < contributions[j].Date
 	})
 
-	return &ContributionData{
-		Username:      existing.Username,
-		LastUpdated:   time.Now(),
-		Contributions: contributions,
+	// Keep every other field of the existing file (export policy and so on)
+	merged := *existing
+	merged.LastUpdated = time.Now()
+	merged.Contributions = contributions
+	return &merged
+}
+
+// commitTimestamps places count new mirror commits on date, after the first
+// ones already mirrored there, using the configured strategy and timezone.
+func (e *Engine) commitTimestamps(date, sourceUser string, first, count int) ([]time.Time, error) {
+	strategy := e.timestamps
+	if strategy == "" {
+		strategy = TimestampsSpread
+	}
+	loc := e.location
+	if loc == nil {
+		loc = time.Local
 	}
+	return strategy.Timestamps(date, sourceUser, first, count, loc, e.timestampSeed)
 }
 
 // mirrorUser creates mirror commits for another user's contributions
 func (e *Engine) mirrorUser(sourceUser string, state *SyncState, dryRun bool, batchCount *int) (int, error) {
-	contribData, err := LoadContributionData(sourceUser)
+	contribData, warning, err := loadVerifiedContribution(sourceUser)
 	if err != nil {
 		return 0, err
 	}
+	if warning != "" {
+		fmt.Printf("  Warning: %s: %s\n", sourceUser, warning)
+	}
+
+	now := time.Now()
+	if reason := contribData.Consent.Refuses(e.self(), now); reason != "" {
+		fmt.Printf("  Skipping %s (%s)\n", sourceUser, reason)
+		return 0, nil
+	}
+	if err := e.checkDayLimit(sourceUser, contribData, state, now); err != nil {
+		return 0, err
+	}
 
+	filters := state.EffectiveFilters()
 	mirrored := 0
 	for _, contrib := range contribData.Contributions {
+		if !filters.Allows(sourceUser, contrib.Date, now) {
+			continue
+		}
+		if e.runLimitReached() {
+			break
+		}
+
 		// Get how many we've already mirrored for this date
 		alreadyMirrored := state.GetMirroredCount(sourceUser, contrib.Date)
 
 		// Calculate how many new commits we need
-		delta := contrib.Count - alreadyMirrored
+		target := e.targetCount(sourceUser, contrib)
+		delta := target - alreadyMirrored
 		if delta <= 0 {
 			continue
 		}
+		// Near the run limit only part of the day is mirrored; the mirrored
+		// count records how far it got.
+		if e.maxRunCommits > 0 && delta > e.maxRunCommits-e.runCommits {
+			delta = e.maxRunCommits - e.runCommits
+			target = alreadyMirrored + delta
+		}
+		e.runCommits += delta
 
 		if dryRun {
 			fmt.Printf("  Would create %d commits for %s from %s (had %d, now %d)\n",
-				delta, contrib.Date, sourceUser, alreadyMirrored, contrib.Count)
+				delta, contrib.Date, sourceUser, alreadyMirrored, target)
 		} else {
-			created, err := git.CreateBackdatedCommits(contrib.Date, delta, sourceUser)
+			timestamps, err := e.commitTimestamps(contrib.Date, sourceUser, state.commitsCreated(sourceUser, contrib.Date), delta)
+			if err != nil {
+				return mirrored, err
+			}
+			created, err := git.CreateBackdatedCommits(timestamps, sourceUser, e.author)
 			if err != nil {
 				// Checkpoint whatever landed in history so a retry mirrors only the
 				// remaining delta instead of duplicating these commits.
@@ -406,7 +795,7 @@ func (e *Engine) mirrorUser(sourceUser string, state *SyncState, dryRun bool, ba
 		}
 
 		// Update the mirrored count to the current total
-		state.SetMirroredCount(sourceUser, contrib.Date, contrib.Count)
+		state.SetMirroredCount(sourceUser, contrib.Date, target)
 		mirrored += delta
 		*batchCount += delta
 
@@ -414,11 +803,11 @@ func (e *Engine) mirrorUser(sourceUser string, state *SyncState, dryRun bool, ba
 		if !dryRun && e.batchSize > 0 && *batchCount >= e.batchSize && git.HasRemote() {
 			fmt.Printf("  Batch pushing (%d commits so far)...\n", *batchCount)
 			if e.rebuild {
-				if err := git.ForcePush(); err != nil {
+				if err := e.forcePushWithLease(); err != nil {
 					return mirrored, fmt.Errorf("batch force push failed: %w", err)
 				}
 			} else {
-				if err := git.Push(); err != nil {
+				if err := e.pushWithRetry(); err != nil {
 					return mirrored, fmt.Errorf("batch push failed: %w", err)
 				}
 			}
@@ -436,3 +825,28 @@ func (e *Engine) mirrorUser(sourceUser string, state *SyncState, dryRun bool, ba
 
 	return mirrored, nil
 }
+
+// checkDayLimit refuses a source before anything is mirrored from it if any
+// day it would be mirrored for asks for more commits than the per-day limit
+func (e *Engine) checkDayLimit(sourceUser string, data *ContributionData, state *SyncState, now time.Time) error {
+	if e.maxDayCommits <= 0 {
+		return nil
+	}
+	filters := state.EffectiveFilters()
+	for _, contrib := range data.Contributions {
+		if !filters.Allows(sourceUser, contrib.Date, now) {
+			continue
+		}
+		if target := e.targetCount(sourceUser, contrib); target > e.maxDayCommits {
+			return fmt.Errorf("%s asks for %d mirror commits on %s, above the limit of %d per day (raise it with --max-day-commits if this is real)",
+				contributionPath(sourceUser), target, contrib.Date, e.maxDayCommits)
+		}
+	}
+	return nil
+}
+
+// runLimitReached reports whether this run has created all the mirror commits
+// it may
+func (e *Engine) runLimitReached() bool {
+	return e.maxRunCommits > 0 && e.runCommits >= e.maxRunCommits
+}
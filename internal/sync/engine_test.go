@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/wdm0006/vanity/internal/git"
 	"github.com/wdm0006/vanity/internal/github"
 )
 
@@ -521,6 +523,26 @@ func TestRebuildHistoryPreservesOnlyVanityFilesOnCurrentBranch(t *testing.T) {
 	}
 }
 
+func TestRebuildHistoryKeepsNestedVanityFiles(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice/2024.json", `{"username":"alice"}`)
+	writeTestFile(t, repo, ".vanity/keys/alice.pub", "ed25519 key")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob"}`)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+
+	withWorkingDirectory(t, repo, func() {
+		if err := (&Engine{}).rebuildHistory(&SyncState{}); err != nil {
+			t.Fatalf("rebuildHistory() error = %v", err)
+		}
+	})
+
+	files := runGit(t, repo, "ls-tree", "-r", "--name-only", "HEAD")
+	if files != ".vanity/alice/2024.json\n.vanity/bob.json\n.vanity/keys/alice.pub" {
+		t.Fatalf("rebuilt tree files = %q, want the sharded and key files kept", files)
+	}
+}
+
 func TestRebuildHistoryRefusesTrackedFilesOutsideVanity(t *testing.T) {
 	repo := initTestRepo(t, "feature")
 	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice"}`)
@@ -803,3 +825,82 @@ func silenceStderr(t *testing.T) {
 		}
 	})
 }
+
+func TestPushWithRetryIntegratesConcurrentPush(t *testing.T) {
+	remote, alice, bob := initSharedRemote(t)
+
+	// bob syncs first, so alice's push is rejected as non-fast-forward.
+	runGit(t, bob, "commit", "--allow-empty", "-m", "vanity: sync bob")
+	runGit(t, bob, "push")
+	runGit(t, alice, "commit", "--allow-empty", "-m", "vanity: sync alice")
+
+	original := pushRetryDelay
+	pushRetryDelay = 0
+	defer func() { pushRetryDelay = original }()
+
+	var err error
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).pushWithRetry()
+		})
+	})
+	if err != nil {
+		t.Fatalf("pushWithRetry() error = %v", err)
+	}
+
+	subjects := runGit(t, alice, "--git-dir", remote, "log", "--format=%s", "main")
+	want := "vanity: sync alice\nvanity: sync bob\ninitial"
+	if subjects != want {
+		t.Fatalf("remote history = %q, want %q", subjects, want)
+	}
+}
+
+func TestPushWithRetryGivesUpOnOtherFailures(t *testing.T) {
+	_, alice, _ := initSharedRemote(t)
+	runGit(t, alice, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "missing.git"))
+	writeTestFile(t, alice, ".vanity/alice.json", "{}")
+	runGit(t, alice, "add", ".")
+	runGit(t, alice, "commit", "-m", "vanity: sync alice")
+
+	var err error
+	var output string
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		output = captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).pushWithRetry()
+		})
+	})
+	if err == nil {
+		t.Fatal("pushWithRetry() error = nil, want the failed push reported")
+	}
+	if errors.Is(err, git.ErrPushRejected) || strings.Contains(output, "retrying") {
+		t.Fatalf("pushWithRetry() retried a push that was not rejected: err = %v, output = %q", err, output)
+	}
+}
+
+// initSharedRemote creates a bare remote with one initial commit and returns it
+// together with two independent clones, one per syncing account.
+func initSharedRemote(t *testing.T) (remote, alice, bob string) {
+	t.Helper()
+	remote = filepath.Join(t.TempDir(), "remote.git")
+	runGit(t, t.TempDir(), "init", "--bare", "-b", "main", remote)
+
+	seed := initTestRepo(t, "main")
+	writeTestFile(t, seed, ".vanity/.gitkeep", "")
+	runGit(t, seed, "add", ".")
+	runGit(t, seed, "commit", "-m", "initial")
+	runGit(t, seed, "remote", "add", "origin", remote)
+	runGit(t, seed, "push", "-u", "origin", "main")
+
+	return remote, cloneTestRepo(t, remote), cloneTestRepo(t, remote)
+}
+
+func cloneTestRepo(t *testing.T, remote string) string {
+	t.Helper()
+	clone := filepath.Join(t.TempDir(), "clone")
+	runGit(t, t.TempDir(), "clone", remote, clone)
+	runGit(t, clone, "config", "user.name", "Vanity Test")
+	runGit(t, clone, "config", "user.email", "vanity@example.com")
+	return clone
+}
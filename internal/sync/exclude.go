@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// Local settings for repository exclusion. Patterns name repositories, so they
+// stay in the clone's private config and never reach .vanity/.
+const (
+	excludeRepoKey    = "export.excludeRepo"
+	excludeRefetchKey = "export.refetch" // set when exclusions change
+)
+
+// ParseRepoPattern normalizes a repository pattern. "owner/name" names one
+// repository, a bare "owner" every repository of that user or organization,
+// and either part may use shell wildcards ("acme/*-internal"). Matching is
+// case-insensitive, like GitHub names.
+func ParseRepoPattern(pattern string) (string, error) {
+	p := strings.ToLower(strings.TrimSpace(pattern))
+	if p == "" {
+		return "", fmt.Errorf("empty repository pattern")
+	}
+	if !strings.Contains(p, "/") {
+		p += "/*"
+	}
+	if strings.Count(p, "/") != 1 || strings.HasPrefix(p, "/") || strings.HasSuffix(p, "/") {
+		return "", fmt.Errorf("invalid repository pattern %q (want owner or owner/name)", pattern)
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return "", fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+	}
+	return p, nil
+}
+
+// matchesRepoPattern reports whether repo (owner/name) matches any pattern
+func matchesRepoPattern(patterns []string, repo string) bool {
+	repo = strings.ToLower(repo)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludedRepos returns the repository patterns excluded from your exported counts
+func ExcludedRepos() ([]string, error) {
+	return config.GetAll(excludeRepoKey)
+}
+
+// ExcludeRepo adds a pattern to the exclusion list. Adding one that is already
+// listed does nothing; otherwise the next sync re-exports your whole history
+// so the repository's older contributions are removed too.
+func ExcludeRepo(pattern string) (string, error) {
+	p, err := ParseRepoPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	existing, err := ExcludedRepos()
+	if err != nil {
+		return "", err
+	}
+	for _, e := range existing {
+		if e == p {
+			return p, nil
+		}
+	}
+	if err := config.Add(excludeRepoKey, p); err != nil {
+		return "", err
+	}
+	return p, config.Set(excludeRefetchKey, "true")
+}
+
+// IncludeRepo removes a pattern from the exclusion list. The next sync
+// re-exports your whole history so the repository's contributions count again.
+func IncludeRepo(pattern string) (string, error) {
+	p, err := ParseRepoPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Unset(excludeRepoKey, p); err != nil {
+		return "", err
+	}
+	return p, config.Set(excludeRefetchKey, "true")
+}
+
+// subtractRepositories removes the contributions made to excluded repositories
+// from the calendar counts. Days that drop to zero are kept with a zero count,
+// so merging them replaces what was stored before. It returns the new counts
+// and how many contributions were removed.
+func subtractRepositories(calendar []github.Contribution, perRepo []github.RepositoryContribution, patterns []string) ([]github.Contribution, int) {
+	excluded := make(map[string]int)
+	for _, c := range perRepo {
+		if matchesRepoPattern(patterns, c.Repository) {
+			excluded[c.Date] += c.Count
+		}
+	}
+
+	removed := 0
+	out := make([]github.Contribution, len(calendar))
+	for i, c := range calendar {
+		n := min(c.Count, excluded[c.Date])
+		removed += n
+		out[i] = github.Contribution{Date: c.Date, Count: c.Count - n}
+	}
+	return out, removed
+}
+
+// excludeRepositories fetches the per-repository breakdown of the days in
+// calendar and subtracts the excluded repositories' share
+func (e *Engine) excludeRepositories(calendar []github.Contribution, patterns []string, now time.Time) ([]github.Contribution, error) {
+	if len(calendar) == 0 {
+		return calendar, nil
+	}
+
+	from := now
+	for _, c := range calendar {
+		if day, err := time.Parse("2006-01-02", c.Date); err == nil && day.Before(from) {
+			from = day
+		}
+	}
+
+	perRepo, err := github.FetchRepositoryContributions(e.username, from, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch per-repository contributions: %w", err)
+	}
+
+	result, removed := subtractRepositories(calendar, perRepo, patterns)
+	fmt.Printf("  Excluded %d contributions matching %d repository pattern(s)\n", removed, len(patterns))
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+func TestParseRepoPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr string
+	}{
+		{pattern: "acme", want: "acme/*"},
+		{pattern: " Acme/Secret ", want: "acme/secret"},
+		{pattern: "acme-labs/*-internal", want: "acme-labs/*-internal"},
+		{pattern: "", wantErr: "empty"},
+		{pattern: "acme/", wantErr: "want owner or owner/name"},
+		{pattern: "a/b/c", wantErr: "want owner or owner/name"},
+		{pattern: "acme/[", wantErr: "syntax error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := ParseRepoPattern(tt.pattern)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRepoPattern(%q) error = %v, want %q", tt.pattern, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseRepoPattern(%q) = %q, %v; want %q", tt.pattern, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubtractRepositories(t *testing.T) {
+	calendar := []github.Contribution{
+		{Date: "2024-01-01", Count: 5},
+		{Date: "2024-01-02", Count: 2},
+		{Date: "2024-01-03", Count: 1},
+	}
+	perRepo := []github.RepositoryContribution{
+		{Repository: "Acme/API", Date: "2024-01-01", Count: 3},
+		{Repository: "me/dotfiles", Date: "2024-01-01", Count: 2},
+		{Repository: "acme/web", Date: "2024-01-02", Count: 2},
+		{Repository: "acme/web", Date: "2024-01-03", Count: 4}, // more than the calendar shows
+	}
+
+	got, removed := subtractRepositories(calendar, perRepo, []string{"acme/*"})
+	want := []github.Contribution{
+		{Date: "2024-01-01", Count: 2},
+		{Date: "2024-01-02", Count: 0}, // kept so merging clears the stored day
+		{Date: "2024-01-03", Count: 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subtractRepositories() = %v, want %v", got, want)
+	}
+	if removed != 6 {
+		t.Errorf("removed = %d, want 6", removed)
+	}
+}
+
+func TestSyncRefetchesWholeHistoryWhenExclusionsChange(t *testing.T) {
+	repo := initSyncRepo(t, false)
+	ghMarker := stubGitHubCLI(t)
+
+	withWorkingDirectory(t, repo, func() {
+		if _, err := ExcludeRepo("acme/secret"); err != nil {
+			t.Fatalf("ExcludeRepo() error = %v", err)
+		}
+		silenceStderr(t)
+		captureStdout(t, func() {
+			(&Engine{username: "alice", batchSize: 100}).Sync(true)
+		})
+	})
+
+	calls, err := os.ReadFile(ghMarker)
+	if err != nil {
+		t.Fatalf("Sync() never reached the GitHub fetch: %v", err)
+	}
+	if !strings.HasPrefix(string(calls), "api users/alice") {
+		t.Fatalf("gh calls = %q, want the whole history fetched after a new exclusion", calls)
+	}
+}
@@ -0,0 +1,213 @@
+package sync
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// ExportPolicy transforms your own daily counts before they are written to the
+// shared repo. It is recorded in the contribution file, so collaborators can
+// tell the numbers they mirror are not exact. Steps apply in this order:
+// weekly coarsening, noise, bucketing, capping.
+type ExportPolicy struct {
+	Weekly bool `json:"weekly,omitempty"` // spread each week's total evenly over its days
+	Noise  int  `json:"noise,omitempty"`  // add seeded noise of up to ±N per active day
+	Bucket int  `json:"bucket,omitempty"` // report only the range a count falls in
+	Cap    int  `json:"cap,omitempty"`    // never report more than N per day
+}
+
+// ParseExportPolicy parses a comma-separated policy such as
+// "weekly,noise=2,bucket=5,cap=20". "none" or an empty spec means no policy.
+func ParseExportPolicy(spec string) (*ExportPolicy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+
+	policy := &ExportPolicy{}
+	for _, part := range strings.Split(spec, ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "weekly" && !hasValue {
+			policy.Weekly = true
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if !hasValue || err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid export policy step %q (want weekly, noise=N, bucket=N or cap=N with N >= 1)", part)
+		}
+		switch name {
+		case "noise":
+			policy.Noise = n
+		case "bucket":
+			policy.Bucket = n
+		case "cap":
+			policy.Cap = n
+		default:
+			return nil, fmt.Errorf("unknown export policy step %q", name)
+		}
+	}
+	return policy, nil
+}
+
+// String formats the policy in the syntax ParseExportPolicy accepts
+func (p *ExportPolicy) String() string {
+	if p == nil {
+		return "none"
+	}
+	var parts []string
+	if p.Weekly {
+		parts = append(parts, "weekly")
+	}
+	if p.Noise > 0 {
+		parts = append(parts, fmt.Sprintf("noise=%d", p.Noise))
+	}
+	if p.Bucket > 0 {
+		parts = append(parts, fmt.Sprintf("bucket=%d", p.Bucket))
+	}
+	if p.Cap > 0 {
+		parts = append(parts, fmt.Sprintf("cap=%d", p.Cap))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ",")
+}
+
+// Apply transforms raw daily counts. Noise is derived from seed and the date,
+// so the same raw data always exports the same numbers. Weekly coarsening
+// returns every day of each touched week up to today, including days that end
+// up at zero, so merging the result replaces what was stored for those days.
+func (p *ExportPolicy) Apply(contributions []Contribution, seed int64, today time.Time) []Contribution {
+	if p == nil {
+		return contributions
+	}
+
+	out := make([]Contribution, len(contributions))
+	copy(out, contributions)
+	if p.Weekly {
+		out = spreadWeekly(out, today)
+	}
+
+	for i := range out {
+		count := out[i].Count
+		if count <= 0 {
+			continue
+		}
+		if p.Noise > 0 {
+			rng := rand.New(rand.NewSource(int64(sequenceHash(fmt.Sprintf("%d/%s", seed, out[i].Date)))))
+			count = max(1, count+rng.Intn(2*p.Noise+1)-p.Noise)
+		}
+		if p.Bucket > 1 {
+			// Report the bottom of the count's range, keeping active days
+			// visible: 1..N-1 becomes 1, N..2N-1 becomes N, and so on.
+			count = max(1, count/p.Bucket*p.Bucket)
+		}
+		if p.Cap > 0 {
+			count = min(count, p.Cap)
+		}
+		out[i].Count = count
+	}
+	return out
+}
+
+// spreadWeekly replaces each Sunday-to-Saturday week (the weeks of GitHub's
+// calendar) with its total divided evenly over the week's days, never
+// spreading onto days after today.
+func spreadWeekly(contributions []Contribution, today time.Time) []Contribution {
+	lastDay := today.Format("2006-01-02")
+	totals := make(map[string]int) // week start -> total
+	for _, c := range contributions {
+		day, err := time.Parse("2006-01-02", c.Date)
+		if err != nil {
+			continue
+		}
+		weekStart := day.AddDate(0, 0, -int(day.Weekday()))
+		totals[weekStart.Format("2006-01-02")] += c.Count
+	}
+
+	var out []Contribution
+	for start, total := range totals {
+		weekStart, _ := time.Parse("2006-01-02", start)
+		var days []string
+		for i := 0; i < 7; i++ {
+			date := weekStart.AddDate(0, 0, i).Format("2006-01-02")
+			if date > lastDay {
+				break
+			}
+			days = append(days, date)
+		}
+		if len(days) == 0 {
+			continue
+		}
+		for i, date := range days {
+			count := total / len(days)
+			if i < total%len(days) {
+				count++
+			}
+			out = append(out, Contribution{Date: date, Count: count})
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Date < out[j].Date
+	})
+	return out
+}
+
+// applyExportPolicy runs fetched calendar counts through the policy
+func applyExportPolicy(policy *ExportPolicy, fetched []github.Contribution, seed int64, today time.Time) []github.Contribution {
+	raw := make([]Contribution, len(fetched))
+	for i, c := range fetched {
+		raw[i] = Contribution{Date: c.Date, Count: c.Count}
+	}
+
+	transformed := policy.Apply(raw, seed, today)
+	out := make([]github.Contribution, len(transformed))
+	for i, c := range transformed {
+		out[i] = github.Contribution{Date: c.Date, Count: c.Count}
+	}
+	return out
+}
+
+// exportNoiseSeedKey is the local setting holding the noise seed. The seed is
+// never shared: anyone who knew it could subtract the noise again.
+const exportNoiseSeedKey = "export.noiseSeed"
+
+// exportNoiseSeed returns this clone's noise seed, creating one on first use
+func exportNoiseSeed(policy *ExportPolicy) (int64, error) {
+	if policy.Noise == 0 {
+		return 0, nil
+	}
+
+	value, err := config.Get(exportNoiseSeedKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", exportNoiseSeedKey, err)
+	}
+	if value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", exportNoiseSeedKey, value, err)
+		}
+		return seed, nil
+	}
+
+	var buf [8]byte
+	if _, err := cryptorand.Read(buf[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate noise seed: %w", err)
+	}
+	seed := int64(binary.BigEndian.Uint64(buf[:]) >> 1)
+	if err := config.Set(exportNoiseSeedKey, strconv.FormatInt(seed, 10)); err != nil {
+		return 0, fmt.Errorf("failed to save %s: %w", exportNoiseSeedKey, err)
+	}
+	return seed, nil
+}
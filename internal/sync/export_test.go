@@ -0,0 +1,190 @@
+package sync
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+func TestParseExportPolicy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *ExportPolicy
+		wantErr string
+	}{
+		{spec: "", want: nil},
+		{spec: "none", want: nil},
+		{spec: "weekly", want: &ExportPolicy{Weekly: true}},
+		{spec: "weekly, noise=2,bucket=5,cap=20", want: &ExportPolicy{Weekly: true, Noise: 2, Bucket: 5, Cap: 20}},
+		{spec: "cap=0", wantErr: "invalid export policy step"},
+		{spec: "bucket", wantErr: "invalid export policy step"},
+		{spec: "weekly=1", wantErr: "unknown export policy step"},
+		{spec: "round=5", wantErr: "unknown export policy step"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseExportPolicy(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseExportPolicy(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseExportPolicy(%q) error = %v", tt.spec, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseExportPolicy(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			if got != nil {
+				if again, _ := ParseExportPolicy(got.String()); !reflect.DeepEqual(again, got) {
+					t.Errorf("String() %q does not round-trip", got.String())
+				}
+			}
+		})
+	}
+}
+
+func TestExportPolicyBucketAndCap(t *testing.T) {
+	raw := []Contribution{
+		{Date: "2024-01-01", Count: 0},
+		{Date: "2024-01-02", Count: 3},
+		{Date: "2024-01-03", Count: 7},
+		{Date: "2024-01-04", Count: 31},
+	}
+	policy := &ExportPolicy{Bucket: 5, Cap: 20}
+
+	got := policy.Apply(raw, 0, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC))
+	want := []Contribution{
+		{Date: "2024-01-01", Count: 0}, // inactive days stay inactive
+		{Date: "2024-01-02", Count: 1}, // active days stay visible
+		{Date: "2024-01-03", Count: 5},
+		{Date: "2024-01-04", Count: 20}, // bucketed to 30, then capped
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+	if raw[3].Count != 31 {
+		t.Error("Apply() modified its input")
+	}
+}
+
+func TestExportPolicyNoiseIsSeeded(t *testing.T) {
+	raw := make([]Contribution, 60)
+	for i := range raw {
+		raw[i] = Contribution{Date: time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), Count: 2}
+	}
+	policy := &ExportPolicy{Noise: 3}
+	today := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	first := policy.Apply(raw, 42, today)
+	if again := policy.Apply(raw, 42, today); !reflect.DeepEqual(first, again) {
+		t.Error("same seed produced different counts")
+	}
+	if other := policy.Apply(raw, 43, today); reflect.DeepEqual(first, other) {
+		t.Error("different seeds produced the same counts")
+	}
+
+	changed := false
+	for _, c := range first {
+		if c.Count < 1 || c.Count > 5 {
+			t.Errorf("%s: count %d outside [1, 5]", c.Date, c.Count)
+		}
+		if c.Count != 2 {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Error("noise left every count unchanged")
+	}
+}
+
+func TestExportPolicyWeeklySpreadsUpToToday(t *testing.T) {
+	// 2024-01-07 is a Sunday; today is the Wednesday of that week.
+	raw := []Contribution{
+		{Date: "2023-12-31", Count: 9}, // Sunday of the previous week
+		{Date: "2024-01-07", Count: 5},
+		{Date: "2024-01-09", Count: 2},
+	}
+	policy := &ExportPolicy{Weekly: true}
+
+	got := policy.Apply(raw, 0, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC))
+	want := []Contribution{
+		{Date: "2023-12-31", Count: 2},
+		{Date: "2024-01-01", Count: 2},
+		{Date: "2024-01-02", Count: 1},
+		{Date: "2024-01-03", Count: 1},
+		{Date: "2024-01-04", Count: 1},
+		{Date: "2024-01-05", Count: 1},
+		{Date: "2024-01-06", Count: 1},
+		{Date: "2024-01-07", Count: 2},
+		{Date: "2024-01-08", Count: 2},
+		{Date: "2024-01-09", Count: 2},
+		{Date: "2024-01-10", Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+}
+
+func TestMergeContributionsDropsEmptiedDaysAndKeepsPolicy(t *testing.T) {
+	e := &Engine{username: "alice"}
+	existing := &ContributionData{
+		Username:     "alice",
+		ExportPolicy: &ExportPolicy{Weekly: true},
+		Contributions: []Contribution{
+			{Date: "2024-01-01", Count: 4},
+			{Date: "2024-01-02", Count: 1},
+		},
+	}
+
+	merged := e.mergeContributions(existing, []github.Contribution{{Date: "2024-01-01", Count: 0}})
+	want := []Contribution{{Date: "2024-01-02", Count: 1}}
+	if !reflect.DeepEqual(merged.Contributions, want) {
+		t.Errorf("contributions = %v, want %v", merged.Contributions, want)
+	}
+	if merged.ExportPolicy == nil || !merged.ExportPolicy.Weekly {
+		t.Errorf("export policy = %+v, want it kept", merged.ExportPolicy)
+	}
+}
+
+func TestSyncRefetchesWholeHistoryWhenPolicyChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *ExportPolicy
+		wantWhole bool
+	}{
+		{name: "policy set", policy: &ExportPolicy{Bucket: 5}, wantWhole: true},
+		{name: "no policy", policy: nil, wantWhole: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := initSyncRepo(t, false)
+			ghMarker := stubGitHubCLI(t)
+
+			withWorkingDirectory(t, repo, func() {
+				silenceStderr(t)
+				captureStdout(t, func() {
+					e := &Engine{username: "alice", batchSize: 100}
+					WithExportPolicy(tt.policy)(e)
+					e.Sync(true)
+				})
+			})
+
+			calls, err := os.ReadFile(ghMarker)
+			if err != nil {
+				t.Fatalf("Sync() never reached the GitHub fetch: %v", err)
+			}
+			// The whole history is fetched year by year from the account's
+			// creation date; the last year alone is one graphql query.
+			if whole := strings.HasPrefix(string(calls), "api users/alice"); whole != tt.wantWhole {
+				t.Fatalf("gh calls = %q, want whole history fetched = %v", calls, tt.wantWhole)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MirrorFilter selects which stored contributions an account mirrors. It is
+// kept in the account's own sync state, so each account filters independently.
+type MirrorFilter struct {
+	Skip      []string              `json:"skip,omitempty"`       // sources never mirrored
+	Windows   map[string]DateWindow `json:"windows,omitempty"`    // per-source date ranges
+	LastYears int                   `json:"last_years,omitempty"` // only mirror the last N years (0 = all)
+}
+
+// DateWindow is an inclusive range of YYYY-MM-DD dates; an empty bound is open
+type DateWindow struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// Contains reports whether date falls inside the window
+func (w DateWindow) Contains(date string) bool {
+	if w.From != "" && date < w.From {
+		return false
+	}
+	if w.To != "" && date > w.To {
+		return false
+	}
+	return true
+}
+
+// String formats the window for display
+func (w DateWindow) String() string {
+	from, to := w.From, w.To
+	if from == "" {
+		from = "start"
+	}
+	if to == "" {
+		to = "now"
+	}
+	return from + ".." + to
+}
+
+// IsEmpty reports whether the filter lets everything through
+func (f *MirrorFilter) IsEmpty() bool {
+	return f == nil || (len(f.Skip) == 0 && len(f.Windows) == 0 && f.LastYears == 0)
+}
+
+// SkipsSource reports whether a source is excluded entirely
+func (f *MirrorFilter) SkipsSource(source string) bool {
+	if f == nil {
+		return false
+	}
+	for _, s := range f.Skip {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether a source's contributions on date should be mirrored
+func (f *MirrorFilter) Allows(source, date string, now time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.SkipsSource(source) {
+		return false
+	}
+	if window, ok := f.Windows[source]; ok && !window.Contains(date) {
+		return false
+	}
+	if f.LastYears > 0 && date < now.AddDate(-f.LastYears, 0, 0).Format("2006-01-02") {
+		return false
+	}
+	return true
+}
+
+// SetSkipped adds or removes a source from the skip list
+func (f *MirrorFilter) SetSkipped(source string, skipped bool) {
+	var kept []string
+	for _, s := range f.Skip {
+		if s != source {
+			kept = append(kept, s)
+		}
+	}
+	if skipped {
+		kept = append(kept, source)
+		sort.Strings(kept)
+	}
+	f.Skip = kept
+}
+
+// SetWindow limits a source to a date window; an empty window removes the limit
+func (f *MirrorFilter) SetWindow(source string, window DateWindow) error {
+	for _, date := range []string{window.From, window.To} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid date %q (want YYYY-MM-DD)", date)
+		}
+	}
+	if window.From != "" && window.To != "" && window.From > window.To {
+		return fmt.Errorf("window start %s is after its end %s", window.From, window.To)
+	}
+
+	if window == (DateWindow{}) {
+		delete(f.Windows, source)
+		return nil
+	}
+	if f.Windows == nil {
+		f.Windows = make(map[string]DateWindow)
+	}
+	f.Windows[source] = window
+	return nil
+}
+
+// SetFilterDefaults adds the filters from the sync settings, which name
+// accounts by login, to the account's own filters without saving them
+func (s *SyncState) SetFilterDefaults(defaults *MirrorFilter, naming *Naming) {
+	if defaults.IsEmpty() {
+		s.filterDefaults = nil
+		return
+	}
+	named := &MirrorFilter{LastYears: defaults.LastYears}
+	for _, login := range defaults.Skip {
+		named.Skip = append(named.Skip, naming.Name(login))
+	}
+	s.filterDefaults = named
+}
+
+// EffectiveFilters returns the filters mirroring follows: the account's own,
+// plus the sources skipped by the sync settings. The account's own year limit
+// wins over the settings'.
+func (s *SyncState) EffectiveFilters() *MirrorFilter {
+	if s.filterDefaults == nil {
+		return s.Filters
+	}
+	effective := &MirrorFilter{LastYears: s.filterDefaults.LastYears}
+	if s.Filters != nil {
+		*effective = *s.Filters
+		effective.Skip = append([]string(nil), s.Filters.Skip...)
+		if effective.LastYears == 0 {
+			effective.LastYears = s.filterDefaults.LastYears
+		}
+	}
+	for _, source := range s.filterDefaults.Skip {
+		if !effective.SkipsSource(source) {
+			effective.Skip = append(effective.Skip, source)
+		}
+	}
+	return effective
+}
+
+// PendingMirrors splits what is left to mirror from a source into the commits
+// the next sync will create, up to target (see MirrorTargets), and the
+// source's contributions the filter intentionally skips.
+func (s *SyncState) PendingMirrors(source string, data *ContributionData, target func(source string, c Contribution) int, now time.Time) (pending, skipped int) {
+	filters := s.EffectiveFilters()
+	for _, c := range data.Contributions {
+		mirrored := s.GetMirroredCount(source, c.Date)
+		if !filters.Allows(source, c.Date, now) {
+			skipped += max(0, c.Count-mirrored)
+			continue
+		}
+		pending += max(0, target(source, c)-mirrored)
+	}
+	return pending, skipped
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorFilterAllows(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	filter := &MirrorFilter{
+		Skip:      []string{"carol"},
+		Windows:   map[string]DateWindow{"old-work": {To: "2021-06-30"}},
+		LastYears: 5,
+	}
+
+	tests := []struct {
+		source string
+		date   string
+		want   bool
+	}{
+		{"bob", "2024-01-01", true},
+		{"carol", "2024-01-01", false},
+		{"old-work", "2021-06-30", true},
+		{"old-work", "2021-07-01", false},
+		{"bob", "2019-06-01", true},
+		{"bob", "2019-05-31", false},
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(tt.source, tt.date, now); got != tt.want {
+			t.Errorf("Allows(%s, %s) = %v, want %v", tt.source, tt.date, got, tt.want)
+		}
+	}
+
+	var none *MirrorFilter
+	if !none.Allows("bob", "2000-01-01", now) || none.SkipsSource("bob") || !none.IsEmpty() {
+		t.Error("a nil filter must let everything through")
+	}
+}
+
+func TestMirrorFilterSetWindowValidates(t *testing.T) {
+	f := &MirrorFilter{}
+	if err := f.SetWindow("bob", DateWindow{From: "2024-13-01"}); err == nil {
+		t.Error("SetWindow() accepted an invalid date")
+	}
+	if err := f.SetWindow("bob", DateWindow{From: "2024-02-01", To: "2024-01-01"}); err == nil {
+		t.Error("SetWindow() accepted a reversed window")
+	}
+	if err := f.SetWindow("bob", DateWindow{From: "2024-01-01"}); err != nil {
+		t.Fatalf("SetWindow() error = %v", err)
+	}
+	if err := f.SetWindow("bob", DateWindow{}); err != nil || !f.IsEmpty() {
+		t.Errorf("clearing the window left %+v, %v", f, err)
+	}
+}
+
+func TestMirrorUserHonorsFilters(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json",
+		`{"username":"bob","contributions":[{"date":"2020-01-02","count":2},{"date":"2021-03-04","count":1}]}`)
+	writeTestFile(t, repo, ".vanity/carol.json",
+		`{"username":"carol","contributions":[{"date":"2021-03-04","count":4}]}`)
+
+	state := &SyncState{
+		Username: "alice",
+		Filters: &MirrorFilter{
+			Skip:    []string{"carol"},
+			Windows: map[string]DateWindow{"bob": {From: "2021-01-01"}},
+		},
+	}
+	batchCount := 0
+	var mirrored int
+	var err error
+	var output string
+	withWorkingDirectory(t, repo, func() {
+		output = captureStdout(t, func() {
+			mirrored, err = (&Engine{username: "alice"}).mirrorAllUsers([]string{"bob", "carol"}, state, false, &batchCount)
+		})
+	})
+	if err != nil {
+		t.Fatalf("mirrorAllUsers() error = %v", err)
+	}
+	if mirrored != 1 {
+		t.Fatalf("mirrored %d commits, want only bob's 2021-03-04", mirrored)
+	}
+	if !strings.Contains(output, "Skipping carol") {
+		t.Errorf("output does not report carol as skipped:\n%s", output)
+	}
+
+	bob := &ContributionData{Contributions: []Contribution{{Date: "2020-01-02", Count: 2}, {Date: "2021-03-04", Count: 1}}}
+	if pending, skipped := state.PendingMirrors("bob", bob, MirrorTargets(AggregateSum, nil, nil, nil, state, time.Now()), time.Now()); pending != 0 || skipped != 2 {
+		t.Errorf("PendingMirrors(bob) = %d pending, %d skipped; want 0 and 2", pending, skipped)
+	}
+}
@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// maxReportedDamagedCommits caps how many commits a damaged-history refusal lists.
+const maxReportedDamagedCommits = 5
+
+// IntegrationStrategy selects how remote changes are combined with local commits
+type IntegrationStrategy string
+
+const (
+	// IntegrateRebase replays local commits onto the remote, keeping each
+	// commit's committer date equal to its author date
+	IntegrateRebase IntegrationStrategy = "rebase"
+	// IntegrateMerge merges the remote in and never rewrites local commits
+	IntegrateMerge IntegrationStrategy = "merge"
+)
+
+// ParseIntegrationStrategy validates a strategy name from the command line
+func ParseIntegrationStrategy(name string) (IntegrationStrategy, error) {
+	switch s := IntegrationStrategy(name); s {
+	case IntegrateRebase, IntegrateMerge:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown integration strategy %q (want %s or %s)", name, IntegrateRebase, IntegrateMerge)
+}
+
+// integrateRemote brings in what other accounts pushed. A plain `git pull
+// --rebase` would stamp unpushed mirror commits with today's committer date, so
+// the configured strategy either rebases with dates preserved or merges.
+// When history was rewritten, on the remote or by an unpushed local rewrite,
+// the branch is reset to the remote instead; see adoptUpstream.
+func (e *Engine) integrateRemote() error {
+	previous := ""
+	if upstream := e.upstream(); upstream != "" {
+		previous, _ = git.ResolveRef(upstream)
+	}
+	if err := e.fetch(); err != nil {
+		return fmt.Errorf("fetch failed: %w", err)
+	}
+
+	upstream := e.upstream()
+	if upstream == "" {
+		// Nothing to integrate with; the branch has never been pushed.
+		return nil
+	}
+
+	if previous != "" {
+		current, err := git.ResolveRef(upstream)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !git.IsAncestor(previous, current):
+			return e.adoptUpstream(upstream, "was rewritten by another clone")
+		case !git.IsAncestor(previous, "HEAD"):
+			return e.adoptUpstream(upstream, "was not replaced by this clone's rewritten history, whose push failed")
+		}
+	}
+
+	if err := ensureMirrorDatesIntact("HEAD", upstream); err != nil {
+		return err
+	}
+
+	switch e.integration {
+	case IntegrateMerge:
+		if err := git.Merge(upstream); err != nil {
+			return fmt.Errorf("merge with %s failed: %w", upstream, err)
+		}
+	default:
+		if err := git.RebasePreservingDates(upstream); err != nil {
+			return fmt.Errorf("rebase onto %s failed: %w", upstream, err)
+		}
+	}
+	return nil
+}
+
+// adoptUpstream resets the branch to upstream after a history rewrite, which
+// is how removing a source, a departure or a rebuild reaches other clones.
+// Rebasing across a rewrite would replay every commit it dropped. Commits not
+// yet pushed are discarded along with the state they recorded, so the next
+// sync redoes them; a snapshot keeps them for 'vanity restore'.
+func (e *Engine) adoptUpstream(upstream, why string) error {
+	if git.HasUncommittedChanges() {
+		return fmt.Errorf("%s %s, but the working tree has uncommitted changes; commit or stash them first", upstream, why)
+	}
+	if err := e.recordSnapshot(time.Now()); err != nil {
+		return fmt.Errorf("failed to record snapshot: %w", err)
+	}
+	fmt.Printf("  %s %s; resetting to it (the old branch is kept as a snapshot)\n", upstream, why)
+	if err := git.ResetHard(upstream); err != nil {
+		return fmt.Errorf("failed to reset to %s: %w", upstream, err)
+	}
+	return nil
+}
+
+// remoteBranch is the branch sync pushes to on e.remote
+func (e *Engine) remoteBranch() (string, error) {
+	if e.branch != "" {
+		return e.branch, nil
+	}
+	branch, err := git.GetCurrentBranch()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	if branch == "" {
+		return "", fmt.Errorf("HEAD is detached; set sync.branch to push to %s", e.remote)
+	}
+	return branch, nil
+}
+
+// fetch downloads the remote sync pulls from
+func (e *Engine) fetch() error {
+	if e.remote == "" {
+		return git.Fetch()
+	}
+	return git.FetchFrom(e.remote)
+}
+
+// upstream returns the remote-tracking branch remote changes are integrated
+// from, or an empty string when there is none yet
+func (e *Engine) upstream() string {
+	if e.remote == "" {
+		return git.Upstream()
+	}
+	branch, err := e.remoteBranch()
+	if err != nil {
+		return ""
+	}
+	upstream := e.remote + "/" + branch
+	if !git.RefExists("refs/remotes/" + upstream) {
+		return ""
+	}
+	return upstream
+}
+
+// push pushes the current branch to the configured remote, or its upstream
+func (e *Engine) push() error {
+	if e.remote == "" {
+		return git.Push()
+	}
+	branch, err := e.remoteBranch()
+	if err != nil {
+		return err
+	}
+	return git.PushTo(e.remote, branch)
+}
+
+// forcePushWithLease force-pushes the current branch after its history was
+// rebuilt or rewritten. The lease is the remote branch as this clone last
+// fetched it, so anything someone else pushed since is never overwritten: the
+// push is refused instead, and the next sync integrates it.
+func (e *Engine) forcePushWithLease() error {
+	remote, branch := e.remote, e.branch
+	if remote == "" {
+		// Without a configured remote, push where the branch tracks, or to
+		// origin on its first push
+		remote, branch, _ = strings.Cut(git.Upstream(), "/")
+		if remote == "" {
+			remote = "origin"
+		}
+	}
+	if branch == "" {
+		var err error
+		if branch, err = e.remoteBranch(); err != nil {
+			return err
+		}
+	}
+
+	expected := ""
+	if git.RefExists("refs/remotes/" + remote + "/" + branch) {
+		var err error
+		if expected, err = git.ResolveRef("refs/remotes/" + remote + "/" + branch); err != nil {
+			return err
+		}
+	}
+	err := git.PushWithLease(remote, branch, expected)
+	if errors.Is(err, git.ErrPushRejected) {
+		return fmt.Errorf("%w (%s/%s changed since this clone last fetched it, so nothing was overwritten; run 'vanity sync' to take those changes, then try again)", err, remote, branch)
+	}
+	return err
+}
+
+// ensureMirrorDatesIntact refuses histories in which mirror commits no longer
+// carry their backdated committer date, which is what happens when they go
+// through a plain rebase. Integrating on top of such a history would push the
+// damage to every collaborator, so the run stops and points at a rebuild.
+func ensureMirrorDatesIntact(revs ...string) error {
+	commits, err := git.LogCommits(revs...)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var damaged []string
+	for _, c := range commits {
+		if !strings.HasPrefix(c.Subject, git.MirrorMessagePrefix) {
+			continue
+		}
+		if !c.CommitterDate.Equal(c.AuthorDate) {
+			damaged = append(damaged, c.Hash[:12])
+		}
+	}
+	if len(damaged) == 0 {
+		return nil
+	}
+
+	listed := damaged
+	suffix := ""
+	if len(listed) > maxReportedDamagedCommits {
+		listed = listed[:maxReportedDamagedCommits]
+		suffix = fmt.Sprintf(", and %d more", len(damaged)-maxReportedDamagedCommits)
+	}
+	return fmt.Errorf("%d mirror commit(s) have lost their original dates (%s%s); run 'vanity sync --rebuild' to recreate them",
+		len(damaged), strings.Join(listed, ", "), suffix)
+}
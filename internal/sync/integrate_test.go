@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+func TestIntegrateRemoteKeepsMirrorCommitDates(t *testing.T) {
+	for _, strategy := range []IntegrationStrategy{IntegrateRebase, IntegrateMerge} {
+		t.Run(string(strategy), func(t *testing.T) {
+			_, alice, bob := initSharedRemote(t)
+
+			runGit(t, bob, "commit", "--allow-empty", "-m", "vanity: sync bob")
+			runGit(t, bob, "push")
+
+			var err error
+			withWorkingDirectory(t, alice, func() {
+				timestamps, err := TimestampsSpread.Timestamps("2024-01-02", "bob", 0, 2, time.Local, 0)
+				if err != nil {
+					t.Fatalf("Timestamps() error = %v", err)
+				}
+				if _, err := git.CreateBackdatedCommits(timestamps, "bob", git.Identity{}); err != nil {
+					t.Fatalf("CreateBackdatedCommits() error = %v", err)
+				}
+				silenceStderr(t)
+				captureStdout(t, func() {
+					err = (&Engine{username: "alice", integration: strategy}).integrateRemote()
+				})
+			})
+			if err != nil {
+				t.Fatalf("integrateRemote() error = %v", err)
+			}
+
+			if !strings.Contains(runGit(t, alice, "log", "--format=%s"), "vanity: sync bob") {
+				t.Fatal("bob's pushed commit was not integrated")
+			}
+			dates := runGit(t, alice, "log", "--grep", "^vanity: mirror from", "--format=%ad %cd", "--date=short")
+			for _, line := range strings.Split(dates, "\n") {
+				if line != "2024-01-02 2024-01-02" {
+					t.Errorf("mirror commit author/committer dates = %q, want both 2024-01-02", line)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrateRemoteRefusesRedatedMirrorCommits(t *testing.T) {
+	_, alice, _ := initSharedRemote(t)
+	runGit(t, alice, "commit", "--allow-empty", "-m", "vanity: mirror from bob (1/1)",
+		"--date", "2024-01-02T00:00:00")
+	before := runGit(t, alice, "rev-parse", "HEAD")
+
+	var err error
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).integrateRemote()
+		})
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "lost their original dates") {
+		t.Fatalf("integrateRemote() error = %v, want a refusal naming the damaged history", err)
+	}
+	if !strings.Contains(err.Error(), "--rebuild") {
+		t.Errorf("integrateRemote() error = %v, want it to suggest a rebuild", err)
+	}
+	if head := runGit(t, alice, "rev-parse", "HEAD"); head != before {
+		t.Errorf("HEAD changed from %s to %s", before, head)
+	}
+}
+
+func TestIntegrateRemoteAdoptsRewrittenHistory(t *testing.T) {
+	remote, alice, bob := initSharedRemote(t)
+	commitMirror(t, bob, "carol", "2024-01-01")
+	commitMirror(t, bob, "dave", "2024-01-02")
+	runGit(t, bob, "push")
+	runGit(t, alice, "pull")
+
+	// bob rewrites carol's commit out of history and pushes that, while alice
+	// has a commit of her own that is not pushed yet
+	runGit(t, bob, "rebase", "--onto", "HEAD~2", "HEAD~1")
+	runGit(t, bob, "push", "--force")
+	runGit(t, alice, "commit", "--allow-empty", "-m", "vanity: sync alice")
+
+	var err error
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).integrateRemote()
+		})
+	})
+	if err != nil {
+		t.Fatalf("integrateRemote() error = %v", err)
+	}
+	if head, want := runGit(t, alice, "rev-parse", "HEAD"), runGit(t, alice, "--git-dir", remote, "rev-parse", "main"); head != want {
+		t.Errorf("HEAD = %s, want the rewritten remote %s", head, want)
+	}
+	if subjects := runGit(t, alice, "log", "--format=%s"); strings.Contains(subjects, "mirror from carol") {
+		t.Errorf("integrating brought back the rewritten-out commit:\n%s", subjects)
+	}
+	withWorkingDirectory(t, alice, func() {
+		if snapshots, _ := ListSnapshots(); len(snapshots) == 0 {
+			t.Error("the discarded local history was not kept as a snapshot")
+		}
+	})
+}
+
+func TestForcePushWithLeaseKeepsOthersCommits(t *testing.T) {
+	remote, alice, bob := initSharedRemote(t)
+	runGit(t, bob, "commit", "--allow-empty", "-m", "vanity: sync bob")
+	runGit(t, bob, "push")
+	runGit(t, alice, "commit", "--amend", "--allow-empty", "-m", "rewritten")
+
+	var err error
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).forcePushWithLease()
+		})
+	})
+	if !errors.Is(err, git.ErrPushRejected) || !strings.Contains(err.Error(), "nothing was overwritten") {
+		t.Fatalf("forcePushWithLease() error = %v, want a rejected lease", err)
+	}
+	if subjects := runGit(t, alice, "--git-dir", remote, "log", "--format=%s", "main"); !strings.Contains(subjects, "vanity: sync bob") {
+		t.Errorf("bob's commit was overwritten:\n%s", subjects)
+	}
+
+	// Once alice has fetched bob's commit, the lease covers it.
+	runGit(t, alice, "fetch")
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).forcePushWithLease()
+		})
+	})
+	if err != nil {
+		t.Errorf("forcePushWithLease() after fetching error = %v", err)
+	}
+}
+
+func TestParseIntegrationStrategy(t *testing.T) {
+	if got, err := ParseIntegrationStrategy("merge"); err != nil || got != IntegrateMerge {
+		t.Fatalf("ParseIntegrationStrategy(merge) = %q, %v", got, err)
+	}
+	if _, err := ParseIntegrationStrategy("squash"); err == nil {
+		t.Fatal("ParseIntegrationStrategy(squash) error = nil, want an error")
+	}
+}
@@ -0,0 +1,302 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// departuresPath is the committed list of accounts that left the group, in
+// git-config format with one [departure "<name>"] section per account
+var departuresPath = filepath.Join(vanityDir, "departures")
+
+// Departure is an account that left with 'vanity leave'. It is signed with
+// one of the account's registered keys, which stay in .vanity/keys/ so every
+// clone can check that the account itself left.
+type Departure struct {
+	Name         string // as stored in this repo
+	At           time.Time
+	StripCommits bool   // every sync rewrites its mirror commits out of history
+	Key          string // fingerprint of the signing key
+	Signature    string // base64 ed25519 signature of signedBytes
+}
+
+// signedBytes is what a departure's signature covers
+func (d Departure) signedBytes() []byte {
+	return []byte(fmt.Sprintf("vanity departure\nname %s\nat %s\nstripCommits %t\n",
+		d.Name, d.At.UTC().Format(time.RFC3339), d.StripCommits))
+}
+
+// sign signs the departure with key
+func (d *Departure) sign(key ed25519.PrivateKey) {
+	d.Key = KeyFingerprint(key.Public().(ed25519.PublicKey))
+	d.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, d.signedBytes()))
+}
+
+// verify checks that the departure was signed by the account that left
+func (d Departure) verify() (warning string, err error) {
+	if d.Signature == "" {
+		return "", fmt.Errorf("the departure is not signed")
+	}
+	warning, err = verifySignature(d.Name, d.Key, d.Signature, d.signedBytes())
+	if errors.Is(err, errSignatureMismatch) {
+		return "", fmt.Errorf("the departure's signature does not match it (edited by someone else?)")
+	}
+	return warning, err
+}
+
+// LoadDepartures reads the accounts that left, sorted by name
+func LoadDepartures() ([]Departure, error) {
+	entries, err := vanityConfigList(departuresPath)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Departure)
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Key, "departure.")
+		if !ok {
+			continue
+		}
+		dot := strings.LastIndex(rest, ".")
+		if dot < 0 {
+			continue
+		}
+		name, key := rest[:dot], rest[dot+1:]
+		d := byName[name]
+		if d == nil {
+			d = &Departure{Name: name}
+			byName[name] = d
+		}
+		switch key {
+		case "at":
+			if d.At, err = time.Parse(time.RFC3339, entry.Value); err != nil {
+				return nil, fmt.Errorf("%s: departure %s has invalid time %q", departuresPath, name, entry.Value)
+			}
+		case "stripcommits":
+			d.StripCommits = entry.Value == "true"
+		case "key":
+			d.Key = entry.Value
+		case "signature":
+			d.Signature = entry.Value
+		}
+	}
+
+	departures := make([]Departure, 0, len(byName))
+	for _, d := range byName {
+		if err := ValidateLogin(d.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", departuresPath, err)
+		}
+		departures = append(departures, *d)
+	}
+	sort.Slice(departures, func(i, j int) bool { return departures[i].Name < departures[j].Name })
+	return departures, nil
+}
+
+// recordDeparture adds an account to the departures list
+func recordDeparture(d Departure) error {
+	section := "departure." + d.Name
+	return vanityConfigSet(departuresPath, [][2]string{
+		{section + ".at", d.At.UTC().Format(time.RFC3339)},
+		{section + ".stripCommits", fmt.Sprint(d.StripCommits)},
+		{section + ".key", d.Key},
+		{section + ".signature", d.Signature},
+	})
+}
+
+// Leave takes the current account out of the group: its contribution data and
+// sync state are deleted, every state file forgets it, and a departure signed
+// with its key is recorded and pushed. Its registered keys stay, so other
+// clones can verify the departure. With stripCommits, the next sync
+// of each other account rewrites its mirror commits out of history. Unless
+// keepAccess is set, the account then gives up its access to the repository.
+func (e *Engine) Leave(stripCommits, keepAccess bool) (err error) {
+	lock, err := acquireLock(e.username)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	if err := e.loadNaming(); err != nil {
+		return err
+	}
+	name := e.self()
+	if git.HasUncommittedChanges() {
+		return fmt.Errorf("the working tree has uncommitted changes; commit or stash them first")
+	}
+	if git.HasRemote() {
+		fmt.Println("Pulling latest changes...")
+		if err := e.integrateRemote(); err != nil {
+			return fmt.Errorf("git pull failed: %w", err)
+		}
+	}
+
+	statePath := filepath.Join(vanityDir, name+"-state.json")
+	if _, err := os.Stat(statePath); os.IsNotExist(err) && !hasContributionData(name) {
+		return fmt.Errorf("%s has not synced in this repo", e.username)
+	}
+
+	if err := e.recordSnapshot(time.Now()); err != nil {
+		return fmt.Errorf("failed to record snapshot: %w", err)
+	}
+
+	key, err := ensureSigningKey(name)
+	if err != nil {
+		return fmt.Errorf("failed to load signing key: %w", err)
+	}
+	if _, err := removeSourceFiles(name); err != nil {
+		return err
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", statePath, err)
+	}
+	departure := Departure{Name: name, At: time.Now().UTC().Truncate(time.Second), StripCommits: stripCommits}
+	departure.sign(key)
+	if err := recordDeparture(departure); err != nil {
+		return fmt.Errorf("failed to record departure: %w", err)
+	}
+
+	if err := git.Add(".vanity/"); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+	if err := git.Commit(e.selfMessage("vanity: %s left", "vanity: account left")); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	if git.HasRemote() {
+		fmt.Println("Pushing changes...")
+		if err := e.pushWithRetry(); err != nil {
+			return fmt.Errorf("failed to push: %w", err)
+		}
+	}
+	fmt.Printf("%s left the group", e.username)
+	if stripCommits {
+		fmt.Print("; other accounts' next sync will remove its mirror commits")
+	}
+	fmt.Println()
+
+	if keepAccess || !git.HasRemote() {
+		return nil
+	}
+	repo, err := github.CurrentRepository()
+	if err != nil {
+		return fmt.Errorf("failed to find the GitHub repository: %w", err)
+	}
+	if owner, _, _ := strings.Cut(repo, "/"); strings.EqualFold(owner, e.username) {
+		fmt.Printf("%s owns %s, so it keeps its access; transfer or delete the repository to leave it entirely.\n", e.username, repo)
+		return nil
+	}
+	if err := github.RemoveCollaborator(repo, e.username); err != nil {
+		return fmt.Errorf("failed to remove %s from %s (ask an admin to remove it): %w", e.username, repo, err)
+	}
+	fmt.Printf("Removed %s from %s\n", e.username, repo)
+	return nil
+}
+
+// applyDepartures brings this clone in line with the accounts that left: it
+// forgets them in state, deletes data an out-of-date clone stored for them
+// again, and rewrites the mirror commits of those that asked for it out of
+// history. It reports whether history was rewritten, in which case the
+// branch must be force-pushed. An account that syncs again has rejoined, and
+// its departure is dropped.
+func (e *Engine) applyDepartures(state *SyncState, dryRun bool) (bool, error) {
+	departures, err := LoadDepartures()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", departuresPath, err)
+	}
+
+	rewritten := false
+	for _, d := range departures {
+		login := e.naming.Display(d.Name)
+		if d.Name == e.self() {
+			fmt.Printf("Rejoining: %s left on %s\n", login, d.At.Format("2006-01-02"))
+			if !dryRun {
+				if err := vanityConfigRemoveSection(departuresPath, "departure."+d.Name); err != nil {
+					return rewritten, fmt.Errorf("failed to update %s: %w", departuresPath, err)
+				}
+			}
+			continue
+		}
+
+		// Anyone who can push could write a departure, and one strips history,
+		// so only the account's own signed departure is honoured
+		warning, err := d.verify()
+		if err != nil {
+			fmt.Printf("Warning: ignoring the departure of %s: %v\n", login, err)
+			continue
+		}
+		if warning != "" {
+			fmt.Printf("  %s: %s\n", login, warning)
+		}
+
+		state.forgetSource(d.Name)
+		if d.StripCommits {
+			stripped, err := e.stripDepartedCommits(d.Name, dryRun)
+			if err != nil {
+				fmt.Printf("Warning: failed to remove mirror commits from %s, who left: %v\n", login, err)
+			}
+			rewritten = rewritten || stripped
+		}
+		if hasContributionData(d.Name) && !dryRun {
+			if err := removeContributionData(d.Name); err != nil {
+				return rewritten, fmt.Errorf("failed to remove data of %s, who left: %w", login, err)
+			}
+		}
+	}
+	return rewritten, nil
+}
+
+// stripDepartedCommits rewrites the mirror commits from an account that left
+// out of the current branch, and reports whether there were any
+func (e *Engine) stripDepartedCommits(name string, dryRun bool) (bool, error) {
+	prefix := git.MirrorMessagePrefix + name + " ("
+	commits, err := git.LogCommits("HEAD")
+	if err != nil {
+		return false, fmt.Errorf("failed to read history: %w", err)
+	}
+	count := 0
+	for _, c := range commits {
+		if strings.HasPrefix(c.Subject, prefix) {
+			count++
+		}
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	login := e.naming.Display(name)
+	if dryRun {
+		fmt.Printf("Would remove %d mirror commit(s) from %s, who left\n", count, login)
+		return false, nil
+	}
+	branch, err := git.GetCurrentBranch()
+	if err != nil || branch == "" {
+		return false, fmt.Errorf("cannot rewrite history from detached HEAD")
+	}
+	if err := ensureDedicatedSyncRepo(); err != nil {
+		return false, err
+	}
+	if git.HasUncommittedChanges() {
+		return false, fmt.Errorf("the working tree has uncommitted changes")
+	}
+	if err := e.recordSnapshot(time.Now()); err != nil {
+		return false, fmt.Errorf("failed to record snapshot: %w", err)
+	}
+	fmt.Printf("Removing %d mirror commit(s) from %s, who left...\n", count, login)
+	if err := git.DropCommits(branch, prefix); err != nil {
+		return false, fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeaveRecordsDepartureThatOthersHonour(t *testing.T) {
+	remote, alice, bob := initSharedRemote(t)
+	writeTestFile(t, bob, ".vanity/alice.json", `{"username":"alice","contributions":[{"date":"2024-01-02","count":1}]}`)
+	writeTestFile(t, bob, ".vanity/bob.json", `{"username":"bob","contributions":[{"date":"2024-01-01","count":1}]}`)
+	writeTestFile(t, bob, ".vanity/bob-state.json", `{"username":"bob","mirrored_counts":{"alice":{"2024-01-02":1}}}`)
+	writeTestFile(t, bob, ".vanity/alice-state.json", `{"username":"alice","mirrored_counts":{"bob":{"2024-01-01":1}}}`)
+	runGit(t, bob, "add", ".")
+	runGit(t, bob, "commit", "-m", "vanity: sync bob")
+	commitMirror(t, bob, "bob", "2024-01-01")
+	commitMirror(t, bob, "alice", "2024-01-02")
+	runGit(t, bob, "push")
+	before := runGit(t, bob, "rev-parse", "HEAD")
+
+	var err error
+	withWorkingDirectory(t, bob, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "bob"}).Leave(true, true)
+		})
+		if snapshots, _ := ListSnapshots(); len(snapshots) != 1 || snapshots[0].Hash != before {
+			t.Errorf("snapshots = %+v, want the branch before leaving", snapshots)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Leave() error = %v", err)
+	}
+	for _, name := range []string{"bob.json", "bob-state.json"} {
+		if _, err := os.Stat(filepath.Join(bob, ".vanity", name)); !os.IsNotExist(err) {
+			t.Errorf("%s survived leaving", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(bob, ".vanity", "keys", "bob.pub")); err != nil {
+		t.Error("leaving deleted the keys its departure is verified with")
+	}
+
+	runGit(t, alice, "pull")
+	withWorkingDirectory(t, alice, func() {
+		departures, err := LoadDepartures()
+		if err != nil || len(departures) != 1 || departures[0].Name != "bob" || !departures[0].StripCommits || departures[0].Signature == "" {
+			t.Fatalf("LoadDepartures() = %+v, %v", departures, err)
+		}
+
+		e := &Engine{username: "alice"}
+		_ = e.loadNaming()
+		state, _ := LoadSyncState("alice")
+		if _, ok := state.MirroredCounts["bob"]; ok {
+			t.Error("leaving should drop bob from other accounts' state")
+		}
+		state.SetMirroredCount("bob", "2024-01-01", 1) // as an out-of-date clone would
+		var rewritten bool
+		output := captureStdout(t, func() {
+			rewritten, err = e.applyDepartures(state, false)
+		})
+		if err != nil || !rewritten {
+			t.Fatalf("applyDepartures() = %v, %v\n%s", rewritten, err, output)
+		}
+		if _, ok := state.MirroredCounts["bob"]; ok {
+			t.Error("applyDepartures() kept bob's mirrored counts")
+		}
+		if snapshots, _ := ListSnapshots(); len(snapshots) == 0 {
+			t.Error("applyDepartures() rewrote history without a snapshot")
+		}
+	})
+	subjects := runGit(t, alice, "log", "--format=%s")
+	if strings.Contains(subjects, "mirror from bob") || !strings.Contains(subjects, "mirror from alice") {
+		t.Errorf("history after applying departures:\n%s", subjects)
+	}
+	if remoteSubjects := runGit(t, alice, "--git-dir", remote, "log", "--format=%s", "main"); !strings.Contains(remoteSubjects, "mirror from bob") {
+		t.Error("the rewrite should wait for sync to force-push")
+	}
+
+	// bob syncing again rejoins.
+	withWorkingDirectory(t, alice, func() {
+		e := &Engine{username: "bob"}
+		_ = e.loadNaming()
+		captureStdout(t, func() {
+			_, err = e.applyDepartures(&SyncState{Username: "bob"}, false)
+		})
+		if departures, _ := LoadDepartures(); err != nil || len(departures) != 0 {
+			t.Errorf("rejoining left departures %+v, %v", departures, err)
+		}
+	})
+}
+
+func TestForgedDepartureIsIgnored(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[{"date":"2024-01-01","count":1}]}`)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+	commitMirror(t, repo, "bob", "2024-01-01")
+
+	withWorkingDirectory(t, repo, func() {
+		// carol has push access and writes bob's departure, unsigned and then
+		// signed with her own key
+		var carolKey ed25519.PrivateKey
+		captureStdout(t, func() {
+			carolKey, _ = ensureSigningKey("carol")
+		})
+		forged := Departure{Name: "bob", At: time.Now().UTC().Truncate(time.Second), StripCommits: true}
+		for _, sign := range []bool{false, true} {
+			if sign {
+				forged.sign(carolKey)
+			}
+			if err := recordDeparture(forged); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, repo, "add", ".")
+			runGit(t, repo, "commit", "-m", "bob left")
+
+			e := &Engine{username: "alice"}
+			_ = e.loadNaming()
+			state := &SyncState{Username: "alice", MirroredCounts: map[string]map[string]int{"bob": {"2024-01-01": 1}}}
+			var rewritten bool
+			var err error
+			output := captureStdout(t, func() {
+				rewritten, err = e.applyDepartures(state, false)
+			})
+			if err != nil || rewritten || state.GetMirroredCount("bob", "2024-01-01") != 1 || !strings.Contains(output, "ignoring the departure") {
+				t.Errorf("signed by carol = %v: applyDepartures() = %v, %v, state %v\n%s", sign, rewritten, err, state.MirroredCounts, output)
+			}
+		}
+	})
+	if _, err := os.Stat(filepath.Join(repo, ".vanity", "bob.json")); err != nil {
+		t.Error("a forged departure deleted bob's data")
+	}
+}
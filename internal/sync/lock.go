@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// lockFileName is the advisory lock a sync holds while it mutates the
+// repository. It lives in .git/ so it is never committed or pushed.
+const lockFileName = "vanity.lock"
+
+// staleLockAge is how old a lock must be before a new run may break it when
+// its holder can't be checked: a lock from another host, or one that can't be
+// parsed. A lock from this host is broken as soon as its process is gone, and
+// never while it is alive, however long a rebuild takes.
+const staleLockAge = time.Hour
+
+// lockWaitTimeout is how long a run waits for another run's lock before giving
+// up, checking every lockPollInterval
+var (
+	lockWaitTimeout  = 10 * time.Minute
+	lockPollInterval = time.Second
+)
+
+// lockInfo is written into the lock file so a refused run can say who holds it.
+type lockInfo struct {
+	Username string    `json:"username"`
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+}
+
+// repoLock is a held advisory lock on the sync repository
+type repoLock struct {
+	path string
+}
+
+// acquireLock takes the repository's advisory lock so overlapping runs in the
+// same clone are serialized instead of interleaving commits and state writes.
+// A run that finds the lock held waits for it, up to lockWaitTimeout.
+func acquireLock(username string) (*repoLock, error) {
+	gitDir, err := git.GitDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate .git directory: %w", err)
+	}
+	return waitForLock(filepath.Join(gitDir, lockFileName), username)
+}
+
+// waitForLock polls for the lock in path until it is free or lockWaitTimeout
+// passes
+func waitForLock(path, username string) (*repoLock, error) {
+	deadline := time.Now().Add(lockWaitTimeout)
+	waiting := false
+	for {
+		lock, err := acquireLockAt(path, username, time.Now())
+		if !errors.Is(err, errLockHeld) || time.Now().After(deadline) {
+			return lock, err
+		}
+		if !waiting {
+			holder, _, _ := readLock(path)
+			fmt.Printf("Waiting for another vanity run to finish (%s)...\n", holder)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// errLockHeld reports a lock held by a run that is still going
+var errLockHeld = errors.New("another vanity run holds the lock")
+
+// acquireLockAt makes one attempt at the lock in path, breaking it if its
+// holder is gone
+func acquireLockAt(path, username string, now time.Time) (*repoLock, error) {
+	host, _ := os.Hostname()
+	info, err := json.Marshal(lockInfo{
+		Username: username,
+		Host:     host,
+		PID:      os.Getpid(),
+		Started:  now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := f.Write(info)
+			closeErr := f.Close()
+			if err := errors.Join(writeErr, closeErr); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write lock %s: %w", path, err)
+			}
+			return &repoLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		holder, contents, stale := readLock(path)
+		if !stale(host, now) {
+			return nil, fmt.Errorf("%w (%s); wait for it to finish, or remove %s if it crashed",
+				errLockHeld, holder, path)
+		}
+		fmt.Printf("Breaking stale lock held by %s\n", holder)
+		if err := breakLock(path, contents); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire lock %s", path)
+}
+
+// breakLock removes the lock in path only if it still holds contents, so two
+// runs breaking the same stale lock can't remove the lock one of them just
+// took. The lock is moved aside first, which only one of them can do.
+func breakLock(path string, contents []byte) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+	}
+	moved, err := os.ReadFile(aside)
+	if err == nil && !bytes.Equal(moved, contents) {
+		// Another run replaced the stale lock in the meantime; put it back.
+		err = os.Link(aside, path)
+	}
+	os.Remove(aside)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+	}
+	return nil
+}
+
+// readLock describes the holder of an existing lock, returns the lock's
+// contents, and a check of whether it is stale. A lock that cannot be parsed
+// goes by its modification time.
+func readLock(path string) (string, []byte, func(host string, now time.Time) bool) {
+	data, err := os.ReadFile(path)
+	var info lockInfo
+	if err == nil && json.Unmarshal(data, &info) == nil && !info.Started.IsZero() {
+		holder := fmt.Sprintf("%s on %s, pid %d, since %s",
+			info.Username, info.Host, info.PID, info.Started.Format("2006-01-02 15:04"))
+		return holder, data, func(host string, now time.Time) bool {
+			if info.Host == host && info.PID > 0 {
+				return !processAlive(info.PID)
+			}
+			return now.Sub(info.Started) >= staleLockAge
+		}
+	}
+	modified := time.Time{}
+	if stat, err := os.Stat(path); err == nil {
+		modified = stat.ModTime()
+	}
+	return "an unknown run", data, func(host string, now time.Time) bool {
+		return now.Sub(modified) >= staleLockAge
+	}
+}
+
+// Release gives the lock up so the next run can proceed
+func (l *repoLock) Release() error {
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to release lock %s: %w", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockSerializesRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	lock, err := acquireLockAt(path, "alice", now)
+	if err != nil {
+		t.Fatalf("acquireLockAt() error = %v", err)
+	}
+
+	if _, err := acquireLockAt(path, "bob", now.Add(time.Minute)); err == nil {
+		t.Fatal("second acquireLockAt() error = nil, want the held lock to refuse it")
+	} else if !strings.Contains(err.Error(), "alice") {
+		t.Fatalf("second acquireLockAt() error = %v, want it to name the holder", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock file still present after release: err = %v", err)
+	}
+
+	relock, err := acquireLockAt(path, "bob", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("acquireLockAt() after release error = %v", err)
+	}
+	if err := relock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+// writeLockFile plants a lock as another run would have left it
+func writeLockFile(t *testing.T, path string, info lockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deadPID returns the PID of a process that has already exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("git", "--version")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestAcquireLockBreaksDeadHoldersLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	host, _ := os.Hostname()
+	writeLockFile(t, path, lockInfo{Username: "alice", Host: host, PID: deadPID(t), Started: now})
+
+	var lock *repoLock
+	var err error
+	captureStdout(t, func() {
+		lock, err = acquireLockAt(path, "bob", now.Add(time.Minute))
+	})
+	if err != nil {
+		t.Fatalf("acquireLockAt() over a dead holder's lock error = %v", err)
+	}
+	holder, _, _ := readLock(path)
+	if !strings.HasPrefix(holder, "bob ") {
+		t.Fatalf("lock holder = %q, want bob", holder)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestAcquireLockKeepsLiveHoldersLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := acquireLockAt(path, "alice", now); err != nil {
+		t.Fatalf("acquireLockAt() error = %v", err)
+	}
+	// Long past staleLockAge, but this process, which holds it, is alive.
+	if _, err := acquireLockAt(path, "bob", now.Add(staleLockAge+time.Minute)); !errors.Is(err, errLockHeld) {
+		t.Fatalf("acquireLockAt() over a live holder's lock error = %v, want errLockHeld", err)
+	}
+}
+
+func TestAcquireLockBreaksOldForeignLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	writeLockFile(t, path, lockInfo{Username: "alice", Host: "elsewhere.invalid", PID: 1, Started: now})
+
+	if _, err := acquireLockAt(path, "bob", now.Add(time.Minute)); !errors.Is(err, errLockHeld) {
+		t.Fatalf("acquireLockAt() over a fresh foreign lock error = %v, want errLockHeld", err)
+	}
+
+	var err error
+	captureStdout(t, func() {
+		_, err = acquireLockAt(path, "bob", now.Add(staleLockAge+time.Minute))
+	})
+	if err != nil {
+		t.Fatalf("acquireLockAt() over an old foreign lock error = %v", err)
+	}
+}
+
+func TestBreakLockLeavesReplacedLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	if err := os.WriteFile(path, []byte("new holder"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := breakLock(path, []byte("old holder")); err != nil {
+		t.Fatalf("breakLock() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new holder" {
+		t.Fatalf("lock after breakLock() = %q, %v; want the replacement kept", data, err)
+	}
+}
+
+func TestWaitForLockWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	oldTimeout, oldInterval := lockWaitTimeout, lockPollInterval
+	lockWaitTimeout, lockPollInterval = 5*time.Second, 10*time.Millisecond
+	t.Cleanup(func() { lockWaitTimeout, lockPollInterval = oldTimeout, oldInterval })
+
+	held, err := acquireLockAt(path, "alice", time.Now())
+	if err != nil {
+		t.Fatalf("acquireLockAt() error = %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		held.Release()
+	}()
+
+	var lock *repoLock
+	captureStdout(t, func() {
+		lock, err = waitForLock(path, "bob")
+	})
+	if err != nil {
+		t.Fatalf("waitForLock() error = %v, want it to wait for the release", err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestWaitForLockTimesOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFileName)
+	oldTimeout, oldInterval := lockWaitTimeout, lockPollInterval
+	lockWaitTimeout, lockPollInterval = 50*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { lockWaitTimeout, lockPollInterval = oldTimeout, oldInterval })
+
+	if _, err := acquireLockAt(path, "alice", time.Now()); err != nil {
+		t.Fatalf("acquireLockAt() error = %v", err)
+	}
+	var err error
+	captureStdout(t, func() {
+		_, err = waitForLock(path, "bob")
+	})
+	if !errors.Is(err, errLockHeld) {
+		t.Fatalf("waitForLock() error = %v, want errLockHeld after the timeout", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package sync
+
+import "os"
+
+// processAlive reports whether a process with pid is running on this host.
+// Windows can't open a process that has exited.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MergeMode decides how a re-import combines with the data already stored
+// for an account
+type MergeMode string
+
+const (
+	MergeReplace MergeMode = "replace" // keep only the new import
+	MergeMax     MergeMode = "max"     // keep every day, at the higher count
+	MergeUnion   MergeMode = "union"   // keep every day, at the new count where both have it
+	MergeNewer   MergeMode = "newer"   // the new import wins for the days it covered
+)
+
+// ParseMergeMode parses a merge mode name
+func ParseMergeMode(s string) (MergeMode, error) {
+	switch m := MergeMode(s); m {
+	case MergeReplace, MergeMax, MergeUnion, MergeNewer:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid merge mode %q (want replace, max, union or newer)", s)
+}
+
+// MergeSummary lists the days whose counts a merge changed
+type MergeSummary struct {
+	Added       []string
+	Rose        []string
+	Fell        []string
+	Disappeared []string
+}
+
+// Changed reports whether the merge changed anything
+func (s MergeSummary) Changed() bool {
+	return len(s.Added)+len(s.Rose)+len(s.Fell)+len(s.Disappeared) > 0
+}
+
+// MergeContributions combines stored contributions with a new import of the
+// same account. [from, to] is the range of days the import covered, which
+// MergeNewer treats as authoritative.
+func MergeContributions(existing, imported []Contribution, mode MergeMode, from, to string) ([]Contribution, MergeSummary) {
+	old := make(map[string]int, len(existing))
+	for _, c := range existing {
+		old[c.Date] = c.Count
+	}
+	merged := make(map[string]int, len(imported))
+	for _, c := range imported {
+		merged[c.Date] = c.Count
+	}
+
+	for date, count := range old {
+		n, inNew := merged[date]
+		switch mode {
+		case MergeMax:
+			merged[date] = max(n, count)
+		case MergeUnion:
+			if !inNew {
+				merged[date] = count
+			}
+		case MergeNewer:
+			if !inNew && (date < from || (to != "" && date > to)) {
+				merged[date] = count
+			}
+		}
+	}
+
+	var summary MergeSummary
+	result := make([]Contribution, 0, len(merged))
+	for date, count := range merged {
+		if count <= 0 {
+			delete(merged, date)
+			continue
+		}
+		result = append(result, Contribution{Date: date, Count: count})
+		was, ok := old[date]
+		switch {
+		case !ok:
+			summary.Added = append(summary.Added, date)
+		case count > was:
+			summary.Rose = append(summary.Rose, date)
+		case count < was:
+			summary.Fell = append(summary.Fell, date)
+		}
+	}
+	for date, count := range old {
+		if _, ok := merged[date]; !ok && count > 0 {
+			summary.Disappeared = append(summary.Disappeared, date)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+	for _, dates := range [][]string{summary.Added, summary.Rose, summary.Fell, summary.Disappeared} {
+		sort.Strings(dates)
+	}
+	return result, summary
+}
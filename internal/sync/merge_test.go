@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeContributions(t *testing.T) {
+	// An earlier --scrape saw private work; the API re-import doesn't, and
+	// covers only 2024.
+	existing := []Contribution{{Date: "2023-12-31", Count: 2}, {Date: "2024-01-01", Count: 5}, {Date: "2024-01-02", Count: 1}, {Date: "2024-01-03", Count: 4}}
+	imported := []Contribution{{Date: "2024-01-01", Count: 3}, {Date: "2024-01-02", Count: 2}, {Date: "2024-01-04", Count: 1}}
+
+	tests := []struct {
+		mode MergeMode
+		want []Contribution
+		sum  MergeSummary
+	}{
+		{
+			mode: MergeReplace,
+			want: imported,
+			sum:  MergeSummary{Added: []string{"2024-01-04"}, Rose: []string{"2024-01-02"}, Fell: []string{"2024-01-01"}, Disappeared: []string{"2023-12-31", "2024-01-03"}},
+		},
+		{
+			mode: MergeMax,
+			want: []Contribution{{Date: "2023-12-31", Count: 2}, {Date: "2024-01-01", Count: 5}, {Date: "2024-01-02", Count: 2}, {Date: "2024-01-03", Count: 4}, {Date: "2024-01-04", Count: 1}},
+			sum:  MergeSummary{Added: []string{"2024-01-04"}, Rose: []string{"2024-01-02"}},
+		},
+		{
+			mode: MergeUnion,
+			want: []Contribution{{Date: "2023-12-31", Count: 2}, {Date: "2024-01-01", Count: 3}, {Date: "2024-01-02", Count: 2}, {Date: "2024-01-03", Count: 4}, {Date: "2024-01-04", Count: 1}},
+			sum:  MergeSummary{Added: []string{"2024-01-04"}, Rose: []string{"2024-01-02"}, Fell: []string{"2024-01-01"}},
+		},
+		{
+			mode: MergeNewer,
+			want: []Contribution{{Date: "2023-12-31", Count: 2}, {Date: "2024-01-01", Count: 3}, {Date: "2024-01-02", Count: 2}, {Date: "2024-01-04", Count: 1}},
+			sum:  MergeSummary{Added: []string{"2024-01-04"}, Rose: []string{"2024-01-02"}, Fell: []string{"2024-01-01"}, Disappeared: []string{"2024-01-03"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			got, sum := MergeContributions(existing, imported, tt.mode, "2024-01-01", "2024-12-31")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contributions = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(sum, tt.sum) {
+				t.Errorf("summary = %+v, want %+v", sum, tt.sum)
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// The merge driver is registered per clone: its command in .git/config and
+// the files it handles in .git/info/attributes, which git reads like a
+// .gitattributes file but never commits.
+const (
+	mergeDriverName    = "vanity"
+	mergeDriverCommand = "vanity merge-driver %O %A %B %P"
+)
+
+var mergeDriverAttributes = []string{
+	".vanity/*.json merge=" + mergeDriverName,
+	".vanity/*/*.json merge=" + mergeDriverName,
+	".vanity/sources merge=" + mergeDriverName,
+	".vanity/departures merge=" + mergeDriverName,
+	".vanity/keys/*.pub merge=union",
+}
+
+// InstallMergeDriver registers 'vanity merge-driver' for the .vanity JSON
+// files, sources manifest and departures list of this clone, and git's union merge for registered keys, so
+// concurrent syncs and imports don't stop a pull on a conflict. It does
+// nothing when the driver is already installed.
+func InstallMergeDriver() error {
+	gitDir, err := git.GitDir()
+	if err != nil {
+		return fmt.Errorf("failed to locate .git directory: %w", err)
+	}
+	configPath := filepath.Join(gitDir, "config")
+	if err := git.ConfigFileSet(configPath, "merge."+mergeDriverName+".name", "vanity contribution and state files"); err != nil {
+		return err
+	}
+	if err := git.ConfigFileSet(configPath, "merge."+mergeDriverName+".driver", mergeDriverCommand); err != nil {
+		return err
+	}
+
+	attributesPath := filepath.Join(gitDir, "info", "attributes")
+	existing, err := os.ReadFile(attributesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		present[strings.TrimSpace(line)] = true
+	}
+	var missing []string
+	for _, line := range mergeDriverAttributes {
+		if !present[line] {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(attributesPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(attributesPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		fmt.Fprintln(f)
+	}
+	for _, line := range missing {
+		fmt.Fprintln(f, line)
+	}
+	return f.Close()
+}
+
+// MergeVanityFile is the merge driver: it merges the base, ours and theirs
+// versions of the .vanity file at path (as given by git's %O, %A, %B and %P)
+// and writes the result over ours. Contribution days changed on both sides
+// take the higher count (MergeMax) or the count of the side updated last
+// (MergeNewer); mirrored counts in state files add up both sides' increases,
+// since the mirror commits of both sides survive the merge.
+func MergeVanityFile(base, ours, theirs, path string, mode MergeMode) error {
+	if mode != MergeMax && mode != MergeNewer {
+		return fmt.Errorf("invalid merge preference %q (want max or newer)", mode)
+	}
+
+	read := func(file string) ([]byte, error) {
+		raw, err := readVanityFileAs(file, path)
+		if err != nil || len(strings.TrimSpace(string(raw))) == 0 {
+			// An empty base means both sides added the file.
+			return nil, err
+		}
+		return raw, nil
+	}
+	rawBase, err := read(base)
+	if err != nil {
+		return err
+	}
+	rawOurs, err := read(ours)
+	if err != nil {
+		return err
+	}
+	rawTheirs, err := read(theirs)
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	var merged []byte
+	switch {
+	case filepath.Clean(path) == sourcesPath || filepath.Clean(path) == departuresPath:
+		merged, err = mergeConfigFiles(path, rawBase, rawOurs, rawTheirs)
+	case filepath.Clean(filepath.Dir(path)) != vanityDir && name == accountFileName:
+		merged, err = mergeAccountFiles(path, rawOurs, rawTheirs)
+	case filepath.Clean(filepath.Dir(path)) != vanityDir && yearFilePattern.MatchString(name):
+		merged, err = mergeYearFiles(path, rawBase, rawOurs, rawTheirs, mode)
+	case strings.HasSuffix(name, "-state.json"):
+		merged, err = mergeStateFiles(path, rawBase, rawOurs, rawTheirs)
+	case strings.HasSuffix(name, ".json"):
+		merged, err = mergeContributionFiles(path, rawBase, rawOurs, rawTheirs, mode)
+	default:
+		return fmt.Errorf("%s is not a vanity contribution or state file", path)
+	}
+	if err != nil {
+		return err
+	}
+	return writeVanityFileAs(ours, path, merged)
+}
+
+// mergeConfigFiles merges the decrypted sides of a git-config-format .vanity
+// file as text, as git would if the file were not encrypted
+func mergeConfigFiles(path string, base, ours, theirs []byte) ([]byte, error) {
+	gitDir, err := git.GitDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate .git directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(gitDir, "vanity-merge-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := make([]string, 3)
+	for i, side := range [][]byte{ours, base, theirs} {
+		files[i] = filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(files[i], side, 0600); err != nil {
+			return nil, err
+		}
+	}
+	merged, err := git.MergeFile(files[0], files[1], files[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge %s: %w", path, err)
+	}
+	return merged, nil
+}
+
+// decodeSide migrates and decodes one side of a merge into v; a missing side
+// leaves v as it is
+func decodeSide(path string, raw []byte, v any) error {
+	if raw == nil {
+		return nil
+	}
+	raw, err := migrate(contributionFileKind(path), path, raw)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return jsonError(path, raw, err)
+	}
+	return nil
+}
+
+func contributionFileKind(path string) fileKind {
+	if strings.HasSuffix(path, "-state.json") {
+		return stateFile
+	}
+	return contributionFile
+}
+
+// day is a date's count on one side of a merge; a day the side doesn't have
+// is absent
+type day struct {
+	count   int
+	present bool
+}
+
+// mergeDays merges per-day counts changed on two sides since base. A day only
+// one side changed, added or removed takes that side's count; a day both
+// changed differently is resolved by resolve.
+func mergeDays(base, ours, theirs []Contribution, resolve func(ours, theirs day) day) []Contribution {
+	index := func(contribs []Contribution) map[string]day {
+		days := make(map[string]day, len(contribs))
+		for _, c := range contribs {
+			days[c.Date] = day{c.Count, true}
+		}
+		return days
+	}
+	b, o, t := index(base), index(ours), index(theirs)
+
+	dates := make(map[string]bool)
+	for _, days := range []map[string]day{b, o, t} {
+		for date := range days {
+			dates[date] = true
+		}
+	}
+
+	merged := []Contribution{}
+	for date := range dates {
+		var d day
+		switch {
+		case o[date] == t[date]:
+			d = o[date]
+		case o[date] == b[date]:
+			d = t[date]
+		case t[date] == b[date]:
+			d = o[date]
+		default:
+			d = resolve(o[date], t[date])
+		}
+		if d.present {
+			merged = append(merged, Contribution{Date: date, Count: d.count})
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Date < merged[j].Date })
+	return merged
+}
+
+// dayResolver resolves a day both sides changed: the higher count, or the
+// side updated last
+func dayResolver(mode MergeMode, oursNewer bool) func(ours, theirs day) day {
+	return func(ours, theirs day) day {
+		if mode == MergeNewer {
+			if oursNewer {
+				return ours
+			}
+			return theirs
+		}
+		return day{max(ours.count, theirs.count), true}
+	}
+}
+
+// mergeContributionFiles merges a single-file contribution file
+func mergeContributionFiles(path string, rawBase, rawOurs, rawTheirs []byte, mode MergeMode) ([]byte, error) {
+	var base, ours, theirs ContributionData
+	for _, side := range []struct {
+		raw  []byte
+		data *ContributionData
+	}{{rawBase, &base}, {rawOurs, &ours}, {rawTheirs, &theirs}} {
+		if err := decodeSide(path, side.raw, side.data); err != nil {
+			return nil, err
+		}
+	}
+
+	newer, older := &ours, &theirs
+	if theirs.LastUpdated.After(ours.LastUpdated) {
+		newer, older = &theirs, &ours
+	}
+	merged := *newer
+	merged.SchemaVersion = max(ours.SchemaVersion, theirs.SchemaVersion)
+	merged.Contributions = mergeDays(base.Contributions, ours.Contributions, theirs.Contributions,
+		dayResolver(mode, newer == &ours))
+	if newer.Provenance != nil && older.Provenance != nil {
+		p := *newer.Provenance
+		p.Merge(older.Provenance)
+		merged.Provenance = &p
+	}
+	if err := resignMerged(&merged, &ours, &theirs); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.MarshalIndent(&merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	if err := validateContributionData(path, encoded, &merged, name, time.Now()); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// resignMerged keeps a merged file's signature valid where possible: a merge
+// equal to one side keeps that side's signature, and a merge of a file this
+// clone signed is signed again with its key. Any other merge is left unsigned
+// until its signer writes it again, as an old signature would not verify.
+func resignMerged(merged, ours, theirs *ContributionData) error {
+	mergedBytes, err := signedBytes(merged)
+	if err != nil {
+		return err
+	}
+	merged.Signature = nil
+	for _, side := range []*ContributionData{ours, theirs} {
+		sideBytes, err := signedBytes(side)
+		if err != nil {
+			return err
+		}
+		if string(sideBytes) == string(mergedBytes) {
+			merged.Signature = side.Signature
+			return nil
+		}
+	}
+
+	key, err := localSigningKey()
+	if err != nil || key == nil {
+		return err
+	}
+	for _, side := range []*ContributionData{ours, theirs} {
+		if s := side.Signature; s != nil && s.Key == KeyFingerprint(key.Public().(ed25519.PublicKey)) {
+			return signContribution(merged, s.Signer, key)
+		}
+	}
+	return nil
+}
+
+// mergeYearFiles merges one year of a sharded account
+func mergeYearFiles(path string, rawBase, rawOurs, rawTheirs []byte, mode MergeMode) ([]byte, error) {
+	var base, ours, theirs yearFile
+	for _, side := range []struct {
+		raw  []byte
+		data *yearFile
+	}{{rawBase, &base}, {rawOurs, &ours}, {rawTheirs, &theirs}} {
+		if err := decodeSide(path, side.raw, side.data); err != nil {
+			return nil, err
+		}
+	}
+	if ours.Username != theirs.Username || ours.Year != theirs.Year {
+		return nil, fmt.Errorf("%s: the two sides are different accounts or years", path)
+	}
+
+	merged := ours
+	// Year files carry no update time; the higher count wins either way.
+	merged.Contributions = mergeDays(base.Contributions, ours.Contributions, theirs.Contributions, dayResolver(MergeMax, true))
+	merged.Checksum = ""
+	if ours.Checksum != "" || theirs.Checksum != "" {
+		merged.Checksum = yearChecksum(merged.Contributions)
+	}
+	return json.MarshalIndent(&merged, "", "  ")
+}
+
+// mergeAccountFiles merges a sharded account's account.json by keeping the
+// side updated last; its contributions are merged in the year files
+func mergeAccountFiles(path string, rawOurs, rawTheirs []byte) ([]byte, error) {
+	ours, theirs := &ContributionData{}, &ContributionData{}
+	if err := decodeSide(path, rawOurs, &accountFile{ContributionData: ours}); err != nil {
+		return nil, err
+	}
+	if err := decodeSide(path, rawTheirs, &accountFile{ContributionData: theirs}); err != nil {
+		return nil, err
+	}
+	newer, older := ours, theirs
+	if theirs.LastUpdated.After(ours.LastUpdated) {
+		newer, older = theirs, ours
+	}
+	if newer.Provenance != nil && older.Provenance != nil {
+		newer.Provenance.Merge(older.Provenance)
+	}
+	// The signature covers the contributions in the year files, which are
+	// merged separately and can't be seen from here, so the newer side's no
+	// longer matches. The account's next sync signs the merged file again.
+	newer.Signature = nil
+	return json.MarshalIndent(accountFile{ContributionData: newer}, "", "  ")
+}
+
+// mergeStateFiles merges a sync state file. Each side's increase over base
+// in a mirrored count stands for mirror commits it created, and both sides'
+// commits are in the merged history, so the increases add up.
+func mergeStateFiles(path string, rawBase, rawOurs, rawTheirs []byte) ([]byte, error) {
+	var base, ours, theirs SyncState
+	for _, side := range []struct {
+		raw  []byte
+		data *SyncState
+	}{{rawBase, &base}, {rawOurs, &ours}, {rawTheirs, &theirs}} {
+		if err := decodeSide(path, side.raw, side.data); err != nil {
+			return nil, err
+		}
+	}
+
+	merged := ours
+	merged.SchemaVersion = max(ours.SchemaVersion, theirs.SchemaVersion)
+	if theirs.LastSync.After(ours.LastSync) {
+		merged.LastSync = theirs.LastSync
+	}
+	if filtersEqual(ours.Filters, base.Filters) {
+		merged.Filters = theirs.Filters
+	}
+
+	merged.MirroredCounts = mergeSourceCounts(base.MirroredCounts, ours.MirroredCounts, theirs.MirroredCounts)
+	if healed := mergeSourceCounts(base.HealedCounts, ours.HealedCounts, theirs.HealedCounts); len(healed) > 0 {
+		merged.HealedCounts = healed
+	} else {
+		merged.HealedCounts = nil
+	}
+	// Own counts only ever grow, so the larger of the two sides is the newer.
+	merged.OwnCounts = nil
+	for _, counts := range []map[string]int{ours.OwnCounts, theirs.OwnCounts} {
+		for date, count := range counts {
+			if count > merged.OwnCounts[date] {
+				if merged.OwnCounts == nil {
+					merged.OwnCounts = make(map[string]int)
+				}
+				merged.OwnCounts[date] = count
+			}
+		}
+	}
+	return json.MarshalIndent(&merged, "", "  ")
+}
+
+// mergeSourceCounts merges per-source, per-date commit counts: each side's
+// commits since base are added, since both sides created them. A source that
+// either side removed since base stays removed, so a merge never brings back
+// an account that 'vanity remove-source' dropped.
+func mergeSourceCounts(base, ours, theirs map[string]map[string]int) map[string]map[string]int {
+	merged := make(map[string]map[string]int)
+	for _, counts := range []map[string]map[string]int{base, ours, theirs} {
+		for source, dates := range counts {
+			if _, inBase := base[source]; inBase {
+				_, inOurs := ours[source]
+				_, inTheirs := theirs[source]
+				if !inOurs || !inTheirs {
+					continue
+				}
+			}
+			for date := range dates {
+				count := ours[source][date] + theirs[source][date] - base[source][date]
+				if count <= 0 {
+					continue
+				}
+				if merged[source] == nil {
+					merged[source] = make(map[string]int)
+				}
+				merged[source][date] = count
+			}
+		}
+	}
+	return merged
+}
+
+func filtersEqual(a, b *MirrorFilter) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// ParseDriverPreference parses the merge driver's preference for days both
+// sides changed
+func ParseDriverPreference(s string) (MergeMode, error) {
+	mode, err := ParseMergeMode(s)
+	if err != nil || (mode != MergeMax && mode != MergeNewer) {
+		return "", fmt.Errorf("invalid preference %q (want max or newer)", s)
+	}
+	return mode, nil
+}
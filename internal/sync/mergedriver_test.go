@@ -0,0 +1,236 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runMergeDriver writes the three sides of a merge of path to temp files,
+// runs the driver and returns the merged ours
+func runMergeDriver(t *testing.T, path, base, ours, theirs string, mode MergeMode) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]string, 3)
+	for i, contents := range []string{base, ours, theirs} {
+		files[i] = filepath.Join(dir, []string{"base", "ours", "theirs"}[i])
+		if err := os.WriteFile(files[i], []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MergeVanityFile(files[0], files[1], files[2], path, mode); err != nil {
+		t.Fatalf("MergeVanityFile(%s) error = %v", path, err)
+	}
+	merged, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return merged
+}
+
+func TestMergeDriverMergesContributionsByDate(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	base := `{"username":"bob","last_updated":"2024-03-01T00:00:00Z","contributions":[
+		{"date":"2024-01-01","count":1},{"date":"2024-01-02","count":2},{"date":"2024-01-03","count":3}]}`
+	ours := `{"username":"bob","last_updated":"2024-03-02T00:00:00Z","contributions":[
+		{"date":"2024-01-01","count":5},{"date":"2024-01-02","count":2},{"date":"2024-01-03","count":4}]}`
+	theirs := `{"username":"bob","last_updated":"2024-03-03T00:00:00Z","contributions":[
+		{"date":"2024-01-02","count":2},{"date":"2024-01-03","count":6},{"date":"2024-01-04","count":1}]}`
+
+	withWorkingDirectory(t, repo, func() {
+		for _, tt := range []struct {
+			mode MergeMode
+			want []Contribution
+		}{
+			// Ours raised day 1 and theirs dropped it, and both raised day 3;
+			// day 4 is only new in theirs.
+			{MergeMax, []Contribution{{"2024-01-01", 5}, {"2024-01-02", 2}, {"2024-01-03", 6}, {"2024-01-04", 1}}},
+			{MergeNewer, []Contribution{{"2024-01-02", 2}, {"2024-01-03", 6}, {"2024-01-04", 1}}},
+		} {
+			merged := runMergeDriver(t, ".vanity/bob.json", base, ours, theirs, tt.mode)
+			var data ContributionData
+			if err := json.Unmarshal(merged, &data); err != nil {
+				t.Fatalf("merged file is not JSON: %v\n%s", err, merged)
+			}
+			if !reflect.DeepEqual(data.Contributions, tt.want) {
+				t.Errorf("%s merge = %v, want %v", tt.mode, data.Contributions, tt.want)
+			}
+			if data.LastUpdated.Format("2006-01-02") != "2024-03-03" {
+				t.Errorf("%s merge kept last_updated %v, want the newer side's", tt.mode, data.LastUpdated)
+			}
+		}
+	})
+}
+
+func TestMergeDriverAddsStateIncreases(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	base := `{"last_sync":"2024-03-01T00:00:00Z","mirrored_counts":{"bob":{"2024-01-01":2}}}`
+	ours := `{"last_sync":"2024-03-02T00:00:00Z","mirrored_counts":{"bob":{"2024-01-01":3},"carol":{"2024-01-05":1}}}`
+	theirs := `{"last_sync":"2024-03-03T00:00:00Z","mirrored_counts":{"bob":{"2024-01-01":4}}}`
+
+	withWorkingDirectory(t, repo, func() {
+		merged := runMergeDriver(t, ".vanity/alice-state.json", base, ours, theirs, MergeMax)
+		var state SyncState
+		if err := json.Unmarshal(merged, &state); err != nil {
+			t.Fatalf("merged state is not JSON: %v\n%s", err, merged)
+		}
+		if got := state.GetMirroredCount("bob", "2024-01-01"); got != 5 {
+			t.Errorf("bob 2024-01-01 = %d, want 2 + 1 + 2", got)
+		}
+		if got := state.GetMirroredCount("carol", "2024-01-05"); got != 1 {
+			t.Errorf("carol 2024-01-05 = %d, want 1", got)
+		}
+		if state.LastSync.Format("2006-01-02") != "2024-03-03" {
+			t.Errorf("last_sync = %v, want the later one", state.LastSync)
+		}
+	})
+}
+
+func TestMergeDriverKeepsRemovedSourcesRemoved(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	base := `{"mirrored_counts":{"bob":{"2024-01-01":2},"dave":{"2024-01-01":1}},"healed_counts":{"dave":{"2024-01-02":1}}}`
+	ours := `{"mirrored_counts":{"bob":{"2024-01-01":2}}}`
+	theirs := `{"mirrored_counts":{"bob":{"2024-01-01":2},"dave":{"2024-01-01":3}},"healed_counts":{"dave":{"2024-01-02":2}}}`
+
+	withWorkingDirectory(t, repo, func() {
+		merged := runMergeDriver(t, ".vanity/alice-state.json", base, ours, theirs, MergeMax)
+		var state SyncState
+		if err := json.Unmarshal(merged, &state); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := state.MirroredCounts["dave"]; ok {
+			t.Errorf("mirrored counts = %v, want the removed dave to stay removed", state.MirroredCounts)
+		}
+		if len(state.HealedCounts) != 0 {
+			t.Errorf("healed counts = %v, want the removed dave to stay removed", state.HealedCounts)
+		}
+		if got := state.GetMirroredCount("bob", "2024-01-01"); got != 2 {
+			t.Errorf("bob 2024-01-01 = %d, want 2", got)
+		}
+	})
+}
+
+func TestMergeDriverMergesSourcesManifest(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	base := "[source \"bob\"]\n\tmethod = api\n[source \"dave\"]\n\tmethod = api\n"
+	ours := base + "[source \"carol\"]\n\tmethod = scrape\n"
+	theirs := "[source \"bob\"]\n\tmethod = scrape\n[source \"dave\"]\n\tmethod = api\n"
+
+	withWorkingDirectory(t, repo, func() {
+		merged := runMergeDriver(t, ".vanity/sources", base, ours, theirs, MergeMax)
+		want := theirs + "[source \"carol\"]\n\tmethod = scrape\n"
+		if string(merged) != want {
+			t.Errorf("merged manifest = %q, want %q", merged, want)
+		}
+
+		conflicting := "[source \"bob\"]\n\tmethod = other\n[source \"dave\"]\n\tmethod = api\n"
+		if err := MergeVanityFile(writeSide(t, base), writeSide(t, theirs), writeSide(t, conflicting), ".vanity/sources", MergeMax); err == nil {
+			t.Error("MergeVanityFile() merged conflicting manifest changes")
+		}
+	})
+}
+
+// writeSide writes one side of a merge to a temp file
+func writeSide(t *testing.T, contents string) string {
+	t.Helper()
+	f := filepath.Join(t.TempDir(), "side")
+	if err := os.WriteFile(f, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestMergeDriverDropsStaleAccountSignature(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	account := func(updated string) string {
+		return fmt.Sprintf(`{"schema_version":%d,"username":"bob","last_updated":%q,
+			"signature":{"signer":"bob","key":"abcd","value":"c2ln"}}`, shardedSchemaVersion, updated)
+	}
+
+	withWorkingDirectory(t, repo, func() {
+		merged := runMergeDriver(t, ".vanity/bob/account.json",
+			account("2024-03-01T00:00:00Z"), account("2024-03-02T00:00:00Z"), account("2024-03-03T00:00:00Z"), MergeMax)
+		if strings.Contains(string(merged), "signature") {
+			t.Errorf("merged account file kept a signature over unmerged years:\n%s", merged)
+		}
+	})
+}
+
+func TestMergeDriverKeepsYearChecksumsValid(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	year := func(contribs string, checksum bool) string {
+		var list []Contribution
+		_ = json.Unmarshal([]byte(contribs), &list)
+		f := yearFile{SchemaVersion: shardedSchemaVersion, Username: "bob", Year: 2023, Contributions: list}
+		if checksum {
+			f.Checksum = yearChecksum(list)
+		}
+		raw, _ := json.Marshal(f)
+		return string(raw)
+	}
+
+	withWorkingDirectory(t, repo, func() {
+		merged := runMergeDriver(t, ".vanity/bob/2023.json",
+			year(`[{"date":"2023-05-01","count":1}]`, true),
+			year(`[{"date":"2023-05-01","count":2}]`, true),
+			year(`[{"date":"2023-05-01","count":1},{"date":"2023-05-02","count":1}]`, true), MergeMax)
+		var f yearFile
+		if err := json.Unmarshal(merged, &f); err != nil {
+			t.Fatal(err)
+		}
+		want := []Contribution{{"2023-05-01", 2}, {"2023-05-02", 1}}
+		if !reflect.DeepEqual(f.Contributions, want) || f.Checksum != yearChecksum(want) {
+			t.Errorf("merged year = %+v, want %v with a matching checksum", f, want)
+		}
+	})
+}
+
+func TestMergeDriverRefusesInvalidResult(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		dir := t.TempDir()
+		for _, name := range []string{"base", "ours", "theirs"} {
+			_ = os.WriteFile(filepath.Join(dir, name), []byte(`{"username":"carol","contributions":[]}`), 0644)
+		}
+		err := MergeVanityFile(filepath.Join(dir, "base"), filepath.Join(dir, "ours"), filepath.Join(dir, "theirs"), ".vanity/bob.json", MergeMax)
+		if err == nil {
+			t.Error("merged a file whose username doesn't match its name")
+		}
+	})
+}
+
+func TestInstallMergeDriver(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		for i := 0; i < 2; i++ {
+			if err := InstallMergeDriver(); err != nil {
+				t.Fatalf("InstallMergeDriver() error = %v", err)
+			}
+		}
+		attributes, _ := os.ReadFile(filepath.Join(".git", "info", "attributes"))
+		if strings.Count(string(attributes), "merge=vanity") != 4 {
+			t.Errorf("attributes after two installs:\n%s", attributes)
+		}
+		for path, want := range map[string]string{
+			".vanity/bob.json":         "vanity",
+			".vanity/bob/2024.json":    "vanity",
+			".vanity/alice-state.json": "vanity",
+			".vanity/sources":          "vanity",
+			".vanity/departures":       "vanity",
+			".vanity/keys/alice.pub":   "union",
+			"README.md":                "unspecified",
+		} {
+			out := runGit(t, repo, "check-attr", "merge", "--", path)
+			if !strings.HasSuffix(strings.TrimSpace(out), ": "+want) {
+				t.Errorf("merge attribute of %s = %q, want %s", path, out, want)
+			}
+		}
+		if driver := runGit(t, repo, "config", "merge.vanity.driver"); strings.TrimSpace(driver) != mergeDriverCommand {
+			t.Errorf("merge.vanity.driver = %q", driver)
+		}
+	})
+}
@@ -0,0 +1,399 @@
+package sync
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// In opaque mode every account is known in the shared repo only by a salted
+// pseudonym. The salt is shared between collaborators out of band and kept in
+// each clone's local config, alongside the pseudonyms this clone has resolved.
+const (
+	opaqueSaltKey     = "opaque.salt"
+	pseudonymSection  = "pseudonym"
+	opaqueMarkerFile  = "opaque" // in .vanity/; holds a check value for the salt
+	pseudonymPrefix   = "v-"
+	pseudonymHexChars = 12
+	opaqueCheckInput  = "vanity opaque check"
+)
+
+var pseudonymPattern = regexp.MustCompile(`^v-[0-9a-f]{12}$`)
+
+// Naming maps account logins to the names vanity writes to the shared repo:
+// .vanity/ file names, sync state keys and mirror commit messages. A nil
+// Naming is plain mode, where the login itself is used.
+type Naming struct {
+	salt []byte
+}
+
+// LoadNaming returns the naming this clone must use. It fails when the repo
+// has switched to opaque mode but this clone has no salt, or the wrong one,
+// since writing under any other name would mirror accounts twice.
+func LoadNaming() (*Naming, error) {
+	saltHex, err := config.Get(opaqueSaltKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", opaqueSaltKey, err)
+	}
+	marker, err := os.ReadFile(filepath.Join(vanityDir, opaqueMarkerFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read opaque marker: %w", err)
+	}
+	repoIsOpaque := err == nil
+
+	if saltHex == "" {
+		if repoIsOpaque {
+			return nil, fmt.Errorf("this repository uses pseudonymous names; get the salt from a collaborator ('vanity opaque salt') and run 'vanity opaque enable --salt <salt>'")
+		}
+		return nil, nil
+	}
+
+	n, err := newNaming(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	if !repoIsOpaque {
+		return nil, fmt.Errorf("%s is set but this repository is not in opaque mode; run 'vanity opaque enable' to migrate it", opaqueSaltKey)
+	}
+	if strings.TrimSpace(string(marker)) != n.check() {
+		return nil, fmt.Errorf("%s does not match the salt this repository was migrated with", opaqueSaltKey)
+	}
+	return n, nil
+}
+
+func newNaming(saltHex string) (*Naming, error) {
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil || len(salt) < 16 {
+		return nil, fmt.Errorf("invalid %s (want at least 32 hex characters)", opaqueSaltKey)
+	}
+	return &Naming{salt: salt}, nil
+}
+
+// loadNaming picks up the repo's naming before any file is read. In opaque
+// mode, --scale multipliers given by login are rekeyed to pseudonyms.
+func (e *Engine) loadNaming() error {
+	naming, err := LoadNaming()
+	if err != nil {
+		return err
+	}
+	e.naming = naming
+	if !naming.Opaque() {
+		return nil
+	}
+
+	if err := naming.Remember(e.username); err != nil {
+		return fmt.Errorf("failed to record pseudonym: %w", err)
+	}
+	scales := make(map[string]float64, len(e.scales))
+	for source, scale := range e.scales {
+		scales[naming.Name(source)] = scale
+	}
+	e.scales = scales
+	return nil
+}
+
+// self is the name the current account is stored under
+func (e *Engine) self() string {
+	return e.naming.Name(e.username)
+}
+
+// Opaque reports whether names are pseudonyms
+func (n *Naming) Opaque() bool {
+	return n != nil
+}
+
+// Name returns the name login is stored under. A name that is already stored
+// as a pseudonym is returned as it is, so commands accept either; a login that
+// merely looks like a pseudonym is still hashed.
+func (n *Naming) Name(login string) string {
+	if n == nil || n.isStored(login) {
+		return login
+	}
+	return n.pseudonym(login)
+}
+
+func (n *Naming) pseudonym(login string) string {
+	return pseudonymPrefix + hex.EncodeToString(n.mac(strings.ToLower(login)))[:pseudonymHexChars]
+}
+
+// isStored reports whether name is a pseudonym in use in this repo: one this
+// clone has resolved, or one an account is stored under
+func (n *Naming) isStored(name string) bool {
+	if !IsPseudonym(name) {
+		return false
+	}
+	if _, known := n.Login(name); known {
+		return true
+	}
+	if hasContributionData(name) {
+		return true
+	}
+	for _, path := range []string{filepath.Join(vanityDir, name+"-state.json"), keysPath(name)} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Login returns the login behind a stored pseudonym, when this clone knows it
+func (n *Naming) Login(name string) (string, bool) {
+	if n == nil || !IsPseudonym(name) {
+		return "", false
+	}
+	login, err := config.Get(pseudonymSection + "." + name)
+	if err != nil || login == "" {
+		return "", false
+	}
+	return login, true
+}
+
+// Display returns the login behind a stored name when this clone knows it,
+// and the stored name otherwise
+func (n *Naming) Display(name string) string {
+	if login, known := n.Login(name); known {
+		return login
+	}
+	return name
+}
+
+// Remember records which login a pseudonym stands for in local config, so
+// later output can show the login. It does nothing in plain mode.
+func (n *Naming) Remember(login string) error {
+	if n == nil {
+		return nil
+	}
+	return config.Set(pseudonymSection+"."+n.pseudonym(login), login)
+}
+
+// IsPseudonym reports whether a stored name has the form of a pseudonym. A
+// GitHub login can have that form too; Naming.Name tells them apart.
+func IsPseudonym(name string) bool {
+	return pseudonymPattern.MatchString(name)
+}
+
+// selfMessage is the subject of a commit about the current account. Its
+// author already names the account, so in opaque mode the subject leaves the
+// pseudonym out rather than link the two.
+func (e *Engine) selfMessage(plain, opaque string) string {
+	if e.naming.Opaque() {
+		return opaque
+	}
+	return fmt.Sprintf(plain, e.self())
+}
+
+func (n *Naming) mac(input string) []byte {
+	h := hmac.New(sha256.New, n.salt)
+	h.Write([]byte(input))
+	return h.Sum(nil)
+}
+
+// check is written to the opaque marker so clones with a different salt are
+// refused. It reveals nothing about the salt or any login.
+func (n *Naming) check() string {
+	return hex.EncodeToString(n.mac(opaqueCheckInput))[:16]
+}
+
+// OpaqueSalt returns this clone's salt, or an empty string in plain mode
+func OpaqueSalt() (string, error) {
+	return config.Get(opaqueSaltKey)
+}
+
+// EnableOpaque switches this clone to opaque mode. If the repo is already in
+// opaque mode, saltHex must be its salt; otherwise every file in .vanity/ is
+// renamed and rewritten under pseudonyms (with a new salt when saltHex is
+// empty) and the result is committed. It returns the salt and how many
+// accounts were migrated.
+func EnableOpaque(saltHex string) (string, int, error) {
+	if _, err := os.Stat(filepath.Join(vanityDir, opaqueMarkerFile)); err == nil {
+		if saltHex == "" {
+			return "", 0, fmt.Errorf("this repository already uses pseudonymous names; pass the group salt with --salt")
+		}
+		if err := config.Set(opaqueSaltKey, saltHex); err != nil {
+			return "", 0, err
+		}
+		if _, err := LoadNaming(); err != nil {
+			_ = config.Unset(opaqueSaltKey, "")
+			return "", 0, err
+		}
+		return saltHex, 0, nil
+	}
+
+	// A collaborator may have migrated already; migrating again here would
+	// collide with their renames.
+	if upstream := git.Upstream(); upstream != "" {
+		if err := git.Fetch(); err != nil {
+			return "", 0, fmt.Errorf("fetch failed: %w", err)
+		}
+		if git.PathExistsAt(upstream, filepath.ToSlash(filepath.Join(vanityDir, opaqueMarkerFile))) {
+			return "", 0, fmt.Errorf("%s is already in opaque mode; run 'vanity sync' to bring in the migration, then 'vanity opaque enable --salt <salt>'", upstream)
+		}
+	}
+
+	if saltHex == "" {
+		salt := make([]byte, 16)
+		if _, err := cryptorand.Read(salt); err != nil {
+			return "", 0, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		saltHex = hex.EncodeToString(salt)
+	}
+	n, err := newNaming(saltHex)
+	if err != nil {
+		return "", 0, err
+	}
+
+	migrated, err := migrateToOpaque(n)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := config.Set(opaqueSaltKey, saltHex); err != nil {
+		return "", 0, err
+	}
+	if err := git.Add("-A", vanityDir); err != nil {
+		return "", 0, fmt.Errorf("failed to stage migration: %w", err)
+	}
+	if git.HasUncommittedChanges() {
+		if err := git.Commit("vanity: switch to pseudonymous names"); err != nil {
+			return "", 0, fmt.Errorf("failed to commit migration: %w", err)
+		}
+	}
+	return saltHex, migrated, nil
+}
+
+// migrateToOpaque rewrites every contribution and state file in .vanity/
+// under pseudonyms and writes the opaque marker
+func migrateToOpaque(n *Naming) (int, error) {
+	entries, err := os.ReadDir(vanityDir)
+	if err != nil {
+		return 0, err
+	}
+
+	logins := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		var login string
+		switch {
+		case entry.IsDir() && hasContributionData(name):
+			login = name
+		case strings.HasSuffix(name, ".json"):
+			login = strings.TrimSuffix(strings.TrimSuffix(name, ".json"), "-state")
+		default:
+			continue
+		}
+		// Accounts migrated by an earlier, interrupted attempt were remembered.
+		if _, migrated := n.Login(login); !migrated {
+			logins[login] = true
+		}
+	}
+
+	for login := range logins {
+		if err := migrateAccountFiles(n, login); err != nil {
+			return 0, fmt.Errorf("failed to migrate %s: %w", login, err)
+		}
+		if err := n.Remember(login); err != nil {
+			return 0, err
+		}
+	}
+
+	marker := filepath.Join(vanityDir, opaqueMarkerFile)
+	if err := os.WriteFile(marker, []byte(n.check()+"\n"), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write opaque marker: %w", err)
+	}
+	return len(logins), nil
+}
+
+// migrateAccountFiles moves one account's contribution, state and key files to its
+// pseudonym, renaming the sources its state refers to as well
+func migrateAccountFiles(n *Naming, login string) error {
+	pseudonym := n.pseudonym(login)
+
+	if hasContributionData(login) {
+		data, err := LoadContributionData(login)
+		if err != nil {
+			return err
+		}
+		data.Username = pseudonym
+		// The signature covers the old name; the owner's next sync signs again.
+		data.Signature = nil
+		if p := data.Provenance; p != nil {
+			if p.ImportedBy != "" {
+				p.ImportedBy = n.Name(p.ImportedBy)
+			}
+			if a := p.Attestation; a != nil {
+				a.AttestedBy = n.Name(a.AttestedBy)
+				a.Proof = "" // a gist URL names the account
+			}
+		}
+		if err := SaveContributionData(data); err != nil {
+			return err
+		}
+		if err := removeContributionData(login); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(keysPath(login)); err == nil {
+		if err := os.Rename(keysPath(login), keysPath(pseudonym)); err != nil {
+			return err
+		}
+	}
+
+	statePath := filepath.Join(vanityDir, login+"-state.json")
+	if _, err := os.Stat(statePath); err == nil {
+		state, err := LoadSyncState(login)
+		if err != nil {
+			return err
+		}
+		state.Username = pseudonym
+		state.renameSources(n)
+		if err := SaveSyncState(state); err != nil {
+			return err
+		}
+		if err := os.Remove(statePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameSources rekeys mirrored counts and filters by the stored names of
+// their sources
+func (s *SyncState) renameSources(n *Naming) {
+	counts := make(map[string]map[string]int, len(s.MirroredCounts))
+	for source, dates := range s.MirroredCounts {
+		counts[n.Name(source)] = dates
+	}
+	s.MirroredCounts = counts
+	if s.HealedCounts != nil {
+		healed := make(map[string]map[string]int, len(s.HealedCounts))
+		for source, dates := range s.HealedCounts {
+			healed[n.Name(source)] = dates
+		}
+		s.HealedCounts = healed
+	}
+
+	if s.Filters == nil {
+		return
+	}
+	for i, source := range s.Filters.Skip {
+		s.Filters.Skip[i] = n.Name(source)
+	}
+	sort.Strings(s.Filters.Skip)
+	if s.Filters.Windows != nil {
+		windows := make(map[string]DateWindow, len(s.Filters.Windows))
+		for source, w := range s.Filters.Windows {
+			windows[n.Name(source)] = w
+		}
+		s.Filters.Windows = windows
+	}
+}
@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/config"
+)
+
+const testSalt = "000102030405060708090a0b0c0d0e0f"
+
+func TestNamingPseudonyms(t *testing.T) {
+	n, err := newNaming(testSalt)
+	if err != nil {
+		t.Fatalf("newNaming() error = %v", err)
+	}
+
+	alice := n.Name("alice")
+	if !IsPseudonym(alice) {
+		t.Fatalf("Name(alice) = %q, want a pseudonym", alice)
+	}
+	if n.Name("Alice") != alice {
+		t.Error("pseudonyms differ by login case")
+	}
+	withWorkingDirectory(t, initTestRepo(t, "main"), func() {
+		// A login of the pseudonym form is an account of its own until it is
+		// known to be a stored name.
+		if n.Name(alice) == alice {
+			t.Error("a login that looks like a pseudonym was taken for one")
+		}
+		if err := n.Remember("alice"); err != nil {
+			t.Fatalf("Remember() error = %v", err)
+		}
+		if n.Name(alice) != alice {
+			t.Error("a pseudonym was renamed again")
+		}
+	})
+	if n.Name("bob") == alice {
+		t.Error("alice and bob share a pseudonym")
+	}
+
+	other, _ := newNaming("ff" + testSalt[2:])
+	if other.Name("alice") == alice {
+		t.Error("different salts gave the same pseudonym")
+	}
+
+	var plain *Naming
+	if plain.Name("alice") != "alice" || plain.Display("alice") != "alice" {
+		t.Error("plain mode changed a login")
+	}
+	if _, err := newNaming("abc"); err == nil {
+		t.Error("newNaming() accepted a short salt")
+	}
+}
+
+func TestMigrateToOpaque(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[{"date":"2024-01-01","count":2}]}`)
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/alice-state.json", `{"username":"alice",
+		"mirrored_counts":{"bob":{"2024-01-02":3}},
+		"filters":{"skip":["carol"],"windows":{"bob":{"to":"2024-06-30"}}}}`)
+
+	withWorkingDirectory(t, repo, func() {
+		n, _ := newNaming(testSalt)
+		migrated, err := migrateToOpaque(n)
+		if err != nil {
+			t.Fatalf("migrateToOpaque() error = %v", err)
+		}
+		if migrated != 2 {
+			t.Errorf("migrated %d accounts, want 2", migrated)
+		}
+
+		users, err := ListSyncedUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{n.Name("alice"), n.Name("bob")}
+		if want[0] > want[1] {
+			want[0], want[1] = want[1], want[0]
+		}
+		if !reflect.DeepEqual(users, want) {
+			t.Errorf("ListSyncedUsers() = %v, want %v", users, want)
+		}
+
+		data, err := LoadContributionData(n.Name("alice"))
+		if err != nil || data.Username != n.Name("alice") || len(data.Contributions) != 1 {
+			t.Errorf("alice's contribution file = %+v, %v", data, err)
+		}
+
+		state, err := LoadSyncState(n.Name("alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.GetMirroredCount(n.Name("bob"), "2024-01-02") != 3 {
+			t.Errorf("mirrored counts = %v, want bob's under his pseudonym", state.MirroredCounts)
+		}
+		if !state.Filters.SkipsSource(n.Name("carol")) {
+			t.Errorf("skip list = %v, want carol's pseudonym", state.Filters.Skip)
+		}
+		if _, ok := state.Filters.Windows[n.Name("bob")]; !ok {
+			t.Errorf("windows = %v, want bob's under his pseudonym", state.Filters.Windows)
+		}
+
+		// Nothing in .vanity/ may still name an account.
+		entries, _ := os.ReadDir(vanityDir)
+		for _, entry := range entries {
+			contents, _ := os.ReadFile(vanityDir + "/" + entry.Name())
+			for _, login := range []string{"alice", "bob", "carol"} {
+				if strings.Contains(entry.Name(), login) || strings.Contains(string(contents), login) {
+					t.Errorf("%s still names %s", entry.Name(), login)
+				}
+			}
+		}
+
+		if n.Display(n.Name("bob")) != "bob" {
+			t.Errorf("Display() = %q, want the remembered login", n.Display(n.Name("bob")))
+		}
+	})
+}
+
+func TestLoadNamingRefusesMismatchedClones(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	n, _ := newNaming(testSalt)
+	writeTestFile(t, repo, ".vanity/opaque", n.check()+"\n")
+
+	withWorkingDirectory(t, repo, func() {
+		if _, err := LoadNaming(); err == nil || !strings.Contains(err.Error(), "uses pseudonymous names") {
+			t.Errorf("LoadNaming() without a salt error = %v, want a request for the salt", err)
+		}
+
+		if err := config.Set(opaqueSaltKey, "ff"+testSalt[2:]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadNaming(); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("LoadNaming() with the wrong salt error = %v, want a mismatch", err)
+		}
+
+		if err := config.Set(opaqueSaltKey, testSalt); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := LoadNaming(); err != nil || !got.Opaque() {
+			t.Errorf("LoadNaming() = %v, %v; want opaque naming", got, err)
+		}
+	})
+}
+
+func TestSelfMessageLeavesPseudonymOut(t *testing.T) {
+	n, _ := newNaming(testSalt)
+	plain := &Engine{username: "alice"}
+	opaque := &Engine{username: "alice", naming: n}
+
+	if got := plain.selfMessage("vanity: sync %s", "vanity: sync"); got != "vanity: sync alice" {
+		t.Errorf("plain selfMessage() = %q, want the login", got)
+	}
+	if got := opaque.selfMessage("vanity: sync %s", "vanity: sync"); got != "vanity: sync" {
+		t.Errorf("opaque selfMessage() = %q, want no name", got)
+	}
+}
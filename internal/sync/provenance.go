@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// SourceKind is how the contributions in a file were obtained
+type SourceKind string
+
+const (
+	SourceSync   SourceKind = "sync"   // the account's own 'vanity sync'
+	SourceAPI    SourceKind = "api"    // 'vanity import' through the GitHub API
+	SourceScrape SourceKind = "scrape" // 'vanity import --scrape' from the profile page
+)
+
+// StaleAfter is how old a contribution file may get before it is reported as
+// stale
+const StaleAfter = 30 * 24 * time.Hour
+
+// Provenance records where a contribution file came from
+type Provenance struct {
+	Kind            SourceKind   `json:"kind,omitempty"`
+	Host            string       `json:"host,omitempty"`
+	From            string       `json:"from,omitempty"` // first day the fetches covered
+	To              string       `json:"to,omitempty"`   // day of the latest fetch
+	ImportedBy      string       `json:"imported_by,omitempty"`
+	ToolVersion     string       `json:"tool_version,omitempty"`
+	IncludesPrivate bool         `json:"includes_private"`
+	Attestation     *Attestation `json:"attestation,omitempty"`
+}
+
+// NewProvenance describes contributions just fetched by kind, covering the
+// days from the earliest fetched one to today. private is whether the fetch
+// counted private contributions.
+func NewProvenance(kind SourceKind, host string, fetched []github.Contribution, private bool, now time.Time) *Provenance {
+	p := &Provenance{
+		Kind:            kind,
+		Host:            host,
+		To:              now.Format("2006-01-02"),
+		IncludesPrivate: private,
+	}
+	for _, c := range fetched {
+		if p.From == "" || c.Date < p.From {
+			p.From = c.Date
+		}
+	}
+	return p
+}
+
+// Merge widens p to also describe older data that was merged into the file
+// it describes
+func (p *Provenance) Merge(older *Provenance) {
+	if older.From != "" && (p.From == "" || older.From < p.From) {
+		p.From = older.From
+	}
+	p.IncludesPrivate = p.IncludesPrivate || older.IncludesPrivate
+}
+
+// syncProvenance describes your own file after a sync. Incremental syncs
+// fetch only recent days, so the range starts where the earliest sync did.
+func (e *Engine) syncProvenance(previous *Provenance, fetched []github.Contribution, private bool, now time.Time) *Provenance {
+	p := NewProvenance(SourceSync, github.Host(), fetched, private, now)
+	p.ToolVersion = e.toolVersion
+	if previous != nil && previous.Kind == SourceSync {
+		if previous.From != "" && (p.From == "" || previous.From < p.From) {
+			p.From = previous.From
+		}
+		p.IncludesPrivate = p.IncludesPrivate || previous.IncludesPrivate
+	}
+	return p
+}
+
+// Describe summarizes a contribution file's origin for people, showing
+// account names through naming
+func (p *Provenance) Describe(naming *Naming) string {
+	if p == nil || p.Kind == "" {
+		return "unknown origin"
+	}
+
+	var b strings.Builder
+	switch p.Kind {
+	case SourceSync:
+		b.WriteString("synced by the account itself")
+	case SourceAPI:
+		b.WriteString("imported through the API")
+	case SourceScrape:
+		b.WriteString("imported by scraping the profile")
+	default:
+		fmt.Fprintf(&b, "imported from %s", p.Kind)
+	}
+	if p.Host != "" && p.Host != github.DefaultHost {
+		fmt.Fprintf(&b, " on %s", p.Host)
+	}
+	if p.ImportedBy != "" {
+		fmt.Fprintf(&b, " by %s", naming.Display(p.ImportedBy))
+	}
+	if p.IncludesPrivate {
+		b.WriteString(", private included")
+	} else {
+		b.WriteString(", public only")
+	}
+	if p.From != "" {
+		fmt.Fprintf(&b, ", %s to %s", p.From, p.To)
+	}
+	if p.Attestation != nil {
+		fmt.Fprintf(&b, ", attested via %s", p.Attestation.Method)
+	}
+	if p.ToolVersion != "" {
+		fmt.Fprintf(&b, " (vanity %s)", p.ToolVersion)
+	}
+	return b.String()
+}
+
+// Age describes how long ago a file was last updated
+func Age(updated, now time.Time) string {
+	if updated.IsZero() {
+		return "never updated"
+	}
+	days := int(now.Sub(updated).Hours() / 24)
+	switch {
+	case days <= 0:
+		return "updated today"
+	case days == 1:
+		return "updated yesterday"
+	case now.Sub(updated) > StaleAfter:
+		return fmt.Sprintf("updated %d days ago (stale)", days)
+	}
+	return fmt.Sprintf("updated %d days ago", days)
+}
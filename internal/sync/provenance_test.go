@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+func TestSyncProvenanceKeepsEarliestFrom(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	e := &Engine{toolVersion: "1.2.3"}
+	fetched := []github.Contribution{{Date: "2024-05-30", Count: 1}, {Date: "2024-05-20", Count: 2}}
+
+	p := e.syncProvenance(nil, fetched, true, now)
+	if p.Kind != SourceSync || p.From != "2024-05-20" || p.To != "2024-06-01" || p.ToolVersion != "1.2.3" || !p.IncludesPrivate {
+		t.Errorf("syncProvenance() = %+v", p)
+	}
+
+	// An incremental sync only fetched the last days; the range still
+	// starts at the first sync.
+	previous := &Provenance{Kind: SourceSync, From: "2023-06-01"}
+	if p := e.syncProvenance(previous, fetched, true, now); p.From != "2023-06-01" {
+		t.Errorf("From = %s, want the earlier sync's 2023-06-01", p.From)
+	}
+	// Whether private contributions are counted comes from the fetch.
+	if p := e.syncProvenance(nil, fetched, false, now); p.IncludesPrivate {
+		t.Errorf("IncludesPrivate = true for a fetch without private contributions")
+	}
+	// Provenance of another kind (an earlier import) doesn't carry over.
+	imported := &Provenance{Kind: SourceScrape, From: "2015-01-01"}
+	if p := e.syncProvenance(imported, fetched, true, now); p.From != "2024-05-20" {
+		t.Errorf("From = %s, want only the synced range", p.From)
+	}
+}
+
+func TestProvenanceDescribe(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	p := NewProvenance(SourceAPI, "github.example.com", []github.Contribution{{Date: "2019-03-04", Count: 1}}, false, now)
+	p.ImportedBy = "alice"
+	p.Attestation = &Attestation{Method: AttestGist}
+
+	got := p.Describe(nil)
+	for _, want := range []string{"through the API", "on github.example.com", "by alice", "public only", "2019-03-04 to 2024-06-01", "attested via gist"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Describe() = %q, missing %q", got, want)
+		}
+	}
+	if got := (*Provenance)(nil).Describe(nil); got != "unknown origin" {
+		t.Errorf("Describe() of a file without provenance = %q", got)
+	}
+
+	if got := Age(now.AddDate(0, 0, -45), now); !strings.Contains(got, "stale") {
+		t.Errorf("Age() = %q, want a 45-day-old file called stale", got)
+	}
+	if got := Age(now.Add(-time.Hour), now); got != "updated today" {
+		t.Errorf("Age() = %q", got)
+	}
+}
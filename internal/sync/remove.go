@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// listStateOwners returns the stored names of every account with a sync
+// state file
+func listStateOwners() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(vanityDir, "*-state.json"))
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]string, 0, len(paths))
+	for _, path := range paths {
+		owners = append(owners, strings.TrimSuffix(filepath.Base(path), "-state.json"))
+	}
+	return owners, nil
+}
+
+// forgetSource drops everything a sync state records about source: its
+// mirrored counts and any filter naming it. It reports whether anything was
+// dropped.
+func (s *SyncState) forgetSource(source string) bool {
+	_, changed := s.MirroredCounts[source]
+	delete(s.MirroredCounts, source)
+	delete(s.HealedCounts, source)
+	if f := s.Filters; f != nil {
+		if _, ok := f.Windows[source]; ok {
+			delete(f.Windows, source)
+			changed = true
+		}
+		skip := f.Skip[:0]
+		for _, name := range f.Skip {
+			if name != source {
+				skip = append(skip, name)
+			}
+		}
+		changed = changed || len(skip) != len(f.Skip)
+		f.Skip = skip
+		if f.IsEmpty() {
+			s.Filters = nil
+		}
+	}
+	return changed
+}
+
+// hasManifestEntry reports whether name is listed in the sources manifest
+func hasManifestEntry(name string) (bool, error) {
+	var method string
+	err := withVanityConfig(sourcesPath, false, func(file string) error {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return nil
+		}
+		var err error
+		method, err = git.ConfigFileGet(file, "source."+name+".method")
+		return err
+	})
+	return method != "", err
+}
+
+// removeSourceFiles deletes an account's contributions and manifest entry and
+// drops it from every state file. Files are only deleted once name is known
+// to be an account, by its data or manifest entry. It returns how many
+// mirrored days were dropped.
+func removeSourceFiles(name string) (int, error) {
+	if err := ValidateLogin(name); err != nil {
+		return 0, err
+	}
+	listed, err := hasManifestEntry(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", sourcesPath, err)
+	}
+	if hasContributionData(name) {
+		if err := removeContributionData(name); err != nil {
+			return 0, fmt.Errorf("failed to remove contribution data: %w", err)
+		}
+	}
+	if listed {
+		if err := RemoveSource(name); err != nil {
+			return 0, fmt.Errorf("failed to update %s: %w", sourcesPath, err)
+		}
+	}
+
+	owners, err := listStateOwners()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for _, owner := range owners {
+		state, err := LoadSyncState(owner)
+		if err != nil {
+			return dropped, err
+		}
+		days := len(state.MirroredCounts[name])
+		if !state.forgetSource(name) {
+			continue
+		}
+		if err := SaveSyncState(state); err != nil {
+			return dropped, fmt.Errorf("failed to save %s's sync state: %w", owner, err)
+		}
+		dropped += days
+	}
+	return dropped, nil
+}
+
+// DropSource stops mirroring an account: its contribution data and manifest
+// entry are deleted, every state file forgets it, and the change is
+// committed. With rewriteHistory, every account's mirror commits from it are
+// also rewritten out of the current branch, which is then force-pushed; like
+// a rebuild, that is only allowed in a repository dedicated to syncing.
+func (e *Engine) DropSource(login string, rewriteHistory bool) (err error) {
+	lock, err := acquireLock(e.username)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	if err := e.loadNaming(); err != nil {
+		return err
+	}
+	if err := ValidateLogin(login); err != nil {
+		return err
+	}
+	name := e.naming.Name(login)
+	if name == e.self() {
+		return fmt.Errorf("%s is the account you are syncing as", login)
+	}
+
+	var branch string
+	if rewriteHistory {
+		if branch, err = git.GetCurrentBranch(); err != nil {
+			return fmt.Errorf("failed to get current branch: %w", err)
+		}
+		if branch == "" {
+			return fmt.Errorf("cannot rewrite history from detached HEAD")
+		}
+		if err := ensureDedicatedSyncRepo(); err != nil {
+			return err
+		}
+	}
+	if git.HasUncommittedChanges() {
+		return fmt.Errorf("the working tree has uncommitted changes; commit or stash them first")
+	}
+
+	// Work from the latest remote state, so the removal covers what other
+	// accounts mirrored and a force push drops nothing they pushed.
+	if git.HasRemote() {
+		fmt.Println("Pulling latest changes...")
+		if err := e.integrateRemote(); err != nil {
+			return fmt.Errorf("git pull failed: %w", err)
+		}
+	}
+
+	// Snapshot the branch first, so the removal and any rewrite can be undone
+	// with 'vanity undo'
+	if err := e.recordSnapshot(time.Now()); err != nil {
+		return fmt.Errorf("failed to record snapshot: %w", err)
+	}
+
+	prefix := git.MirrorMessagePrefix + name + " ("
+	mirrorCommits := 0
+	if rewriteHistory {
+		commits, err := git.LogCommits("HEAD")
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+		for _, c := range commits {
+			if strings.HasPrefix(c.Subject, prefix) {
+				mirrorCommits++
+			}
+		}
+	}
+
+	dropped, err := removeSourceFiles(name)
+	if err != nil {
+		return err
+	}
+	removed := git.HasUncommittedChanges()
+	if !removed && mirrorCommits == 0 {
+		return fmt.Errorf("%s is not a source in this repo", login)
+	}
+	if removed {
+		if err := git.Add(".vanity/"); err != nil {
+			return fmt.Errorf("failed to stage changes: %w", err)
+		}
+		if err := git.Commit("vanity: remove source " + name); err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+	}
+	fmt.Printf("Removed %s and %d mirrored day(s) recorded for it\n", login, dropped)
+
+	if !rewriteHistory {
+		fmt.Println("Its mirror commits stay in history; run 'vanity sync' to push the removal.")
+		return nil
+	}
+
+	if mirrorCommits > 0 {
+		fmt.Printf("Rewriting history without %d mirror commit(s) from %s...\n", mirrorCommits, login)
+		if err := git.DropCommits(branch, prefix); err != nil {
+			return fmt.Errorf("failed to rewrite history: %w", err)
+		}
+	}
+	if git.HasRemote() {
+		fmt.Println("Force pushing...")
+		if err := e.forcePushWithLease(); err != nil {
+			return fmt.Errorf("force push failed: %w", err)
+		}
+		fmt.Println("Other clones reset to the rewritten history on their next sync.")
+	}
+	return nil
+}
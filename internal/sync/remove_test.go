@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// commitMirror creates an empty mirror commit from source, backdated to date
+// like a real one
+func commitMirror(t *testing.T, repo, source, date string) {
+	t.Helper()
+	cmd := exec.Command("git", "commit", "--allow-empty", "-m", "vanity: mirror from "+source+" (1/1)")
+	cmd.Dir = repo
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date+"T12:00:00Z", "GIT_COMMITTER_DATE="+date+"T12:00:00Z")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit mirror: %v\n%s", err, out)
+	}
+}
+
+func TestDropSourceRewritesMirrorCommits(t *testing.T) {
+	remote, alice, _ := initSharedRemote(t)
+	writeTestFile(t, alice, ".vanity/bob.json", `{"username":"bob","contributions":[{"date":"2024-01-01","count":1}]}`)
+	writeTestFile(t, alice, ".vanity/carol.json", `{"username":"carol","contributions":[{"date":"2024-01-02","count":1}]}`)
+	writeTestFile(t, alice, ".vanity/alice-state.json", `{"username":"alice","mirrored_counts":{
+		"bob":{"2024-01-01":1},"carol":{"2024-01-02":1}},
+		"filters":{"windows":{"bob":{"from":"2023-01-01"}}}}`)
+	runGit(t, alice, "add", ".")
+	runGit(t, alice, "commit", "-m", "vanity: sync alice")
+	commitMirror(t, alice, "bob", "2024-01-01")
+	commitMirror(t, alice, "carol", "2024-01-02")
+	commitMirror(t, alice, "bobby", "2024-01-03")
+	runGit(t, alice, "push")
+	before := runGit(t, alice, "rev-parse", "HEAD")
+
+	var err error
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		captureStdout(t, func() {
+			err = (&Engine{username: "alice"}).DropSource("bob", true)
+		})
+		if err != nil {
+			t.Fatalf("DropSource() error = %v", err)
+		}
+		if snapshots, _ := ListSnapshots(); len(snapshots) == 0 || snapshots[len(snapshots)-1].Hash != before {
+			t.Errorf("snapshots = %+v, want the branch before the rewrite", snapshots)
+		}
+
+		if hasContributionData("bob") || !hasContributionData("carol") {
+			t.Error("DropSource() should remove only bob's contribution data")
+		}
+		state, _ := LoadSyncState("alice")
+		if _, ok := state.MirroredCounts["bob"]; ok || state.GetMirroredCount("carol", "2024-01-02") != 1 {
+			t.Errorf("state after removal = %v", state.MirroredCounts)
+		}
+		if state.Filters != nil {
+			t.Errorf("bob's filter window survived: %+v", state.Filters)
+		}
+		if err := ensureMirrorDatesIntact("HEAD"); err != nil {
+			t.Errorf("rewrite changed mirror commit dates: %v", err)
+		}
+	})
+
+	subjects := runGit(t, alice, "--git-dir", remote, "log", "--format=%s", "main")
+	want := "vanity: remove source bob\nvanity: mirror from bobby (1/1)\nvanity: mirror from carol (1/1)\nvanity: sync alice\ninitial"
+	if subjects != want {
+		t.Errorf("remote history = %q, want %q", subjects, want)
+	}
+	if refs := runGit(t, alice, "for-each-ref", "refs/original"); refs != "" {
+		t.Errorf("filter-branch backup left behind: %s", refs)
+	}
+}
+
+func TestDropSourceRefusesUnknownAndOwnAccount(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice","contributions":[]}`)
+	writeTestFile(t, repo, "notes.txt", "not a sync file")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+
+	withWorkingDirectory(t, repo, func() {
+		e := &Engine{username: "alice"}
+		if err := e.DropSource("alice", false); err == nil {
+			t.Error("DropSource() removed the account being synced as")
+		}
+		if err := e.DropSource("nobody", false); err == nil || !strings.Contains(err.Error(), "not a source") {
+			t.Errorf("DropSource(unknown) error = %v", err)
+		}
+		if err := e.DropSource("alice2", true); err == nil || !strings.Contains(err.Error(), "dedicated") {
+			t.Errorf("rewrite outside a dedicated repo error = %v", err)
+		}
+	})
+	if _, err := os.Stat(filepath.Join(repo, ".vanity", "alice.json")); err != nil {
+		t.Error("a refused removal deleted files")
+	}
+}
+
+func TestRemoveSourceFilesLeavesNonAccountsAlone(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/keys/alice.pub", "key")
+	writeTestFile(t, repo, ".vanity/notes/readme.txt", "not an account")
+
+	withWorkingDirectory(t, repo, func() {
+		if _, err := removeSourceFiles("keys"); err == nil {
+			t.Error("removeSourceFiles(keys) accepted a reserved name")
+		}
+		if _, err := removeSourceFiles("notes"); err != nil {
+			t.Errorf("removeSourceFiles(notes) error = %v", err)
+		}
+	})
+	for _, path := range []string{".vanity/keys/alice.pub", ".vanity/notes/readme.txt"} {
+		if _, err := os.Stat(filepath.Join(repo, path)); err != nil {
+			t.Errorf("%s was deleted by removing a name that isn't an account", path)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// SchemaVersion is the newest layout of .vanity files this version of vanity
+// reads and writes. Files without a schema_version are version 0.
+const SchemaVersion = 2
+
+// baseSchemaVersion is the schema of contribution and state files in the
+// single-file layout. Only the sharded layout needs SchemaVersion, so repos
+// that don't use it stay writable by versions of vanity that predate it.
+const baseSchemaVersion = 1
+
+// minSchemaKey in the shared .vanity/config is the oldest schema a vanity
+// binary must write to be allowed to change this repo's files. Every save
+// raises it to the schema of the file written, so a collaborator still on an
+// older version is stopped before overwriting data in a newer format.
+const minSchemaKey = "schema.minVersion"
+
+// fileKind tells the kinds of .vanity JSON files apart for migrations
+type fileKind string
+
+const (
+	contributionFile fileKind = "contribution"
+	stateFile        fileKind = "state"
+)
+
+// migration upgrades one kind of file from one schema version to the next.
+// apply edits the decoded document in place and reports whether it changed
+// anything.
+type migration struct {
+	kind  fileKind
+	from  int
+	apply func(doc map[string]json.RawMessage) (bool, error)
+}
+
+// migrations is the registry of upgrades, in order of version. A new schema
+// version adds its steps here, one per kind of file whose layout changes.
+// It is filled in init because a migration may load other files, which
+// migrates them in turn.
+var migrations []migration
+
+func init() {
+	migrations = []migration{
+		{stateFile, 0, migrateMirroredDates},
+	}
+}
+
+// migrate upgrades raw, a file of kind at path, to SchemaVersion. Files from a
+// newer vanity are refused rather than misread. When no migration changed
+// anything raw is returned as is, so validation errors keep their line
+// numbers; the new version is written on the next save.
+func migrate(kind fileKind, path string, raw []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, jsonError(path, raw, err)
+	}
+
+	version := 0
+	if v, ok := doc["schema_version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil || version < 0 {
+			return nil, fmt.Errorf("%s: invalid schema_version %s", path, v)
+		}
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%s uses schema version %d, but this version of vanity only understands up to %d (upgrade vanity)",
+			path, version, SchemaVersion)
+	}
+
+	changed := false
+	for _, m := range migrations {
+		if m.kind != kind || m.from < version {
+			continue
+		}
+		c, err := m.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate %s from schema version %d: %w", path, m.from, err)
+		}
+		changed = changed || c
+		version = m.from + 1
+	}
+	if !changed {
+		return raw, nil
+	}
+	doc["schema_version"] = json.RawMessage(strconv.Itoa(version))
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// migrateMirroredDates replaces the mirrored_dates of early versions, which
+// only recorded which source days had been mirrored, with mirrored_counts.
+// Those versions mirrored a day's whole count at once, so each recorded day
+// counts as mirrored up to the source's current count for it (at least one);
+// without this the next sync would mirror every day again.
+func migrateMirroredDates(doc map[string]json.RawMessage) (bool, error) {
+	raw, ok := doc["mirrored_dates"]
+	if !ok {
+		return false, nil
+	}
+	delete(doc, "mirrored_dates")
+
+	var bySource map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &bySource); err != nil {
+		return false, fmt.Errorf("invalid mirrored_dates: %w", err)
+	}
+	counts := make(map[string]map[string]int)
+	if existing, ok := doc["mirrored_counts"]; ok {
+		if err := json.Unmarshal(existing, &counts); err != nil {
+			return false, fmt.Errorf("invalid mirrored_counts: %w", err)
+		}
+		if counts == nil {
+			counts = make(map[string]map[string]int)
+		}
+	}
+
+	for source, rawDays := range bySource {
+		days, err := mirroredDays(rawDays)
+		if err != nil {
+			return false, fmt.Errorf("invalid mirrored_dates for %s: %w", source, err)
+		}
+		current := storedCounts(source)
+		if counts[source] == nil && len(days) > 0 {
+			counts[source] = make(map[string]int)
+		}
+		for _, day := range days {
+			if counts[source][day] == 0 {
+				counts[source][day] = max(1, current[day])
+			}
+		}
+	}
+
+	encoded, err := json.Marshal(counts)
+	if err != nil {
+		return false, err
+	}
+	doc["mirrored_counts"] = encoded
+	return true, nil
+}
+
+// storedCounts reads a source's contribution counts by date in whichever
+// layout it is stored; a missing or damaged file gives none
+func storedCounts(source string) map[string]int {
+	counts := make(map[string]int)
+	if ValidateLogin(source) != nil {
+		return counts
+	}
+	data, err := LoadContributionData(source)
+	if err != nil {
+		return counts
+	}
+	for _, c := range data.Contributions {
+		counts[c.Date] = c.Count
+	}
+	return counts
+}
+
+// mirroredDays reads one source's mirrored_dates, which were written both as
+// a list of dates and as a set of dates
+func mirroredDays(raw json.RawMessage) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, nil
+	}
+	var set map[string]bool
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("want a list or set of dates")
+	}
+	for day, mirrored := range set {
+		if mirrored {
+			list = append(list, day)
+		}
+	}
+	return list, nil
+}
+
+// writeVersionedFile writes a .vanity JSON file of schema version once the
+// repo's schema mark allows it, then raises the mark to match
+func writeVersionedFile(path string, data []byte, version int) error {
+	mark, err := checkSchemaWritable()
+	if err != nil {
+		return err
+	}
+	if err := writeVanityFile(path, data); err != nil {
+		return err
+	}
+	if mark < version {
+		return git.ConfigFileSet(sharedConfigPath, minSchemaKey, strconv.Itoa(version))
+	}
+	return nil
+}
+
+// checkSchemaWritable refuses writes when the repo is marked as needing a
+// newer schema than this version writes, and returns the mark
+func checkSchemaWritable() (int, error) {
+	value, err := git.ConfigFileGet(sharedConfigPath, minSchemaKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", minSchemaKey, err)
+	}
+	if value == "" {
+		return 0, nil
+	}
+	required, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid %s %q", sharedConfigPath, minSchemaKey, value)
+	}
+	if required > SchemaVersion {
+		return 0, fmt.Errorf("this repo's .vanity files are in schema version %d, but this version of vanity writes version %d (upgrade vanity before syncing)",
+			required, SchemaVersion)
+	}
+	return required, nil
+}
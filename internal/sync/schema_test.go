@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+func TestLoadSyncStateMigratesMirroredDates(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[
+		{"date":"2024-01-01","count":4},{"date":"2024-01-02","count":2}]}`)
+	writeTestFile(t, repo, ".vanity/alice-state.json", `{
+  "username": "alice",
+  "last_sync": "2024-01-03T00:00:00Z",
+  "mirrored_dates": {
+    "bob": ["2024-01-01", "2024-01-05"],
+    "carol": {"2024-02-01": true, "2024-02-02": false},
+    "erin": ["2024-03-01"]
+  }
+}`)
+	writeTestFile(t, repo, ".vanity/erin/account.json", `{"username":"erin"}`)
+	writeTestFile(t, repo, ".vanity/erin/2024.json", `{"username":"erin","year":2024,"contributions":[{"date":"2024-03-01","count":3}]}`)
+	// The layout this repository's own state file still uses.
+	writeTestFile(t, repo, ".vanity/dave-state.json", `{"username":"dave","last_sync":"2026-01-31T17:07:37Z","mirrored_dates":{}}`)
+
+	withWorkingDirectory(t, repo, func() {
+		state, err := LoadSyncState("alice")
+		if err != nil {
+			t.Fatalf("LoadSyncState() error = %v", err)
+		}
+		for _, tt := range []struct {
+			source, date string
+			want         int
+		}{
+			{"bob", "2024-01-01", 4},   // the source's count for the day
+			{"bob", "2024-01-02", 0},   // never mirrored
+			{"bob", "2024-01-05", 1},   // no longer in the source's file
+			{"carol", "2024-02-01", 1}, // no source file at all
+			{"carol", "2024-02-02", 0},
+			{"erin", "2024-03-01", 3}, // stored in the sharded layout
+		} {
+			if got := state.GetMirroredCount(tt.source, tt.date); got != tt.want {
+				t.Errorf("mirrored count for %s on %s = %d, want %d", tt.source, tt.date, got, tt.want)
+			}
+		}
+
+		if err := SaveSyncState(state); err != nil {
+			t.Fatalf("SaveSyncState() error = %v", err)
+		}
+		raw, _ := os.ReadFile(filepath.Join(vanityDir, "alice-state.json"))
+		if strings.Contains(string(raw), "mirrored_dates") || !strings.Contains(string(raw), `"schema_version": 1`) {
+			t.Errorf("saved state is not in the current schema:\n%s", raw)
+		}
+		if mark, _ := git.ConfigFileGet(sharedConfigPath, minSchemaKey); mark != "1" {
+			t.Errorf("%s = %q after a save, want 1", minSchemaKey, mark)
+		}
+
+		if state, err := LoadSyncState("dave"); err != nil || state.MirroredCounts == nil || state.LastSync.IsZero() {
+			t.Errorf("LoadSyncState() of an empty mirrored_dates = %+v, %v", state, err)
+		}
+	})
+}
+
+func TestNewerSchemaIsRefused(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"schema_version":99,"username":"bob","contributions":[]}`)
+
+	withWorkingDirectory(t, repo, func() {
+		if _, err := LoadContributionData("bob"); err == nil || !strings.Contains(err.Error(), "upgrade vanity") {
+			t.Errorf("LoadContributionData() of a newer file error = %v", err)
+		}
+
+		writeTestFile(t, repo, ".vanity/config", "[schema]\n\tminVersion = 99\n")
+		if err := SaveSyncState(&SyncState{Username: "alice"}); err == nil || !strings.Contains(err.Error(), "upgrade vanity") {
+			t.Errorf("SaveSyncState() under a newer mark error = %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(vanityDir, "alice-state.json")); !os.IsNotExist(err) {
+			t.Error("an older vanity wrote a file the repo marked as newer")
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/config"
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// SettingsScope is one of the config files sync settings are read from
+type SettingsScope string
+
+const (
+	ScopeDefault SettingsScope = "default" // built in
+	ScopeShared  SettingsScope = "shared"  // .vanity/config, committed for everyone
+	ScopeUser    SettingsScope = "user"    // vanity/config in the user's XDG config dir
+	ScopeLocal   SettingsScope = "local"   // .git/vanity/config, this clone only
+)
+
+// settingsScopes lists the config files in the order they are applied; later
+// ones override earlier ones, and flags override them all
+var settingsScopes = []SettingsScope{ScopeShared, ScopeUser, ScopeLocal}
+
+// Settings are the sync options a repository or user can set in config
+// instead of passing flags every time
+type Settings struct {
+	BatchSize     int
+	Integration   IntegrationStrategy
+	Timestamps    TimestampStrategy
+	TimestampSeed int64
+	Timezone      string // IANA name; empty is the local timezone
+	Aggregation   AggregationMode
+	Scales        map[string]float64 // only set by flags
+	MaxDayCommits int
+	MaxRunCommits int
+	Remote        string // empty pushes to the current branch's upstream
+	Branch        string // empty is the current branch's name
+	Skip          []string
+	LastYears     int
+	MergePrefer   MergeMode // days both sides of a merge changed: max or newer
+	KeepSnapshots int
+}
+
+// setting is a config key and how its value applies to Settings
+type setting struct {
+	key   string
+	def   string
+	help  string
+	apply func(s *Settings, value string) error
+}
+
+var settingKeys = []setting{
+	{"sync.batchSize", "100", "push every N mirror commits", func(s *Settings, v string) (err error) {
+		s.BatchSize, err = parseCount(v)
+		return err
+	}},
+	{"sync.integrate", string(IntegrateRebase), "rebase or merge remote changes", func(s *Settings, v string) (err error) {
+		s.Integration, err = ParseIntegrationStrategy(v)
+		return err
+	}},
+	{"sync.timestamps", string(TimestampsSpread), "spread, working-hours or jitter", func(s *Settings, v string) (err error) {
+		s.Timestamps, err = ParseTimestampStrategy(v)
+		return err
+	}},
+	{"sync.timestampSeed", "0", "seed for the jitter strategy", func(s *Settings, v string) (err error) {
+		if s.TimestampSeed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("invalid seed %q", v)
+		}
+		return nil
+	}},
+	{"sync.timezone", "", "IANA timezone of mirrored days (empty is local)", func(s *Settings, v string) error {
+		if _, err := time.LoadLocation(v); err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", v, err)
+		}
+		s.Timezone = v
+		return nil
+	}},
+	{"sync.aggregate", string(AggregateSum), "sum, max, presence or scaled", func(s *Settings, v string) (err error) {
+		s.Aggregation, err = ParseAggregationMode(v)
+		return err
+	}},
+	{"sync.maxDayCommits", strconv.Itoa(DefaultMaxDayCommits), "most mirror commits per source day (0 for no limit)", func(s *Settings, v string) (err error) {
+		s.MaxDayCommits, err = parseCount(v)
+		return err
+	}},
+	{"sync.maxRunCommits", strconv.Itoa(DefaultMaxRunCommits), "most mirror commits per run (0 for no limit)", func(s *Settings, v string) (err error) {
+		s.MaxRunCommits, err = parseCount(v)
+		return err
+	}},
+	{"sync.keepSnapshots", strconv.Itoa(DefaultKeepSnapshots), "snapshots of the branch kept for 'vanity undo' (0 keeps all)", func(s *Settings, v string) (err error) {
+		s.KeepSnapshots, err = parseCount(v)
+		return err
+	}},
+	{"sync.remote", "", "remote to pull from and push to (empty uses the upstream)", func(s *Settings, v string) error {
+		// A remote name has to make valid refs/remotes/<name> refs, so the
+		// rules for branch names apply to it too
+		if v != "" && git.CheckBranchName(v) != nil {
+			return fmt.Errorf("invalid remote name %q", v)
+		}
+		s.Remote = v
+		return nil
+	}},
+	{"sync.branch", "", "branch on the remote (empty is the current branch)", func(s *Settings, v string) error {
+		if v != "" {
+			if err := git.CheckBranchName(v); err != nil {
+				return err
+			}
+		}
+		s.Branch = v
+		return nil
+	}},
+	{"filter.skip", "", "comma-separated accounts never mirrored", func(s *Settings, v string) error {
+		s.Skip = nil
+		for _, login := range strings.Split(v, ",") {
+			login = strings.TrimSpace(login)
+			if login == "" {
+				continue
+			}
+			if err := ValidateLogin(login); err != nil {
+				return err
+			}
+			s.Skip = append(s.Skip, login)
+		}
+		return nil
+	}},
+	{"filter.lastYears", "0", "only mirror the last N years (0 for all)", func(s *Settings, v string) (err error) {
+		s.LastYears, err = parseCount(v)
+		return err
+	}},
+	{"merge.prefer", string(MergeMax), "max or newer, for days both sides of a merge changed", func(s *Settings, v string) (err error) {
+		s.MergePrefer, err = ParseDriverPreference(v)
+		return err
+	}},
+}
+
+func parseCount(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value %q (want a non-negative number)", v)
+	}
+	return n, nil
+}
+
+// lookupSetting finds a setting by key. Like git, keys are matched without
+// regard to case.
+func lookupSetting(key string) (setting, error) {
+	for _, s := range settingKeys {
+		if strings.EqualFold(s.key, key) {
+			return s, nil
+		}
+	}
+	return setting{}, fmt.Errorf("unknown setting %q (see 'vanity config list')", key)
+}
+
+// ParseSettingsScope parses a scope name
+func ParseSettingsScope(name string) (SettingsScope, error) {
+	for _, scope := range settingsScopes {
+		if string(scope) == name {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("invalid scope %q (want shared, user or local)", name)
+}
+
+// SettingsPath returns the config file of a scope
+func SettingsPath(scope SettingsScope) (string, error) {
+	switch scope {
+	case ScopeShared:
+		return sharedConfigPath, nil
+	case ScopeUser:
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate user config directory: %w", err)
+		}
+		return filepath.Join(dir, "vanity", "config"), nil
+	case ScopeLocal:
+		return config.LocalPath()
+	}
+	return "", fmt.Errorf("invalid scope %q", scope)
+}
+
+// SettingValue is the effective value of a setting and where it came from
+type SettingValue struct {
+	Key   string
+	Value string
+	Scope SettingsScope
+	Help  string
+}
+
+// ListSettings returns every setting with its effective value
+func ListSettings() ([]SettingValue, error) {
+	values := make([]SettingValue, len(settingKeys))
+	index := make(map[string]int, len(settingKeys))
+	for i, s := range settingKeys {
+		values[i] = SettingValue{Key: s.key, Value: s.def, Scope: ScopeDefault, Help: s.help}
+		index[strings.ToLower(s.key)] = i
+	}
+
+	for _, scope := range settingsScopes {
+		path, err := SettingsPath(scope)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := git.ConfigFileList(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			i, ok := index[strings.ToLower(entry.Key)]
+			if !ok {
+				continue
+			}
+			if err := settingKeys[i].apply(&Settings{}, entry.Value); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, settingKeys[i].key, err)
+			}
+			values[i].Value = entry.Value
+			values[i].Scope = scope
+		}
+	}
+	return values, nil
+}
+
+// GetSetting returns the effective value of one setting
+func GetSetting(key string) (SettingValue, error) {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return SettingValue{}, err
+	}
+	values, err := ListSettings()
+	if err != nil {
+		return SettingValue{}, err
+	}
+	for _, v := range values {
+		if v.Key == s.key {
+			return v, nil
+		}
+	}
+	return SettingValue{}, fmt.Errorf("unknown setting %q", key)
+}
+
+// SetSetting validates value and stores it in scope's config file
+func SetSetting(scope SettingsScope, key, value string) error {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return err
+	}
+	if err := s.apply(&Settings{}, value); err != nil {
+		return fmt.Errorf("%s: %w", s.key, err)
+	}
+	path, err := SettingsPath(scope)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return git.ConfigFileSet(path, s.key, value)
+}
+
+// UnsetSetting removes a setting from scope's config file
+func UnsetSetting(scope SettingsScope, key string) error {
+	s, err := lookupSetting(key)
+	if err != nil {
+		return err
+	}
+	path, err := SettingsPath(scope)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	return git.ConfigFileUnset(path, s.key, "")
+}
+
+// LoadSettings reads the sync settings: the defaults, overridden by the shared
+// config, then the user's, then this clone's
+func LoadSettings() (Settings, error) {
+	var settings Settings
+	values, err := ListSettings()
+	if err != nil {
+		return settings, err
+	}
+	for i, v := range values {
+		if err := settingKeys[i].apply(&settings, v.Value); err != nil {
+			return settings, fmt.Errorf("%s: %w", v.Key, err)
+		}
+	}
+	return settings, nil
+}
+
+// Options turns the settings into engine options
+func (s Settings) Options() ([]Option, error) {
+	loc := time.Local
+	if s.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+	options := []Option{
+		WithBatchSize(s.BatchSize),
+		WithIntegration(s.Integration),
+		WithTimestamps(s.Timestamps),
+		WithTimestampSeed(s.TimestampSeed),
+		WithTimezone(loc),
+		WithAggregation(s.Aggregation, s.Scales),
+		WithCommitLimits(s.MaxDayCommits, s.MaxRunCommits),
+		WithRemote(s.Remote, s.Branch),
+		WithSnapshots(s.KeepSnapshots),
+		WithFilterDefaults(s.Filters()),
+	}
+	return options, nil
+}
+
+// Filters returns the mirror filters the settings add to every account's own
+func (s Settings) Filters() *MirrorFilter {
+	return &MirrorFilter{Skip: s.Skip, LastYears: s.LastYears}
+}
@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSettingsLayers(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	userDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", userDir)
+	writeTestFile(t, repo, ".vanity/config", "[sync]\n\tbatchSize = 50\n\ttimezone = UTC\n[policy]\n\trequireAttestation = true\n")
+	writeTestFile(t, userDir, "vanity/config", "[sync]\n\ttimezone = Europe/Berlin\n")
+
+	withWorkingDirectory(t, repo, func() {
+		if err := SetSetting(ScopeLocal, "SYNC.BATCHSIZE", "10"); err != nil {
+			t.Fatalf("SetSetting() error = %v", err)
+		}
+
+		settings, err := LoadSettings()
+		if err != nil {
+			t.Fatalf("LoadSettings() error = %v", err)
+		}
+		if settings.BatchSize != 10 || settings.Timezone != "Europe/Berlin" || settings.Aggregation != AggregateSum {
+			t.Errorf("LoadSettings() = %+v, want local batch size, user timezone and default aggregation", settings)
+		}
+
+		got, err := GetSetting("sync.timezone")
+		if err != nil || got.Value != "Europe/Berlin" || got.Scope != ScopeUser {
+			t.Errorf("GetSetting(sync.timezone) = %+v, %v", got, err)
+		}
+
+		if err := UnsetSetting(ScopeLocal, "sync.batchSize"); err != nil {
+			t.Fatalf("UnsetSetting() error = %v", err)
+		}
+		if got, _ := GetSetting("sync.batchSize"); got.Value != "50" || got.Scope != ScopeShared {
+			t.Errorf("after unset, sync.batchSize = %+v, want the shared 50", got)
+		}
+		if got, _ := GetSetting("sync.maxRunCommits"); got.Scope != ScopeDefault {
+			t.Errorf("sync.maxRunCommits = %+v, want the default", got)
+		}
+	})
+}
+
+func TestSettingsValidate(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	writeTestFile(t, repo, ".vanity/.gitkeep", "")
+
+	withWorkingDirectory(t, repo, func() {
+		if err := SetSetting(ScopeShared, "sync.speed", "fast"); err == nil || !strings.Contains(err.Error(), "unknown setting") {
+			t.Errorf("SetSetting() of an unknown key error = %v", err)
+		}
+		for key, value := range map[string]string{
+			"sync.batchSize": "-1",
+			"sync.aggregate": "mean",
+			"sync.timezone":  "Mars/Olympus",
+			"filter.skip":    "bob,../x",
+			"sync.remote":    "--upload-pack=touch pwned",
+			"sync.branch":    "-f",
+		} {
+			if err := SetSetting(ScopeShared, key, value); err == nil {
+				t.Errorf("SetSetting(%s, %q) accepted an invalid value", key, value)
+			}
+		}
+
+		writeTestFile(t, repo, ".vanity/config", "[sync]\n\tintegrate = squash\n")
+		if _, err := LoadSettings(); err == nil || !strings.Contains(err.Error(), filepath.Join(".vanity", "config")) {
+			t.Errorf("LoadSettings() with a bad value error = %v, want it to name the file", err)
+		}
+	})
+}
+
+func TestSettingsFiltersAddToOwn(t *testing.T) {
+	state := &SyncState{Username: "alice", Filters: &MirrorFilter{Skip: []string{"bob"}, LastYears: 2}}
+	state.SetFilterDefaults(&MirrorFilter{Skip: []string{"bob", "carol"}, LastYears: 5}, nil)
+
+	filters := state.EffectiveFilters()
+	if !filters.SkipsSource("carol") || len(filters.Skip) != 2 || filters.LastYears != 2 {
+		t.Errorf("EffectiveFilters() = %+v, want both skips and the account's own year limit", filters)
+	}
+	raw, _ := json.Marshal(state)
+	if strings.Contains(string(raw), "carol") {
+		t.Errorf("settings filters leaked into the saved state: %s", raw)
+	}
+
+	state.Filters = nil
+	if filters := state.EffectiveFilters(); filters.LastYears != 5 {
+		t.Errorf("EffectiveFilters() without own filters = %+v", filters)
+	}
+	state.SetFilterDefaults(&MirrorFilter{}, nil)
+	if !state.EffectiveFilters().IsEmpty() {
+		t.Error("empty defaults still filter")
+	}
+}
+
+func TestConfiguredRemoteAndBranch(t *testing.T) {
+	silenceStderr(t)
+	_, alice, _ := initSharedRemote(t)
+	backup := filepath.Join(t.TempDir(), "backup.git")
+	runGit(t, t.TempDir(), "init", "--bare", "-b", "main", backup)
+	runGit(t, alice, "remote", "add", "backup", backup)
+
+	withWorkingDirectory(t, alice, func() {
+		e := &Engine{remote: "backup", branch: "vanity"}
+		if upstream := e.upstream(); upstream != "" {
+			t.Errorf("upstream() before the first push = %q, want none", upstream)
+		}
+		captureStdout(t, func() {
+			if err := e.push(); err != nil {
+				t.Fatalf("push() error = %v", err)
+			}
+			if err := e.fetch(); err != nil {
+				t.Fatalf("fetch() error = %v", err)
+			}
+		})
+		if upstream := e.upstream(); upstream != "backup/vanity" {
+			t.Errorf("upstream() = %q, want backup/vanity", upstream)
+		}
+	})
+	if got, want := runGit(t, alice, "--git-dir", backup, "rev-parse", "vanity"), runGit(t, alice, "rev-parse", "HEAD"); got != want {
+		t.Errorf("backup/vanity = %s, want HEAD %s", got, want)
+	}
+}
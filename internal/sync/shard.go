@@ -0,0 +1,370 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// StorageLayout is how an account's contributions are stored in .vanity/
+type StorageLayout string
+
+const (
+	LayoutSingle  StorageLayout = "single"  // .vanity/<name>.json
+	LayoutSharded StorageLayout = "sharded" // .vanity/<name>/account.json and <year>.json
+)
+
+const (
+	storageLayoutKey = "storage.layout" // in the shared .vanity/config
+	accountFileName  = "account.json"
+)
+
+// shardedSchemaVersion is the schema of files in the sharded layout. Older
+// versions of vanity don't know the layout, so writing it raises the repo's
+// schema mark.
+const shardedSchemaVersion = 2
+
+var yearFilePattern = regexp.MustCompile(`^(\d{4})\.json$`)
+
+// accountFile is the sharded layout's account.json: everything in a
+// contribution file except the contributions, which live in the year files
+type accountFile struct {
+	*ContributionData
+	Contributions []Contribution `json:"contributions,omitempty"`
+}
+
+// yearFile holds one calendar year of an account's contributions. Once the
+// year is over its checksum is set, and the file is frozen: it is only
+// rewritten if the counts really change, and an edit that doesn't update the
+// checksum is refused.
+type yearFile struct {
+	SchemaVersion int            `json:"schema_version"`
+	Username      string         `json:"username"`
+	Year          int            `json:"year"`
+	Checksum      string         `json:"checksum,omitempty"`
+	Contributions []Contribution `json:"contributions"`
+}
+
+// ParseStorageLayout parses a layout name
+func ParseStorageLayout(s string) (StorageLayout, error) {
+	switch l := StorageLayout(s); l {
+	case LayoutSingle, LayoutSharded:
+		return l, nil
+	}
+	return "", fmt.Errorf("invalid storage layout %q (want single or sharded)", s)
+}
+
+// RepoLayout returns the layout new accounts are stored in
+func RepoLayout() (StorageLayout, error) {
+	value, err := git.ConfigFileGet(sharedConfigPath, storageLayoutKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", storageLayoutKey, err)
+	}
+	if value == "" {
+		return LayoutSingle, nil
+	}
+	layout, err := ParseStorageLayout(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", sharedConfigPath, err)
+	}
+	return layout, nil
+}
+
+func singlePath(name string) string {
+	return filepath.Join(vanityDir, name+".json")
+}
+
+func shardDir(name string) string {
+	return filepath.Join(vanityDir, name)
+}
+
+// AccountLayout returns the layout name's contributions are stored in: the
+// one on disk, or the repo's layout for an account with no data yet
+func AccountLayout(name string) (StorageLayout, error) {
+	_, singleErr := os.Stat(singlePath(name))
+	_, shardedErr := os.Stat(filepath.Join(shardDir(name), accountFileName))
+	switch {
+	case singleErr == nil && shardedErr == nil:
+		return "", fmt.Errorf("%s has both %s and %s; remove one", name, singlePath(name), shardDir(name))
+	case shardedErr == nil:
+		return LayoutSharded, nil
+	case singleErr == nil:
+		return LayoutSingle, nil
+	}
+	return RepoLayout()
+}
+
+// contributionPath names where an account's contributions are stored, for
+// messages
+func contributionPath(name string) string {
+	if layout, _ := AccountLayout(name); layout == LayoutSharded {
+		return shardDir(name) + string(filepath.Separator)
+	}
+	return singlePath(name)
+}
+
+// yearChecksum fingerprints a year's contributions
+func yearChecksum(contribs []Contribution) string {
+	encoded, _ := json.Marshal(contribs)
+	sum := sha256.Sum256(encoded)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// loadShardedContributionData reads an account stored in the sharded layout
+func loadShardedContributionData(name string, now time.Time) (*ContributionData, error) {
+	dir := shardDir(name)
+	path := filepath.Join(dir, accountFileName)
+	raw, err := readVanityFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err = migrate(contributionFile, path, raw); err != nil {
+		return nil, err
+	}
+	data := &ContributionData{}
+	if err := json.Unmarshal(raw, &accountFile{ContributionData: data}); err != nil {
+		return nil, jsonError(path, raw, err)
+	}
+	if data.Username != name {
+		return nil, fmt.Errorf("%s: username %q does not match its directory", path, data.Username)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	data.Contributions = []Contribution{}
+	for _, entry := range entries {
+		if entry.Name() == accountFileName {
+			continue
+		}
+		match := yearFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s: unexpected file %s", dir, entry.Name())
+		}
+		year, _ := strconv.Atoi(match[1])
+		contribs, err := loadYearFile(filepath.Join(dir, entry.Name()), name, year, now)
+		if err != nil {
+			return nil, err
+		}
+		data.Contributions = append(data.Contributions, contribs...)
+	}
+	return data, nil
+}
+
+// loadYearFile reads and checks one year of an account's contributions
+func loadYearFile(path, name string, year int, now time.Time) ([]Contribution, error) {
+	raw, err := readVanityFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if raw, err = migrate(contributionFile, path, raw); err != nil {
+		return nil, err
+	}
+	var yf yearFile
+	if err := json.Unmarshal(raw, &yf); err != nil {
+		return nil, jsonError(path, raw, err)
+	}
+	if yf.Year != year {
+		return nil, fmt.Errorf("%s: year %d does not match its file name", path, yf.Year)
+	}
+	// Validated as a contribution file of its own, so problems are reported
+	// with this file's line numbers.
+	if err := validateContributionData(path, raw, &ContributionData{Username: yf.Username, Contributions: yf.Contributions}, name, now); err != nil {
+		return nil, err
+	}
+	prefix := strconv.Itoa(year) + "-"
+	lines := contributionLines(raw)
+	for i, c := range yf.Contributions {
+		if !strings.HasPrefix(c.Date, prefix) {
+			line := 0
+			if i < len(lines) {
+				line = lines[i]
+			}
+			return nil, fmt.Errorf("%s:%d: date %s is not in %d", path, line, c.Date, year)
+		}
+	}
+	if yf.Checksum != "" && yf.Checksum != yearChecksum(yf.Contributions) {
+		return nil, fmt.Errorf("%s: %d is frozen, but its contributions don't match its checksum (edited by hand?)", path, year)
+	}
+	return yf.Contributions, nil
+}
+
+// saveShardedContributionData writes an account in the sharded layout. Year
+// files whose content hasn't changed are left alone, so a sync normally only
+// touches the current year and account.json.
+func saveShardedContributionData(data *ContributionData, now time.Time) error {
+	dir := shardDir(data.Username)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	byYear := make(map[int][]Contribution)
+	for _, c := range data.Contributions {
+		date, err := time.Parse("2006-01-02", c.Date)
+		if err != nil {
+			return fmt.Errorf("invalid date %q", c.Date)
+		}
+		byYear[date.Year()] = append(byYear[date.Year()], c)
+	}
+
+	currentYear := now.UTC().Year()
+	for year, contribs := range byYear {
+		sort.Slice(contribs, func(i, j int) bool { return contribs[i].Date < contribs[j].Date })
+		yf := yearFile{SchemaVersion: shardedSchemaVersion, Username: data.Username, Year: year, Contributions: contribs}
+		if year < currentYear {
+			yf.Checksum = yearChecksum(contribs)
+		}
+		encoded, err := json.MarshalIndent(yf, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, strconv.Itoa(year)+".json")
+		if existing, err := readVanityFile(path); err == nil && bytes.Equal(existing, encoded) {
+			continue
+		}
+		if err := writeVersionedFile(path, encoded, shardedSchemaVersion); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		match := yearFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		if year, _ := strconv.Atoi(match[1]); len(byYear[year]) == 0 {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	account := *data
+	account.SchemaVersion = shardedSchemaVersion
+	encoded, err := json.MarshalIndent(accountFile{ContributionData: &account}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeVersionedFile(filepath.Join(dir, accountFileName), encoded, shardedSchemaVersion)
+}
+
+// hasContributionData reports whether name has contributions stored in
+// either layout
+func hasContributionData(name string) bool {
+	if _, err := os.Stat(singlePath(name)); err == nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(shardDir(name), accountFileName))
+	return err == nil
+}
+
+// removeContributionData deletes an account's contributions in either layout.
+// The sharded directory is only removed when it holds an account file, so a
+// name that isn't an account never takes other files with it.
+func removeContributionData(name string) error {
+	if err := ValidateLogin(name); err != nil {
+		return err
+	}
+	if err := os.Remove(singlePath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(shardDir(name), accountFileName)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return os.RemoveAll(shardDir(name))
+}
+
+// ConvertLayout moves every account to layout, makes it the layout for new
+// accounts and commits the change. It works from the latest remote state, so
+// accounts other clones pushed are converted too. It returns how many
+// accounts moved.
+func (e *Engine) ConvertLayout(layout StorageLayout) (converted int, err error) {
+	lock, err := acquireLock(e.username)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	if git.HasUncommittedChanges() {
+		return 0, fmt.Errorf("the working tree has uncommitted changes; commit or stash them first")
+	}
+	if git.HasRemote() {
+		fmt.Println("Pulling latest changes...")
+		if err := e.integrateRemote(); err != nil {
+			return 0, fmt.Errorf("git pull failed: %w", err)
+		}
+	}
+
+	users, err := ListSyncedUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	// Everything is read first, so a file that fails to load stops the
+	// conversion before anything has moved.
+	var move []*ContributionData
+	for _, user := range users {
+		current, err := AccountLayout(user)
+		if err != nil {
+			return 0, err
+		}
+		if current == layout {
+			continue
+		}
+		data, err := LoadContributionData(user)
+		if err != nil {
+			return 0, err
+		}
+		move = append(move, data)
+	}
+
+	now := time.Now()
+	for _, data := range move {
+		if err := saveContributionDataAs(data, layout, now); err != nil {
+			return 0, fmt.Errorf("failed to convert %s: %w", data.Username, err)
+		}
+		old := shardDir(data.Username)
+		if layout == LayoutSharded {
+			old = singlePath(data.Username)
+		}
+		if err := os.RemoveAll(old); err != nil {
+			return 0, fmt.Errorf("failed to remove %s: %w", old, err)
+		}
+	}
+
+	if err := git.ConfigFileSet(sharedConfigPath, storageLayoutKey, string(layout)); err != nil {
+		return 0, err
+	}
+	if err := git.Add("-A", vanityDir); err != nil {
+		return 0, fmt.Errorf("failed to stage conversion: %w", err)
+	}
+	if git.HasUncommittedChanges() {
+		if err := git.Commit(fmt.Sprintf("vanity: switch to %s storage", layout)); err != nil {
+			return 0, fmt.Errorf("failed to commit conversion: %w", err)
+		}
+	}
+	return len(move), nil
+}
@@ -0,0 +1,173 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+func TestConvertLayoutRoundTrip(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	thisYear := time.Now().UTC().Year()
+	today := fmt.Sprintf("%d-01-02", thisYear)
+
+	withWorkingDirectory(t, repo, func() {
+		var key ed25519.PrivateKey
+		captureStdout(t, func() {
+			key, _ = ensureSigningKey("bob")
+		})
+		original := &ContributionData{Username: "bob", Contributions: []Contribution{
+			{Date: "2022-12-31", Count: 3}, {Date: "2023-06-01", Count: 1}, {Date: today, Count: 2},
+		}}
+		if err := signContribution(original, "bob", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveContributionData(original); err != nil {
+			t.Fatal(err)
+		}
+
+		e := &Engine{username: "bob"}
+		if _, err := e.ConvertLayout(LayoutSharded); err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+			t.Fatalf("ConvertLayout() with uncommitted changes error = %v", err)
+		}
+		runGit(t, repo, "add", "-A")
+		runGit(t, repo, "commit", "-m", "bob")
+
+		var converted int
+		var err error
+		captureStdout(t, func() {
+			converted, err = e.ConvertLayout(LayoutSharded)
+		})
+		if err != nil || converted != 1 {
+			t.Fatalf("ConvertLayout(sharded) = %d, %v", converted, err)
+		}
+		for _, name := range []string{"account.json", "2022.json", "2023.json", fmt.Sprintf("%d.json", thisYear)} {
+			if _, err := os.Stat(filepath.Join(vanityDir, "bob", name)); err != nil {
+				t.Errorf("missing %s after conversion", name)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(vanityDir, "bob.json")); !os.IsNotExist(err) {
+			t.Error("bob.json is still there after conversion")
+		}
+		past, _ := os.ReadFile(filepath.Join(vanityDir, "bob", "2023.json"))
+		current, _ := os.ReadFile(filepath.Join(vanityDir, "bob", fmt.Sprintf("%d.json", thisYear)))
+		if !strings.Contains(string(past), `"checksum": "sha256:`) || strings.Contains(string(current), "checksum") {
+			t.Errorf("only past years should be frozen:\n%s\n%s", past, current)
+		}
+		if layout, _ := RepoLayout(); layout != LayoutSharded {
+			t.Errorf("RepoLayout() = %s after conversion", layout)
+		}
+		if mark, _ := git.ConfigFileGet(sharedConfigPath, minSchemaKey); mark != "2" {
+			t.Errorf("%s = %q, want 2 once the sharded layout is written", minSchemaKey, mark)
+		}
+		if out := runGit(t, repo, "status", "--porcelain"); out != "" {
+			t.Errorf("conversion left uncommitted changes:\n%s", out)
+		}
+
+		if users, _ := ListSyncedUsers(); !reflect.DeepEqual(users, []string{"bob"}) {
+			t.Errorf("ListSyncedUsers() = %v", users)
+		}
+		loaded, _, err := loadVerifiedContribution("bob")
+		if err != nil {
+			t.Fatalf("loading the sharded account error = %v", err)
+		}
+		if !reflect.DeepEqual(loaded.Contributions, original.Contributions) {
+			t.Errorf("sharded contributions = %+v, want %+v", loaded.Contributions, original.Contributions)
+		}
+
+		// A sync that only changes this year leaves frozen years untouched.
+		old := time.Now().Add(-time.Hour)
+		pastPath := filepath.Join(vanityDir, "bob", "2023.json")
+		if err := os.Chtimes(pastPath, old, old); err != nil {
+			t.Fatal(err)
+		}
+		loaded.Contributions[2].Count = 5
+		if err := SaveContributionData(loaded); err != nil {
+			t.Fatalf("SaveContributionData() error = %v", err)
+		}
+		if info, _ := os.Stat(pastPath); !info.ModTime().Equal(old) {
+			t.Error("saving rewrote a frozen year")
+		}
+		runGit(t, repo, "commit", "-am", "sync")
+
+		captureStdout(t, func() {
+			converted, err = e.ConvertLayout(LayoutSingle)
+		})
+		if err != nil || converted != 1 {
+			t.Fatalf("ConvertLayout(single) = %d, %v", converted, err)
+		}
+		if _, err := os.Stat(filepath.Join(vanityDir, "bob")); !os.IsNotExist(err) {
+			t.Error("the sharded directory is still there after converting back")
+		}
+		if back, err := LoadContributionData("bob"); err != nil || back.Contributions[2].Count != 5 {
+			t.Errorf("LoadContributionData() after converting back = %+v, %v", back, err)
+		}
+	})
+}
+
+func TestConvertLayoutIntegratesRemote(t *testing.T) {
+	_, alice, bob := initSharedRemote(t)
+	writeTestFile(t, bob, ".vanity/bob.json", `{"username":"bob","contributions":[{"date":"2024-01-01","count":1}]}`)
+	runGit(t, bob, "add", ".")
+	runGit(t, bob, "commit", "-m", "vanity: sync bob")
+	runGit(t, bob, "push")
+
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		var converted int
+		var err error
+		captureStdout(t, func() {
+			converted, err = (&Engine{username: "alice"}).ConvertLayout(LayoutSharded)
+		})
+		if err != nil || converted != 1 {
+			t.Fatalf("ConvertLayout(sharded) = %d, %v; want bob's pushed file converted", converted, err)
+		}
+		if layout, _ := AccountLayout("bob"); layout != LayoutSharded {
+			t.Errorf("bob's layout = %s, want sharded", layout)
+		}
+	})
+}
+
+func TestShardedSaveRejectsInvalidDates(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		for _, date := range []string{"", "24", "2024", "abcd-01-01", "2024-13-01"} {
+			data := &ContributionData{Username: "bob", Contributions: []Contribution{{Date: date, Count: 1}}}
+			if err := saveShardedContributionData(data, time.Now()); err == nil || !strings.Contains(err.Error(), "invalid date") {
+				t.Errorf("saving date %q error = %v, want it refused", date, err)
+			}
+		}
+	})
+}
+
+func TestShardedYearFilesAreChecked(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob/account.json", `{"username":"bob","last_updated":"2024-01-01T00:00:00Z"}`)
+
+	tests := []struct {
+		name, file, want string
+	}{
+		{"edited frozen year", `{"username":"bob","year":2022,"checksum":"sha256:00","contributions":[{"date":"2022-01-01","count":9}]}`, "checksum"},
+		{"date outside the year", `{"username":"bob","year":2022,"contributions":[
+  {"date":"2023-01-01","count":1}]}`, "2022.json:2: date 2023-01-01 is not in 2022"},
+		{"wrong account", `{"username":"carol","year":2022,"contributions":[]}`, "carol"},
+		{"newer schema", `{"schema_version":99,"username":"bob","year":2022,"contributions":[]}`, "upgrade vanity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestFile(t, repo, ".vanity/bob/2022.json", tt.file)
+			withWorkingDirectory(t, repo, func() {
+				if _, err := LoadContributionData("bob"); err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("LoadContributionData() error = %v, want %q", err, tt.want)
+				}
+			})
+		})
+	}
+}
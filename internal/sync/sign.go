@@ -0,0 +1,338 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wdm0006/vanity/internal/config"
+)
+
+// Signing keys. Public keys are registered in .vanity/keys/<name>.pub, one
+// per line, so an account can sign from several clones. The private key and
+// the keys this clone has decided to trust stay in local config.
+const (
+	keysDir            = "keys"
+	signingKeyPrefix   = "ed25519:"
+	localSigningKeyKey = "signing.key"
+	requireSignedKey   = "signing.require"
+	trustedKeySection  = "signer" // signer.<name>.key, one per trusted key
+)
+
+// FileSignature is an ed25519 signature over a contribution file
+type FileSignature struct {
+	Signer string `json:"signer"` // account that signed, as stored in this repo
+	Key    string `json:"key"`    // fingerprint of the signing key
+	Value  string `json:"value"`
+}
+
+// KeyFingerprint identifies a public key in signatures and listings
+func KeyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+func keysPath(name string) string {
+	return filepath.Join(vanityDir, keysDir, name+".pub")
+}
+
+// RegisteredKeys returns the public keys registered for an account
+func RegisteredKeys(name string) ([]ed25519.PublicKey, error) {
+	data, err := os.ReadFile(keysPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []ed25519.PublicKey
+	for i, line := range strings.Split(string(data), "\n") {
+		field, _, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if field == "" {
+			continue
+		}
+		encoded, ok := strings.CutPrefix(field, signingKeyPrefix)
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if !ok || err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: invalid key (want %s<base64>)", keysPath(name), i+1, signingKeyPrefix)
+		}
+		keys = append(keys, ed25519.PublicKey(raw))
+	}
+	return keys, nil
+}
+
+// TrustedKeys returns the fingerprints of an account's keys this clone trusts
+func TrustedKeys(name string) ([]string, error) {
+	return config.GetAll(trustedKeySection + "." + name + ".key")
+}
+
+// TrustRegisteredKeys makes this clone trust exactly the keys currently
+// registered for an account, replacing what it trusted before
+func TrustRegisteredKeys(name string) ([]string, error) {
+	keys, err := RegisteredKeys(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s has no registered keys", name)
+	}
+	if err := config.Unset(trustedKeySection+"."+name+".key", ""); err != nil {
+		return nil, err
+	}
+	var fingerprints []string
+	for _, key := range keys {
+		fp := KeyFingerprint(key)
+		if err := config.Add(trustedKeySection+"."+name+".key", fp); err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	return fingerprints, nil
+}
+
+// localSigningKey returns this clone's signing key, or nil if it has none
+func localSigningKey() (ed25519.PrivateKey, error) {
+	value, err := config.Get(localSigningKeyKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid %s", localSigningKeyKey)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ensureSigningKey returns this clone's signing key, creating it and
+// registering its public key under self on first use
+func ensureSigningKey(self string) (ed25519.PrivateKey, error) {
+	key, err := localSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		_, key, err = ed25519.GenerateKey(cryptorand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		if err := config.Set(localSigningKeyKey, base64.StdEncoding.EncodeToString(key.Seed())); err != nil {
+			return nil, err
+		}
+	}
+
+	pub := key.Public().(ed25519.PublicKey)
+	registered, err := RegisteredKeys(self)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range registered {
+		if k.Equal(pub) {
+			return key, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keysPath(self)), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(keysPath(self), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	line := signingKeyPrefix + base64.StdEncoding.EncodeToString(pub) + "\n"
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	fmt.Printf("  Registered signing key %s in %s\n", KeyFingerprint(pub), keysPath(self))
+	return key, nil
+}
+
+// signedBytes is what a signature covers: the file's content without the
+// signature itself. The username is included, so a signed file cannot be
+// passed off as another account's. The schema version is left out, so a file
+// saved again in a newer schema keeps its signature.
+func signedBytes(data *ContributionData) ([]byte, error) {
+	unsigned := *data
+	unsigned.Signature = nil
+	unsigned.SchemaVersion = 0
+	return json.Marshal(unsigned)
+}
+
+// signContribution signs data as signer
+func signContribution(data *ContributionData, signer string, key ed25519.PrivateKey) error {
+	message, err := signedBytes(data)
+	if err != nil {
+		return err
+	}
+	data.Signature = &FileSignature{
+		Signer: signer,
+		Key:    KeyFingerprint(key.Public().(ed25519.PublicKey)),
+		Value:  base64.StdEncoding.EncodeToString(ed25519.Sign(key, message)),
+	}
+	return nil
+}
+
+// SignWithLocalKey signs data as signer if this clone has a signing key, and
+// drops any previous signature otherwise, since it no longer matches
+func SignWithLocalKey(data *ContributionData, signer string) error {
+	data.Signature = nil
+	key, err := localSigningKey()
+	if err != nil || key == nil {
+		return err
+	}
+	return signContribution(data, signer, key)
+}
+
+// verifyContribution checks the contribution file stored as owner before it
+// is mirrored. A file must be signed by its owner when the owner has
+// registered keys; files of accounts without keys, such as imported ones, may
+// be signed by whoever wrote them. Signer keys are trusted on first use and
+// any later change is refused until accepted with 'vanity keys trust'.
+// Unsigned files without registered keys pass with a warning unless
+// signing.require is set.
+func verifyContribution(data *ContributionData, owner string) (warning string, err error) {
+	if data.Username != owner {
+		return "", fmt.Errorf("file is stored as %s but claims to be %s", owner, data.Username)
+	}
+
+	ownerKeys, err := RegisteredKeys(owner)
+	if err != nil {
+		return "", err
+	}
+	ownerTrusted, err := TrustedKeys(owner)
+	if err != nil {
+		return "", err
+	}
+
+	sig := data.Signature
+	if sig == nil {
+		if len(ownerKeys) > 0 || len(ownerTrusted) > 0 {
+			return "", fmt.Errorf("file is unsigned but %s has signing keys", owner)
+		}
+		required, err := config.Get(requireSignedKey)
+		if err != nil {
+			return "", err
+		}
+		if required == "true" {
+			return "", fmt.Errorf("file is unsigned and %s is set", requireSignedKey)
+		}
+		return "file is unsigned", nil
+	}
+
+	if sig.Signer != owner && (len(ownerKeys) > 0 || len(ownerTrusted) > 0) {
+		return "", fmt.Errorf("file is signed by %s, not by its owner", sig.Signer)
+	}
+
+	message, err := signedBytes(data)
+	if err != nil {
+		return "", err
+	}
+	warning, err = verifySignature(sig.Signer, sig.Key, sig.Value, message)
+	if errors.Is(err, errSignatureMismatch) {
+		return "", fmt.Errorf("signature by %s does not match the file's contents (edited by someone else, or not yet re-signed by its owner's next sync)", sig.Signer)
+	}
+	return warning, err
+}
+
+// errSignatureMismatch is a signature that doesn't match what it signs
+var errSignatureMismatch = errors.New("signature does not match")
+
+// verifySignature checks that value is signer's signature of message, made
+// with signer's registered key fingerprint. Signer keys are trusted on first
+// use, like in verifyContribution.
+func verifySignature(signer, fingerprint, value string, message []byte) (warning string, err error) {
+	signerKeys, err := RegisteredKeys(signer)
+	if err != nil {
+		return "", err
+	}
+	var key ed25519.PublicKey
+	for _, k := range signerKeys {
+		if KeyFingerprint(k) == fingerprint {
+			key = k
+		}
+	}
+	if key == nil {
+		return "", fmt.Errorf("signing key %s is not registered for %s", fingerprint, signer)
+	}
+
+	trusted, err := TrustedKeys(signer)
+	if err != nil {
+		return "", err
+	}
+	if len(trusted) == 0 {
+		if trusted, err = TrustRegisteredKeys(signer); err != nil {
+			return "", err
+		}
+		warning = fmt.Sprintf("trusting %d key(s) of %s on first use", len(trusted), signer)
+	}
+	isTrusted := false
+	for _, fp := range trusted {
+		isTrusted = isTrusted || fp == fingerprint
+	}
+	if !isTrusted {
+		return "", fmt.Errorf("signing key %s of %s is new since this clone first saw it; if that is expected, run 'vanity keys trust %s'",
+			fingerprint, signer, signer)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || !ed25519.Verify(key, message, signature) {
+		return "", errSignatureMismatch
+	}
+	return warning, nil
+}
+
+// loadVerifiedContribution loads a source's contribution file for mirroring,
+// refusing it if its signature doesn't check out or it lacks a required
+// attestation
+func loadVerifiedContribution(name string) (*ContributionData, string, error) {
+	data, err := LoadContributionData(name)
+	if err != nil {
+		return nil, "", err
+	}
+	warning, err := verifyContribution(data, name)
+	if err == nil {
+		err = checkAttestation(data, name)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("refusing to mirror %s.json: %w", name, err)
+	}
+	return data, warning, nil
+}
+
+// loadOwnContribution loads your own contribution file before you write it
+// again. Writing it signs it with your key, so it is first checked against your
+// own registered keys: otherwise a change someone else made would go out under
+// your signature. A file whose signature doesn't verify is refused. An unsigned
+// one, as an opaque migration or a merge none of your clones could sign leaves
+// behind, comes back with untrusted set, and its days must not be kept.
+func loadOwnContribution(name string) (data *ContributionData, untrusted bool, err error) {
+	data, err = LoadContributionData(name)
+	if err != nil || !hasContributionData(name) {
+		return data, false, err
+	}
+
+	if data.Signature == nil {
+		keys, err := RegisteredKeys(name)
+		if err != nil {
+			return nil, false, err
+		}
+		return data, len(keys) > 0, nil
+	}
+	if _, err := verifyContribution(data, name); err != nil {
+		return nil, false, fmt.Errorf("refusing to update your own %s.json: %w; check 'git log -p %s' and undo the change with 'vanity snapshots' and 'vanity restore'",
+			name, err, vanityDir)
+	}
+	return data, false, nil
+}
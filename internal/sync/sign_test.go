@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"crypto/ed25519"
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/config"
+)
+
+func TestSignedContributionVerifies(t *testing.T) {
+	repo := initTestRepo(t, "main")
+
+	withWorkingDirectory(t, repo, func() {
+		var key ed25519.PrivateKey
+		captureStdout(t, func() {
+			var err error
+			if key, err = ensureSigningKey("alice"); err != nil {
+				t.Fatalf("ensureSigningKey() error = %v", err)
+			}
+		})
+		data := &ContributionData{Username: "alice", Contributions: []Contribution{{Date: "2024-01-01", Count: 4}}}
+		if err := signContribution(data, "alice", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+
+		_, warning, err := loadVerifiedContribution("alice")
+		if err != nil {
+			t.Fatalf("loadVerifiedContribution() error = %v", err)
+		}
+		if !strings.Contains(warning, "first use") {
+			t.Errorf("warning = %q, want a first-use notice", warning)
+		}
+
+		// A collaborator inflates alice's counts.
+		data.Contributions[0].Count = 40
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadVerifiedContribution("alice"); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("loadVerifiedContribution() of an edited file error = %v", err)
+		}
+
+		// Dropping the signature doesn't help either.
+		data.Signature = nil
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadVerifiedContribution("alice"); err == nil || !strings.Contains(err.Error(), "unsigned") {
+			t.Errorf("loadVerifiedContribution() of an unsigned file error = %v", err)
+		}
+	})
+}
+
+func TestSwappedKeysAreRefusedUntilTrusted(t *testing.T) {
+	repo := initTestRepo(t, "main")
+
+	withWorkingDirectory(t, repo, func() {
+		var alice ed25519.PrivateKey
+		captureStdout(t, func() {
+			alice, _ = ensureSigningKey("alice")
+		})
+		data := &ContributionData{Username: "alice", Contributions: []Contribution{{Date: "2024-01-01", Count: 1}}}
+		_ = signContribution(data, "alice", alice)
+		_ = SaveContributionData(data)
+		if _, _, err := loadVerifiedContribution("alice"); err != nil {
+			t.Fatalf("loadVerifiedContribution() error = %v", err)
+		}
+
+		// Mallory replaces alice's registered key with her own and re-signs.
+		_, mallory, _ := ed25519.GenerateKey(cryptorand.Reader)
+		pub := mallory.Public().(ed25519.PublicKey)
+		writeTestFile(t, repo, ".vanity/keys/alice.pub", signingKeyPrefix+base64.StdEncoding.EncodeToString(pub)+"\n")
+		data.Contributions[0].Count = 99
+		_ = signContribution(data, "alice", mallory)
+		_ = SaveContributionData(data)
+
+		if _, _, err := loadVerifiedContribution("alice"); err == nil || !strings.Contains(err.Error(), "vanity keys trust alice") {
+			t.Errorf("loadVerifiedContribution() with a swapped key error = %v", err)
+		}
+		if _, err := TrustRegisteredKeys("alice"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadVerifiedContribution("alice"); err != nil {
+			t.Errorf("loadVerifiedContribution() after trusting error = %v", err)
+		}
+	})
+}
+
+func TestUnsignedFilesOfAccountsWithoutKeys(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/carol.json", `{"username":"bob","contributions":[]}`)
+
+	withWorkingDirectory(t, repo, func() {
+		if _, warning, err := loadVerifiedContribution("bob"); err != nil || warning == "" {
+			t.Errorf("loadVerifiedContribution() = %q, %v; want a warning only", warning, err)
+		}
+		if _, _, err := loadVerifiedContribution("carol"); err == nil {
+			t.Error("bob's file was accepted as carol's")
+		}
+
+		if err := config.Set(requireSignedKey, "true"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadVerifiedContribution("bob"); err == nil {
+			t.Errorf("unsigned file accepted with %s set", requireSignedKey)
+		}
+	})
+}
+
+func TestOwnContributionIsVerifiedBeforeItIsRewritten(t *testing.T) {
+	repo := initTestRepo(t, "main")
+
+	withWorkingDirectory(t, repo, func() {
+		if _, untrusted, err := loadOwnContribution("alice"); err != nil || untrusted {
+			t.Fatalf("loadOwnContribution() before the first sync = %v, %v", untrusted, err)
+		}
+
+		var key ed25519.PrivateKey
+		captureStdout(t, func() {
+			var err error
+			if key, err = ensureSigningKey("alice"); err != nil {
+				t.Fatalf("ensureSigningKey() error = %v", err)
+			}
+		})
+		data := &ContributionData{Username: "alice", Contributions: []Contribution{{Date: "2024-01-01", Count: 4}}}
+		if err := signContribution(data, "alice", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, untrusted, err := loadOwnContribution("alice"); err != nil || untrusted {
+			t.Fatalf("loadOwnContribution() of a signed file = %v, %v", untrusted, err)
+		}
+
+		// A collaborator edits alice's file; her next sync must not sign it.
+		data.Contributions[0].Count = 40
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadOwnContribution("alice"); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Errorf("loadOwnContribution() of an edited file error = %v", err)
+		}
+
+		data.Signature = nil
+		if err := SaveContributionData(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, untrusted, err := loadOwnContribution("alice"); err != nil || !untrusted {
+			t.Errorf("loadOwnContribution() of an unsigned file = %v, %v; want it untrusted", untrusted, err)
+		}
+	})
+}
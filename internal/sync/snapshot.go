@@ -0,0 +1,213 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+)
+
+// Snapshots are local refs to the commit a branch was at before a sync or
+// rebuild changed it. The .vanity/ files are committed, so the commit also
+// holds the state and contribution data that match its history.
+const (
+	snapshotRefPrefix  = "refs/vanity/snapshots/"
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// DefaultKeepSnapshots is how many snapshots are kept when the settings
+// don't say
+const DefaultKeepSnapshots = 20
+
+// Snapshot is a recorded state of the sync branch
+type Snapshot struct {
+	Name string // the snapshot's time, with a suffix if several share it
+	Hash string
+}
+
+// Time returns when the snapshot was taken
+func (s Snapshot) Time() time.Time {
+	stamp, _, _ := strings.Cut(s.Name, "-")
+	t, _ := time.Parse(snapshotTimeFormat, stamp)
+	return t
+}
+
+// ListSnapshots returns the snapshots in this clone, oldest first
+func ListSnapshots() ([]Snapshot, error) {
+	refs, err := git.ListRefs(snapshotRefPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	snapshots := make([]Snapshot, len(refs))
+	for i, ref := range refs {
+		snapshots[i] = Snapshot{Name: strings.TrimPrefix(ref.Name, snapshotRefPrefix), Hash: ref.Hash}
+	}
+	return snapshots, nil
+}
+
+// recordSnapshot points a new snapshot ref at HEAD, unless the latest
+// snapshot already does, then prunes the oldest beyond e.keepSnapshots.
+// A branch with no commits has nothing to snapshot.
+func (e *Engine) recordSnapshot(now time.Time) error {
+	head, err := git.ResolveRef("HEAD")
+	if err != nil {
+		return nil
+	}
+	snapshots, err := ListSnapshots()
+	if err != nil {
+		return err
+	}
+	if n := len(snapshots); n > 0 && snapshots[n-1].Hash == head {
+		return nil
+	}
+
+	stamp := now.UTC().Format(snapshotTimeFormat)
+	name := stamp
+	for i := 2; git.RefExists(snapshotRefPrefix + name); i++ {
+		name = fmt.Sprintf("%s-%d", stamp, i)
+	}
+	if err := git.UpdateRef(snapshotRefPrefix+name, head); err != nil {
+		return err
+	}
+	_, err = pruneSnapshots(e.keepSnapshots)
+	return err
+}
+
+// pruneSnapshots deletes the oldest snapshots beyond keep (0 keeps them all)
+// and returns how many it deleted
+func pruneSnapshots(keep int) (int, error) {
+	snapshots, err := ListSnapshots()
+	if err != nil || keep <= 0 || len(snapshots) <= keep {
+		return 0, err
+	}
+	stale := snapshots[:len(snapshots)-keep]
+	for _, s := range stale {
+		if err := git.DeleteRef(snapshotRefPrefix + s.Name); err != nil {
+			return 0, fmt.Errorf("failed to delete snapshot %s: %w", s.Name, err)
+		}
+	}
+	return len(stale), nil
+}
+
+// Undo restores the latest snapshot that differs from the current branch,
+// so each undo goes back one more sync
+func (e *Engine) Undo(force bool) error {
+	snapshots, err := ListSnapshots()
+	if err != nil {
+		return err
+	}
+	head, _ := git.ResolveRef("HEAD")
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if snapshots[i].Hash != head {
+			return e.Restore(snapshots[i].Name, force)
+		}
+	}
+	return fmt.Errorf("no snapshot to undo to (one is recorded by every sync and rebuild)")
+}
+
+// Restore resets the current branch, and the .vanity/ state committed on it,
+// to a snapshot, then force-pushes it. The push only goes ahead while the
+// remote is where this clone last saw it, and a restore is refused while the
+// remote has commits this clone hasn't integrated, so it never drops another
+// account's work it hasn't seen. The commits the restore drops are listed,
+// and unless force is set it is refused when any of them were authored by
+// someone other than this account.
+func (e *Engine) Restore(name string, force bool) (err error) {
+	lock, err := acquireLock(e.username)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	name = strings.TrimPrefix(name, snapshotRefPrefix)
+	target, err := git.ResolveRef(snapshotRefPrefix + name)
+	if err != nil {
+		return fmt.Errorf("no snapshot named %s (run 'vanity snapshots' to list them)", name)
+	}
+	branch, err := git.GetCurrentBranch()
+	if err != nil {
+		return fmt.Errorf("failed to get current branch: %w", err)
+	}
+	if branch == "" {
+		return fmt.Errorf("cannot restore a snapshot onto detached HEAD")
+	}
+	if branch == rebuildBranch {
+		return fmt.Errorf("check out your sync branch before restoring; %s is left from an interrupted rebuild", rebuildBranch)
+	}
+	if git.HasUncommittedChanges() {
+		return fmt.Errorf("the working tree has uncommitted changes; commit or stash them first")
+	}
+
+	upstream := ""
+	if git.HasRemote() {
+		if err := e.fetch(); err != nil {
+			return fmt.Errorf("fetch failed: %w", err)
+		}
+		upstream = e.upstream()
+	}
+	if upstream != "" {
+		unseen, err := git.LogCommits("HEAD.." + upstream)
+		if err != nil {
+			return fmt.Errorf("failed to read history: %w", err)
+		}
+		if len(unseen) > 0 {
+			return fmt.Errorf("%s has %d commit(s) this clone hasn't integrated; run 'vanity sync' first", upstream, len(unseen))
+		}
+	}
+
+	dropped, err := git.LogCommits(target + "..HEAD")
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	own := e.ownEmails()
+	foreign := 0
+	for _, c := range dropped {
+		marker := ""
+		if !own[strings.ToLower(c.AuthorEmail)] {
+			foreign++
+			marker = " (by " + c.AuthorEmail + ")"
+		}
+		fmt.Printf("  drops %s %s%s\n", c.Hash[:12], c.Subject, marker)
+	}
+	if foreign > 0 && !force {
+		return fmt.Errorf("%d of the %d commit(s) to drop were authored by other accounts; run again with --force to drop them", foreign, len(dropped))
+	}
+
+	head, _ := git.ResolveRef("HEAD")
+	fmt.Printf("Restoring snapshot %s (%s), dropping %d commit(s)\n", name, target[:12], len(dropped))
+	if err := git.ResetHard(target); err != nil {
+		return fmt.Errorf("failed to reset %s: %w", branch, err)
+	}
+	fmt.Printf("  The branch was at %s; 'git reset --hard %s' goes back there\n", head[:12], head[:12])
+
+	if upstream == "" {
+		return nil
+	}
+	expected, err := git.ResolveRef(upstream)
+	if err != nil {
+		return err
+	}
+	remote, remoteBranch, _ := strings.Cut(upstream, "/")
+	fmt.Println("Force pushing...")
+	if err := git.PushWithLease(remote, remoteBranch, expected); err != nil {
+		return fmt.Errorf("force push failed (the remote may have moved; run 'vanity sync' and try again): %w", err)
+	}
+	return nil
+}
+
+// ownEmails are the lowercased author emails of this account's commits: its
+// mirror commit email and the identity git commits its state with
+func (e *Engine) ownEmails() map[string]bool {
+	own := make(map[string]bool)
+	for _, email := range []string{e.author.Email, git.ConfiguredIdentity().Email} {
+		if email != "" {
+			own[strings.ToLower(email)] = true
+		}
+	}
+	return own
+}
@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordSnapshotSkipsUnchangedAndPrunes(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+	withWorkingDirectory(t, repo, func() {
+		e := &Engine{keepSnapshots: 2}
+		if err := e.recordSnapshot(at); err != nil {
+			t.Fatalf("snapshot of an unborn branch: %v", err)
+		}
+		if snapshots, _ := ListSnapshots(); len(snapshots) != 0 {
+			t.Fatalf("unborn branch got snapshots %v", snapshots)
+		}
+
+		runGit(t, repo, "commit", "--allow-empty", "-m", "one")
+		_ = e.recordSnapshot(at)
+		_ = e.recordSnapshot(at.Add(time.Minute)) // nothing changed
+		runGit(t, repo, "commit", "--allow-empty", "-m", "two")
+		_ = e.recordSnapshot(at) // same second as the first
+		runGit(t, repo, "commit", "--allow-empty", "-m", "three")
+		if err := e.recordSnapshot(at.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		snapshots, err := ListSnapshots()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, s := range snapshots {
+			names = append(names, s.Name)
+		}
+		want := "20261018T090000Z-2,20261018T100000Z"
+		if strings.Join(names, ",") != want {
+			t.Errorf("snapshots = %v, want %s", names, want)
+		}
+		if head := runGit(t, repo, "rev-parse", "HEAD"); snapshots[1].Hash != head {
+			t.Errorf("latest snapshot = %s, want HEAD %s", snapshots[1].Hash, head)
+		}
+		if !snapshots[1].Time().Equal(at.Add(time.Hour)) {
+			t.Errorf("Time() = %v", snapshots[1].Time())
+		}
+	})
+}
+
+func TestUndoRestoresSnapshotAndForcePushes(t *testing.T) {
+	remote, alice, bob := initSharedRemote(t)
+	writeTestFile(t, alice, ".vanity/alice-state.json", `{"username":"alice","mirrored_counts":{}}`)
+	runGit(t, alice, "add", ".")
+	runGit(t, alice, "commit", "-m", "vanity: sync alice")
+	runGit(t, alice, "push")
+	before := runGit(t, alice, "rev-parse", "HEAD")
+
+	e := &Engine{username: "alice"}
+	withWorkingDirectory(t, alice, func() {
+		if err := e.recordSnapshot(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// A sync that went wrong.
+	commitMirror(t, alice, "bob", "2024-01-01")
+	writeTestFile(t, alice, ".vanity/alice-state.json", `{"username":"alice","mirrored_counts":{"bob":{"2024-01-01":1}}}`)
+	runGit(t, alice, "commit", "-am", "vanity: sync alice")
+	runGit(t, alice, "push")
+
+	// bob pushes too, which alice hasn't seen.
+	runGit(t, bob, "pull")
+	runGit(t, bob, "commit", "--allow-empty", "-m", "vanity: sync bob")
+	runGit(t, bob, "push")
+
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		var err error
+		captureStdout(t, func() { err = e.Undo(false) })
+		if err == nil || !strings.Contains(err.Error(), "hasn't integrated") {
+			t.Fatalf("Undo() with unseen remote commits error = %v", err)
+		}
+
+		// Once bob's commit is undone as well, alice may restore.
+		runGit(t, bob, "reset", "--hard", "HEAD~1")
+		runGit(t, bob, "push", "--force")
+		captureStdout(t, func() { err = e.Undo(false) })
+		if err != nil {
+			t.Fatalf("Undo() error = %v", err)
+		}
+		state, _ := LoadSyncState("alice")
+		if len(state.MirroredCounts) != 0 {
+			t.Errorf("state after undo = %v, want the snapshot's", state.MirroredCounts)
+		}
+	})
+
+	if head := runGit(t, alice, "rev-parse", "HEAD"); head != before {
+		t.Errorf("HEAD after undo = %s, want %s", head, before)
+	}
+	if pushed := runGit(t, alice, "--git-dir", remote, "rev-parse", "main"); pushed != before {
+		t.Errorf("remote after undo = %s, want %s", pushed, before)
+	}
+}
+
+func TestRestoreRequiresForceToDropOtherAccountsCommits(t *testing.T) {
+	_, alice, bob := initSharedRemote(t)
+	e := &Engine{username: "alice"}
+	withWorkingDirectory(t, alice, func() {
+		if err := e.recordSnapshot(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	before := runGit(t, alice, "rev-parse", "HEAD")
+
+	runGit(t, bob, "-c", "user.email=bob@example.com", "commit", "--allow-empty", "-m", "vanity: sync bob")
+	runGit(t, bob, "push")
+	runGit(t, alice, "pull")
+	runGit(t, alice, "commit", "--allow-empty", "-m", "vanity: sync alice")
+
+	withWorkingDirectory(t, alice, func() {
+		silenceStderr(t)
+		var err error
+		output := captureStdout(t, func() { err = e.Undo(false) })
+		if err == nil || !strings.Contains(err.Error(), "--force") {
+			t.Fatalf("Undo() dropping bob's commit error = %v", err)
+		}
+		if !strings.Contains(output, "vanity: sync bob (by bob@example.com)") || !strings.Contains(output, "vanity: sync alice\n") {
+			t.Errorf("dropped commits not listed:\n%s", output)
+		}
+		if head := runGit(t, alice, "rev-parse", "HEAD"); head == before {
+			t.Fatal("a refused undo reset the branch")
+		}
+
+		captureStdout(t, func() { err = e.Undo(true) })
+		if err != nil {
+			t.Fatalf("Undo(force) error = %v", err)
+		}
+	})
+	if head := runGit(t, alice, "rev-parse", "HEAD"); head != before {
+		t.Errorf("HEAD after a forced undo = %s, want %s", head, before)
+	}
+}
+
+func TestRebuildHistoryReplacesStaleRebuildBranch(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/alice.json", `{"username":"alice"}`)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-m", "initial")
+	runGit(t, repo, "branch", rebuildBranch)
+
+	withWorkingDirectory(t, repo, func() {
+		var err error
+		captureStdout(t, func() {
+			err = (&Engine{}).rebuildHistory(&SyncState{})
+		})
+		if err != nil {
+			t.Fatalf("rebuildHistory() with a stale %s error = %v", rebuildBranch, err)
+		}
+	})
+	if branches := runGit(t, repo, "branch", "--list", rebuildBranch); branches != "" {
+		t.Errorf("%s survived the rebuild", rebuildBranch)
+	}
+}
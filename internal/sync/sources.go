@@ -0,0 +1,323 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// sourcesPath is the committed manifest of imported accounts, in git-config
+// format with one [source "<name>"] section per account
+var sourcesPath = filepath.Join(vanityDir, "sources")
+
+// DefaultRefreshAge is how old an imported account's data gets before a
+// refresh imports it again
+const DefaultRefreshAge = 24 * time.Hour
+
+// maxConcurrentRefreshes bounds how many sources are fetched at once
+const maxConcurrentRefreshes = 4
+
+// Source is an imported account listed in .vanity/sources, with what is
+// needed to import it again
+type Source struct {
+	Name   string     // as stored in this repo
+	Method SourceKind // api or scrape
+	Host   string
+	Merge  MergeMode
+}
+
+// LoadSources reads the manifest of imported accounts, sorted by name
+func LoadSources() ([]Source, error) {
+	entries, err := vanityConfigList(sourcesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*Source)
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Key, "source.")
+		if !ok {
+			continue
+		}
+		dot := strings.LastIndex(rest, ".")
+		if dot < 0 {
+			continue
+		}
+		name, key := rest[:dot], rest[dot+1:]
+		s := byName[name]
+		if s == nil {
+			s = &Source{Name: name, Merge: MergeMax}
+			byName[name] = s
+		}
+		switch key {
+		case "method":
+			s.Method = SourceKind(entry.Value)
+		case "host":
+			s.Host = entry.Value
+		case "merge":
+			if s.Merge, err = ParseMergeMode(entry.Value); err != nil {
+				return nil, fmt.Errorf("%s: source %s: %w", sourcesPath, name, err)
+			}
+		}
+	}
+
+	sources := make([]Source, 0, len(byName))
+	for _, s := range byName {
+		if err := ValidateLogin(s.Name); err != nil {
+			return nil, fmt.Errorf("%s: %w", sourcesPath, err)
+		}
+		if err := checkSourceMethod(*s); err != nil {
+			return nil, fmt.Errorf("%s: %w", sourcesPath, err)
+		}
+		sources = append(sources, *s)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+	return sources, nil
+}
+
+// checkSourceMethod rejects a method Fetch can't import with, so the manifest
+// only lists accounts a refresh can fetch again
+func checkSourceMethod(s Source) error {
+	switch s.Method {
+	case SourceAPI, SourceScrape:
+		return nil
+	}
+	return fmt.Errorf("source %s has invalid method %q (want api or scrape)", s.Name, s.Method)
+}
+
+// RecordSource adds or updates an account in the manifest
+func RecordSource(s Source) error {
+	if err := checkSourceMethod(s); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(vanityDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", vanityDir, err)
+	}
+	section := "source." + s.Name
+	return vanityConfigSet(sourcesPath, [][2]string{
+		{section + ".method", string(s.Method)},
+		{section + ".host", s.Host},
+		{section + ".merge", string(s.Merge)},
+	})
+}
+
+// RemoveSource drops an account from the manifest
+func RemoveSource(name string) error {
+	return vanityConfigRemoveSection(sourcesPath, "source."+name)
+}
+
+// Import describes one import of an account's contributions
+type Import struct {
+	Login       string
+	Method      SourceKind
+	Merge       MergeMode
+	ImportedBy  string // stored name of whoever runs the import
+	ToolVersion string
+	Attestation *Attestation
+}
+
+// Fetch gets the account's full contribution history, and whether it counts
+// private contributions
+func (imp Import) Fetch() ([]github.Contribution, bool, error) {
+	switch imp.Method {
+	case SourceAPI:
+		return github.FetchAllContributions(imp.Login)
+	case SourceScrape:
+		contributions, err := github.ScrapeAllContributions(imp.Login)
+		return contributions, true, err
+	}
+	return nil, false, fmt.Errorf("importing from %s is not supported by this version of vanity", imp.Method)
+}
+
+// Host is where Fetch gets contributions from
+func (imp Import) Host() string {
+	if imp.Method == SourceScrape {
+		return github.DefaultHost
+	}
+	return github.Host()
+}
+
+// Store merges fetched contributions into the account's file under naming,
+// then signs and saves it. existing is the stored file, or nil when it could
+// not be read and is being replaced; private is what Fetch reported.
+func (imp Import) Store(naming *Naming, existing *ContributionData, fetched []github.Contribution, private bool, now time.Time) (*ContributionData, MergeSummary, error) {
+	contribs := make([]Contribution, 0, len(fetched))
+	for _, c := range fetched {
+		if c.Count > 0 {
+			contribs = append(contribs, Contribution{Date: c.Date, Count: c.Count})
+		}
+	}
+	sort.Slice(contribs, func(i, j int) bool { return contribs[i].Date < contribs[j].Date })
+
+	data := &ContributionData{
+		Username:      naming.Name(imp.Login),
+		LastUpdated:   now,
+		Contributions: contribs,
+		Provenance:    NewProvenance(imp.Method, imp.Host(), fetched, private, now),
+	}
+	data.Provenance.ImportedBy = imp.ImportedBy
+	data.Provenance.ToolVersion = imp.ToolVersion
+	data.Provenance.Attestation = imp.Attestation
+
+	var summary MergeSummary
+	if existing != nil {
+		if len(existing.Contributions) > 0 {
+			data.Contributions, summary = MergeContributions(existing.Contributions, contribs,
+				imp.Merge, data.Provenance.From, data.Provenance.To)
+		}
+		if existing.Provenance != nil {
+			if imp.Merge != MergeReplace {
+				data.Provenance.Merge(existing.Provenance)
+			}
+			// An attestation is about the account, so re-imports keep it.
+			if data.Provenance.Attestation == nil {
+				data.Provenance.Attestation = existing.Provenance.Attestation
+			}
+		}
+	}
+
+	if err := SignWithLocalKey(data, imp.ImportedBy); err != nil {
+		return nil, summary, fmt.Errorf("failed to sign contribution data: %w", err)
+	}
+	if err := SaveContributionData(data); err != nil {
+		return nil, summary, fmt.Errorf("failed to save contribution data: %w", err)
+	}
+	if err := naming.Remember(imp.Login); err != nil {
+		return nil, summary, fmt.Errorf("failed to record pseudonym: %w", err)
+	}
+	return data, summary, nil
+}
+
+// Refresh re-imports every source in the manifest that was last updated more
+// than maxAge ago and commits the result. It runs under the repository lock.
+func (e *Engine) Refresh(maxAge time.Duration) (err error) {
+	lock, err := acquireLock(e.username)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	if err := e.loadNaming(); err != nil {
+		return err
+	}
+	refreshed, refreshErr := e.refreshSources(maxAge, false)
+	if refreshed > 0 && git.HasUncommittedChanges() {
+		if err := git.Add(".vanity/"); err != nil {
+			return fmt.Errorf("failed to stage changes: %w", err)
+		}
+		if err := git.Commit("vanity: refresh imported accounts"); err != nil {
+			return fmt.Errorf("failed to commit: %w", err)
+		}
+		fmt.Println("Committed the refreshed accounts. Run 'vanity sync' to push and mirror them.")
+	}
+	return refreshErr
+}
+
+// refreshSources re-imports the stale sources. Fetches run concurrently and a
+// source that fails is reported without stopping the others, like
+// mirrorAllUsers; files are written one at a time afterwards.
+func (e *Engine) refreshSources(maxAge time.Duration, dryRun bool) (int, error) {
+	sources, err := LoadSources()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", sourcesPath, err)
+	}
+
+	now := time.Now()
+	type job struct {
+		imp      Import
+		existing *ContributionData
+		fetched  []github.Contribution
+		private  bool
+		err      error
+	}
+	var jobs []*job
+	var failures []error
+	fail := func(name string, err error) {
+		fmt.Printf("Warning: failed to refresh %s: %v\n", name, err)
+		failures = append(failures, fmt.Errorf("%s: %w", name, err))
+	}
+	for _, s := range sources {
+		login := e.naming.Display(s.Name)
+		if _, known := e.naming.Login(s.Name); e.naming.Opaque() && !known {
+			fail(s.Name, fmt.Errorf("this clone doesn't know its login (run 'vanity opaque name <login>')"))
+			continue
+		}
+		existing, err := LoadContributionData(s.Name)
+		if err != nil {
+			fail(login, err)
+			continue
+		}
+		if now.Sub(existing.LastUpdated) < maxAge {
+			continue
+		}
+		imp := Import{
+			Login:       login,
+			Method:      s.Method,
+			Merge:       s.Merge,
+			ImportedBy:  e.self(),
+			ToolVersion: e.toolVersion,
+		}
+		if s.Host != "" && s.Host != imp.Host() {
+			fail(login, fmt.Errorf("imported from %s, but gh is using %s (set GH_HOST)", s.Host, imp.Host()))
+			continue
+		}
+		jobs = append(jobs, &job{existing: existing, imp: imp})
+	}
+
+	if len(jobs) == 0 && len(failures) == 0 {
+		fmt.Println("Imported accounts are up to date")
+		return 0, nil
+	}
+	fmt.Printf("Refreshing %d imported account(s)...\n", len(jobs))
+
+	var wg stdsync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentRefreshes)
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			j.fetched, j.private, j.err = j.imp.Fetch()
+		}(j)
+	}
+	wg.Wait()
+
+	refreshed := 0
+	for _, j := range jobs {
+		name := j.imp.Login
+		if j.err != nil {
+			fail(name, j.err)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("  Would refresh %s (%d days fetched)\n", name, len(j.fetched))
+			continue
+		}
+		_, summary, err := j.imp.Store(e.naming, j.existing, j.fetched, j.private, now)
+		if err != nil {
+			fail(name, err)
+			continue
+		}
+		refreshed++
+		fmt.Printf("  Refreshed %s: %d added, %d rose, %d fell, %d disappeared\n", name,
+			len(summary.Added), len(summary.Rose), len(summary.Fell), len(summary.Disappeared))
+	}
+
+	if len(failures) > 0 {
+		return refreshed, fmt.Errorf("failed to refresh %d imported account(s): %w", len(failures), errors.Join(failures...))
+	}
+	return refreshed, nil
+}
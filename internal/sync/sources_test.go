@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+func TestSourcesManifest(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		if sources, err := LoadSources(); err != nil || len(sources) != 0 {
+			t.Fatalf("LoadSources() without a manifest = %v, %v", sources, err)
+		}
+
+		for _, s := range []Source{
+			{Name: "carol", Method: SourceScrape, Host: "github.com"},
+			{Name: "bob", Method: SourceAPI, Host: "github.example.com", Merge: MergeNewer},
+		} {
+			if err := RecordSource(s); err != nil {
+				t.Fatalf("RecordSource(%s) error = %v", s.Name, err)
+			}
+		}
+		sources, err := LoadSources()
+		if err != nil {
+			t.Fatalf("LoadSources() error = %v", err)
+		}
+		want := []Source{
+			{Name: "bob", Method: SourceAPI, Host: "github.example.com", Merge: MergeNewer},
+			{Name: "carol", Method: SourceScrape, Host: "github.com", Merge: MergeMax},
+		}
+		if len(sources) != len(want) || sources[0] != want[0] || sources[1] != want[1] {
+			t.Errorf("LoadSources() = %+v, want %+v", sources, want)
+		}
+
+		if err := RemoveSource("bob"); err != nil {
+			t.Fatalf("RemoveSource() error = %v", err)
+		}
+		if err := RemoveSource("bob"); err != nil {
+			t.Errorf("removing a missing source error = %v", err)
+		}
+		if sources, _ := LoadSources(); len(sources) != 1 || sources[0].Name != "carol" {
+			t.Errorf("after RemoveSource() sources = %+v", sources)
+		}
+
+		if err := RecordSource(Source{Name: "dave", Method: "gitlab"}); err == nil || !strings.Contains(err.Error(), "invalid method") {
+			t.Errorf("RecordSource() with an unsupported method error = %v", err)
+		}
+		for _, method := range []string{"ftp", "gitlab"} {
+			writeTestFile(t, repo, ".vanity/sources", "[source \"dave\"]\n\tmethod = "+method+"\n")
+			if _, err := LoadSources(); err == nil || !strings.Contains(err.Error(), "invalid method") {
+				t.Errorf("LoadSources() with method %s error = %v", method, err)
+			}
+		}
+	})
+}
+
+func TestImportStoreMergesAndKeepsAttestation(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","contributions":[
+		{"date":"2024-01-01","count":3},{"date":"2024-01-02","count":1}],
+		"provenance":{"kind":"api","host":"github.com","from":"2024-01-01","to":"2024-01-02",
+		"includes_private":true,"attestation":{"method":"bio","attested_by":"alice","attested_at":"2024-01-01T00:00:00Z"}}}`)
+
+	withWorkingDirectory(t, repo, func() {
+		naming, err := LoadNaming()
+		if err != nil {
+			t.Fatal(err)
+		}
+		existing, err := LoadContributionData("bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		imp := Import{Login: "bob", Method: SourceScrape, Merge: MergeMax, ImportedBy: "alice"}
+		fetched := []github.Contribution{{Date: "2024-01-02", Count: 4}, {Date: "2024-01-03", Count: 2}}
+
+		var data *ContributionData
+		var summary MergeSummary
+		captureStdout(t, func() {
+			data, summary, err = imp.Store(naming, existing, fetched, false, time.Now())
+		})
+		if err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		if len(data.Contributions) != 3 || len(summary.Added) != 1 || len(summary.Rose) != 1 {
+			t.Errorf("Store() = %+v, summary %+v", data.Contributions, summary)
+		}
+		p := data.Provenance
+		if p.Attestation == nil || p.Attestation.AttestedBy != "alice" {
+			t.Error("a re-import dropped the attestation")
+		}
+		if p.From != "2024-01-01" || !p.IncludesPrivate {
+			t.Errorf("provenance = %+v, want it widened over the stored import", p)
+		}
+
+		saved, err := LoadContributionData("bob")
+		if err != nil || len(saved.Contributions) != 3 {
+			t.Errorf("saved file = %+v, %v", saved, err)
+		}
+	})
+}
+
+func TestRefreshIsolatesFailingSources(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json", `{"username":"bob","last_updated":"2024-01-01T00:00:00Z","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/carol.json", `{"username":"carol","last_updated":"2024-01-01T00:00:00Z","contributions":[]}`)
+	writeTestFile(t, repo, ".vanity/sources", "[source \"bob\"]\n\tmethod = api\n[source \"carol\"]\n\tmethod = api\n")
+	marker := stubGitHubCLI(t)
+	silenceStderr(t)
+
+	withWorkingDirectory(t, repo, func() {
+		e := &Engine{username: "alice"}
+		if err := e.loadNaming(); err != nil {
+			t.Fatal(err)
+		}
+
+		var refreshed int
+		var err error
+		output := captureStdout(t, func() {
+			refreshed, err = e.refreshSources(time.Hour, false)
+		})
+		if err == nil || refreshed != 0 {
+			t.Fatalf("refreshSources() = %d, %v; want both sources to fail", refreshed, err)
+		}
+		for _, name := range []string{"bob", "carol"} {
+			if !strings.Contains(err.Error(), name+":") || !strings.Contains(output, "failed to refresh "+name) {
+				t.Errorf("failure of %s not reported: %v\n%s", name, err, output)
+			}
+		}
+		if _, statErr := os.Stat(marker); statErr != nil {
+			t.Error("bob was not fetched after carol failed")
+		}
+
+		os.Remove(marker)
+		captureStdout(t, func() {
+			_, err = e.refreshSources(100*365*24*time.Hour, false)
+		})
+		if err != nil {
+			t.Errorf("refreshSources() with fresh data error = %v", err)
+		}
+		if _, statErr := os.Stat(marker); statErr == nil {
+			t.Error("fresh sources were fetched")
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -11,9 +12,14 @@ const vanityDir = ".vanity"
 
 // ContributionData holds contribution history for a user
 type ContributionData struct {
+	SchemaVersion int            `json:"schema_version,omitempty"`
 	Username      string         `json:"username"`
 	LastUpdated   time.Time      `json:"last_updated"`
 	Contributions []Contribution `json:"contributions"`
+	ExportPolicy  *ExportPolicy  `json:"export_policy,omitempty"` // set when counts were transformed before export
+	Provenance    *Provenance    `json:"provenance,omitempty"`
+	Consent       *Consent       `json:"consent,omitempty"` // set by the account itself
+	Signature     *FileSignature `json:"signature,omitempty"`
 }
 
 // Contribution represents contributions for a single day
@@ -24,15 +30,35 @@ type Contribution struct {
 
 // SyncState tracks what has been synced for a user
 type SyncState struct {
+	SchemaVersion  int                       `json:"schema_version,omitempty"`
 	Username       string                    `json:"username"`
 	LastSync       time.Time                 `json:"last_sync"`
-	MirroredCounts map[string]map[string]int `json:"mirrored_counts"` // user -> date -> count mirrored
+	MirroredCounts map[string]map[string]int `json:"mirrored_counts"`         // user -> date -> count mirrored
+	HealedCounts   map[string]map[string]int `json:"healed_counts,omitempty"` // user -> date -> mirror commits recreated by verify --heal
+	OwnCounts      map[string]int            `json:"own_counts,omitempty"`    // date -> your own contributions, without mirror commits
+	Filters        *MirrorFilter             `json:"filters,omitempty"`
+
+	filterDefaults *MirrorFilter // from the sync settings, never saved
 }
 
-// LoadContributionData loads contribution data for a user
+// LoadContributionData loads contribution data for a user, in whichever
+// layout it is stored
 func LoadContributionData(username string) (*ContributionData, error) {
-	path := filepath.Join(vanityDir, username+".json")
-	data, err := os.ReadFile(path)
+	if err := ValidateLogin(username); err != nil {
+		return nil, err
+	}
+	layout, err := AccountLayout(username)
+	if err != nil {
+		return nil, err
+	}
+	if layout == LayoutSharded {
+		if _, err := os.Stat(shardDir(username)); err == nil {
+			return loadShardedContributionData(username, time.Now())
+		}
+	}
+
+	path := singlePath(username)
+	data, err := readVanityFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &ContributionData{
@@ -42,28 +68,51 @@ func LoadContributionData(username string) (*ContributionData, error) {
 		}
 		return nil, err
 	}
-
-	var contribs ContributionData
-	if err := json.Unmarshal(data, &contribs); err != nil {
+	if data, err = migrate(contributionFile, path, data); err != nil {
 		return nil, err
 	}
-	return &contribs, nil
+
+	return parseContributionData(path, data, username, time.Now())
 }
 
-// SaveContributionData saves contribution data for a user
+// SaveContributionData saves contribution data for a user in its layout,
+// refusing data that would not load back
 func SaveContributionData(data *ContributionData) error {
-	path := filepath.Join(vanityDir, data.Username+".json")
+	if err := ValidateLogin(data.Username); err != nil {
+		return err
+	}
+	layout, err := AccountLayout(data.Username)
+	if err != nil {
+		return err
+	}
+	return saveContributionDataAs(data, layout, time.Now())
+}
+
+// saveContributionDataAs validates data as one contribution file, then saves
+// it in layout
+func saveContributionDataAs(data *ContributionData, layout StorageLayout, now time.Time) error {
+	path := singlePath(data.Username)
+	data.SchemaVersion = baseSchemaVersion
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, jsonData, 0644)
+	if err := validateContributionData(path, jsonData, data, data.Username, now); err != nil {
+		return err
+	}
+	if layout == LayoutSharded {
+		return saveShardedContributionData(data, now)
+	}
+	return writeVersionedFile(path, jsonData, baseSchemaVersion)
 }
 
 // LoadSyncState loads sync state for a user
 func LoadSyncState(username string) (*SyncState, error) {
+	if err := ValidateLogin(username); err != nil {
+		return nil, err
+	}
 	path := filepath.Join(vanityDir, username+"-state.json")
-	data, err := os.ReadFile(path)
+	data, err := readVanityFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &SyncState{
@@ -73,10 +122,13 @@ func LoadSyncState(username string) (*SyncState, error) {
 		}
 		return nil, err
 	}
+	if data, err = migrate(stateFile, path, data); err != nil {
+		return nil, err
+	}
 
 	var state SyncState
 	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, err
+		return nil, jsonError(path, data, err)
 	}
 	if state.MirroredCounts == nil {
 		state.MirroredCounts = make(map[string]map[string]int)
@@ -86,15 +138,20 @@ func LoadSyncState(username string) (*SyncState, error) {
 
 // SaveSyncState saves sync state for a user
 func SaveSyncState(state *SyncState) error {
+	if err := ValidateLogin(state.Username); err != nil {
+		return err
+	}
 	path := filepath.Join(vanityDir, state.Username+"-state.json")
+	state.SchemaVersion = baseSchemaVersion
 	jsonData, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, jsonData, 0644)
+	return writeVersionedFile(path, jsonData, baseSchemaVersion)
 }
 
-// ListSyncedUsers returns a list of usernames that have contribution data
+// ListSyncedUsers returns a list of usernames that have contribution data, in
+// either layout
 func ListSyncedUsers() ([]string, error) {
 	entries, err := os.ReadDir(vanityDir)
 	if err != nil {
@@ -104,10 +161,17 @@ func ListSyncedUsers() ([]string, error) {
 	var users []string
 	for _, entry := range entries {
 		name := entry.Name()
+		if entry.IsDir() {
+			if _, err := os.Stat(filepath.Join(vanityDir, name, accountFileName)); err == nil {
+				users = append(users, name)
+			}
+			continue
+		}
 		if len(name) > 5 && name[len(name)-5:] == ".json" && (len(name) < 11 || name[len(name)-11:] != "-state.json") {
 			users = append(users, name[:len(name)-5])
 		}
 	}
+	sort.Strings(users)
 	return users, nil
 }
 
@@ -131,9 +195,43 @@ func (s *SyncState) SetMirroredCount(sourceUser, date string, count int) {
 	s.MirroredCounts[sourceUser][date] = count
 }
 
+// GetHealedCount returns how many mirror commits verify --heal recreated for a user/date
+func (s *SyncState) GetHealedCount(sourceUser, date string) int {
+	return s.HealedCounts[sourceUser][date]
+}
+
+// AddHealedCount records mirror commits recreated for a user/date, so the next
+// ones take later timestamps instead of the same ones again
+func (s *SyncState) AddHealedCount(sourceUser, date string, count int) {
+	if s.HealedCounts == nil {
+		s.HealedCounts = make(map[string]map[string]int)
+	}
+	if s.HealedCounts[sourceUser] == nil {
+		s.HealedCounts[sourceUser] = make(map[string]int)
+	}
+	s.HealedCounts[sourceUser][date] += count
+}
+
+// commitsCreated is how many mirror commits were ever created for a user/date,
+// mirrored and recreated alike, which is where the next commit's timestamp
+// continues from
+func (s *SyncState) commitsCreated(sourceUser, date string) int {
+	return s.GetMirroredCount(sourceUser, date) + s.GetHealedCount(sourceUser, date)
+}
+
+// MirroredOn is how many mirror commits were created for every source on date
+func (s *SyncState) MirroredOn(date string) int {
+	total := 0
+	for _, dates := range s.MirroredCounts {
+		total += dates[date]
+	}
+	return total
+}
+
 // ClearAllMirroredCounts resets all mirrored counts so a full rebuild will re-mirror everything
 func (s *SyncState) ClearAllMirroredCounts() {
 	s.MirroredCounts = make(map[string]map[string]int)
+	s.HealedCounts = nil
 }
 
 // GetTotalMirroredDates returns the count of unique dates mirrored from a user
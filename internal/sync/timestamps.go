@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// TimestampStrategy decides where in its day each mirror commit is placed
+type TimestampStrategy string
+
+const (
+	// TimestampsSpread spreads commits across the whole day at second
+	// resolution, so even very large counts never share a timestamp
+	TimestampsSpread TimestampStrategy = "spread"
+	// TimestampsWorkingHours spreads commits uniformly across 09:00-17:00
+	TimestampsWorkingHours TimestampStrategy = "working-hours"
+	// TimestampsJitter places commits at seeded random times within the day
+	TimestampsJitter TimestampStrategy = "jitter"
+)
+
+// Working hours used by TimestampsWorkingHours, in the configured timezone
+const (
+	workdayStartHour = 9
+	workdayEndHour   = 17
+)
+
+// goldenRatioConjugate drives the spread sequence: the fractional parts of
+// i*φ fill an interval evenly for every prefix, so commits added by a later
+// incremental sync land between the existing ones instead of on top of them.
+var goldenRatioConjugate = (math.Sqrt(5) - 1) / 2
+
+// ParseTimestampStrategy validates a strategy name from the command line
+func ParseTimestampStrategy(name string) (TimestampStrategy, error) {
+	switch s := TimestampStrategy(name); s {
+	case TimestampsSpread, TimestampsWorkingHours, TimestampsJitter:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown timestamp strategy %q (want %s, %s or %s)",
+		name, TimestampsSpread, TimestampsWorkingHours, TimestampsJitter)
+}
+
+// Timestamps returns the times for commits first..first+count-1 of a day's
+// mirror commits from source. first is how many were mirrored for the day
+// already, so incremental syncs continue the sequence, and each source gets its
+// own sequence so two sources on one day do not collide. Every time falls
+// inside date's calendar day in loc, including on daylight-saving transitions.
+func (s TimestampStrategy) Timestamps(date, source string, first, count int, loc *time.Location, seed int64) ([]time.Time, error) {
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: %w", date, err)
+	}
+
+	start := day
+	end := day.AddDate(0, 0, 1)
+	if s == TimestampsWorkingHours {
+		start = time.Date(day.Year(), day.Month(), day.Day(), workdayStartHour, 0, 0, 0, loc)
+		end = time.Date(day.Year(), day.Month(), day.Day(), workdayEndHour, 0, 0, 0, loc)
+	}
+	window := end.Sub(start).Seconds()
+
+	var rng *rand.Rand
+	if s == TimestampsJitter {
+		rng = rand.New(rand.NewSource(int64(sequenceHash(fmt.Sprintf("%d/%s/%s", seed, source, date)))))
+		// Draw the positions already used by earlier syncs so the sequence for
+		// this day stays the same however it is split across runs.
+		for i := 0; i < first; i++ {
+			rng.Float64()
+		}
+	}
+
+	phase := float64(sequenceHash(source)) / float64(math.MaxUint64)
+	timestamps := make([]time.Time, 0, count)
+	for i := first; i < first+count; i++ {
+		var fraction float64
+		if rng != nil {
+			fraction = rng.Float64()
+		} else {
+			_, fraction = math.Modf(phase + float64(i)*goldenRatioConjugate)
+		}
+		offset := time.Duration(math.Floor(fraction*window)) * time.Second
+		timestamps = append(timestamps, start.Add(offset))
+	}
+	return timestamps, nil
+}
+
+// sequenceHash turns a key into a stable number for seeding and phase offsets
+func sequenceHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
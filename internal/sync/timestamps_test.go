@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimestampsStayInsideTheCalendarDay(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+
+	// A regular day and both daylight-saving transition days.
+	for _, date := range []string{"2024-06-12", "2024-03-10", "2024-11-03"} {
+		for _, strategy := range []TimestampStrategy{TimestampsSpread, TimestampsWorkingHours, TimestampsJitter} {
+			timestamps, err := strategy.Timestamps(date, "bob", 0, 500, loc, 7)
+			if err != nil {
+				t.Fatalf("%s %s: Timestamps() error = %v", strategy, date, err)
+			}
+			if len(timestamps) != 500 {
+				t.Fatalf("%s %s: got %d timestamps, want 500", strategy, date, len(timestamps))
+			}
+			for _, ts := range timestamps {
+				if got := ts.In(loc).Format("2006-01-02"); got != date {
+					t.Fatalf("%s: timestamp %s falls on %s, want %s", strategy, ts, got, date)
+				}
+				if strategy == TimestampsWorkingHours {
+					if hour := ts.In(loc).Hour(); hour < workdayStartHour || hour >= workdayEndHour {
+						t.Fatalf("working-hours timestamp %s is outside working hours", ts)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSpreadTimestampsNeverRepeatForLargeCounts(t *testing.T) {
+	timestamps, err := TimestampsSpread.Timestamps("2024-01-02", "bob", 0, 2000, time.UTC, 0)
+	if err != nil {
+		t.Fatalf("Timestamps() error = %v", err)
+	}
+	seen := make(map[time.Time]bool)
+	for _, ts := range timestamps {
+		if seen[ts] {
+			t.Fatalf("timestamp %s repeated", ts)
+		}
+		seen[ts] = true
+	}
+}
+
+func TestTimestampsContinueAcrossIncrementalSyncs(t *testing.T) {
+	for _, strategy := range []TimestampStrategy{TimestampsSpread, TimestampsWorkingHours, TimestampsJitter} {
+		whole, err := strategy.Timestamps("2024-01-02", "bob", 0, 5, time.UTC, 42)
+		if err != nil {
+			t.Fatalf("%s: Timestamps() error = %v", strategy, err)
+		}
+		head, _ := strategy.Timestamps("2024-01-02", "bob", 0, 2, time.UTC, 42)
+		tail, _ := strategy.Timestamps("2024-01-02", "bob", 2, 3, time.UTC, 42)
+		if split := append(head, tail...); !reflect.DeepEqual(split, whole) {
+			t.Errorf("%s: split sequence %v, want %v", strategy, split, whole)
+		}
+	}
+}
+
+func TestTimestampsDifferBetweenSources(t *testing.T) {
+	for _, strategy := range []TimestampStrategy{TimestampsSpread, TimestampsJitter} {
+		bob, _ := strategy.Timestamps("2024-01-02", "bob", 0, 3, time.UTC, 0)
+		carol, _ := strategy.Timestamps("2024-01-02", "carol", 0, 3, time.UTC, 0)
+		if reflect.DeepEqual(bob, carol) {
+			t.Errorf("%s: bob and carol got the same timestamps %v", strategy, bob)
+		}
+	}
+}
+
+func TestParseTimestampStrategy(t *testing.T) {
+	if got, err := ParseTimestampStrategy("jitter"); err != nil || got != TimestampsJitter {
+		t.Fatalf("ParseTimestampStrategy(jitter) = %q, %v", got, err)
+	}
+	if _, err := ParseTimestampStrategy("hourly"); err == nil {
+		t.Fatal("ParseTimestampStrategy(hourly) error = nil, want an error")
+	}
+}
@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Default commit ceilings. A day's count above the per-day ceiling makes the
+// whole source fail, since it usually means a corrupted or inflated file; the
+// per-run ceiling just ends the run early and the next sync continues.
+const (
+	DefaultMaxDayCommits = 1000
+	DefaultMaxRunCommits = 20000
+)
+
+// maxContributionCount is the largest count a contribution file may hold for a
+// day, whatever the ceilings are set to
+const maxContributionCount = 100000
+
+// maxReportedProblems caps how many problems a validation error lists
+const maxReportedProblems = 10
+
+// GitHub logins are alphanumeric with single hyphens, at most 39 characters.
+// Older accounts may end in or double up hyphens, so only the leading
+// character is held to the current rule. Pseudonyms (v-<hex>) match as well.
+var loginPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,38}$`)
+
+// reservedNames are the files and directories in .vanity/ that hold the
+// repository's own metadata. An account by one of these names would share
+// their paths, so removing it would delete them.
+var reservedNames = map[string]bool{
+	keysDir:          true,
+	"config":         true,
+	"sources":        true,
+	"departures":     true,
+	encryptionFile:   true,
+	opaqueMarkerFile: true,
+}
+
+// ValidateLogin checks that an account name is a GitHub login, which also
+// keeps it safe to use as a file name in .vanity/
+func ValidateLogin(login string) error {
+	if !loginPattern.MatchString(login) {
+		return fmt.Errorf("invalid account name %q (GitHub logins are letters, digits and hyphens, at most 39 characters)", login)
+	}
+	if reservedNames[strings.ToLower(login)] {
+		return fmt.Errorf("account name %q is reserved for vanity's own files in .vanity/", login)
+	}
+	return nil
+}
+
+// parseContributionData decodes and validates the contribution file at path,
+// which is stored as name. Problems are reported with the line they're on.
+func parseContributionData(path string, raw []byte, name string, now time.Time) (*ContributionData, error) {
+	var data ContributionData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, jsonError(path, raw, err)
+	}
+	if err := validateContributionData(path, raw, &data, name, now); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// validateContributionData checks a decoded contribution file. raw is the
+// JSON it was decoded from, used to find line numbers.
+func validateContributionData(path string, raw []byte, data *ContributionData, name string, now time.Time) error {
+	var problems []error
+	report := func(line int, format string, args ...any) {
+		if len(problems) >= maxReportedProblems {
+			if len(problems) == maxReportedProblems {
+				problems = append(problems, fmt.Errorf("%s: more problems not shown", path))
+			}
+			return
+		}
+		location := path
+		if line > 0 {
+			location = fmt.Sprintf("%s:%d", path, line)
+		}
+		problems = append(problems, fmt.Errorf("%s: %s", location, fmt.Sprintf(format, args...)))
+	}
+
+	if err := ValidateLogin(data.Username); err != nil {
+		report(lineOfKey(raw, "username"), "%v", err)
+	} else if data.Username != name {
+		report(lineOfKey(raw, "username"), "username %q does not match the file name", data.Username)
+	}
+
+	// Calendars are in the account's timezone, which may already be a day
+	// ahead of UTC.
+	latest := now.UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	lines := contributionLines(raw)
+	seen := make(map[string]int, len(data.Contributions))
+	for i, c := range data.Contributions {
+		line := 0
+		if i < len(lines) {
+			line = lines[i]
+		}
+
+		date, err := time.Parse("2006-01-02", c.Date)
+		switch {
+		case err != nil:
+			report(line, "invalid date %q (want YYYY-MM-DD)", c.Date)
+		case date.Year() < 1970:
+			report(line, "date %s is before 1970", c.Date)
+		case c.Date > latest:
+			report(line, "date %s is in the future", c.Date)
+		}
+		if first, ok := seen[c.Date]; ok {
+			report(line, "date %s appears again (first on line %d)", c.Date, first)
+		} else {
+			seen[c.Date] = line
+		}
+		if c.Count < 0 || c.Count > maxContributionCount {
+			report(line, "count %d for %s is outside 0..%d", c.Count, c.Date, maxContributionCount)
+		}
+	}
+	if data.Consent != nil {
+		if err := data.Consent.validate(); err != nil {
+			report(lineOfKey(raw, "consent"), "%v", err)
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// jsonError turns a decoding error into one that names the file and line
+func jsonError(path string, raw []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%s:%d: invalid JSON: %w", path, lineAt(raw, syntaxErr.Offset), err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%s:%d: %w", path, lineAt(raw, typeErr.Offset), err)
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// lineAt returns the 1-based line of a byte offset, skipping whitespace so
+// an offset just after a newline reports the line that follows
+func lineAt(raw []byte, offset int64) int {
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	for offset < int64(len(raw)) && bytes.IndexByte([]byte(" \t\r\n,:"), raw[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(raw[:offset], []byte("\n")) + 1
+}
+
+// lineOfKey returns the line of a top-level key, or 0 if it can't be found
+func lineOfKey(raw []byte, key string) int {
+	line := 0
+	walkTopLevel(raw, func(k string, dec *json.Decoder) bool {
+		if k == key {
+			line = lineAt(raw, dec.InputOffset())
+			return false
+		}
+		return true
+	})
+	return line
+}
+
+// contributionLines returns the line each element of "contributions" starts
+// on. It is best effort: on anything unexpected it returns what it found.
+func contributionLines(raw []byte) []int {
+	var lines []int
+	walkTopLevel(raw, func(k string, dec *json.Decoder) bool {
+		if k != "contributions" {
+			return true
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return false
+		}
+		for dec.More() {
+			offset := dec.InputOffset()
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return false
+			}
+			lines = append(lines, lineAt(raw, offset))
+		}
+		return false
+	})
+	return lines
+}
+
+// walkTopLevel calls visit for each key of the top-level object, with the
+// decoder positioned before its value. visit returns false to stop; if it
+// returns true it must leave the value alone, and the walk skips it.
+func walkTopLevel(raw []byte, visit func(key string, dec *json.Decoder) bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		key, _ := tok.(string)
+		if !visit(key, dec) {
+			return
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateLogin(t *testing.T) {
+	for _, login := range []string{"alice", "Bob-42", "a", "old-account-", "v-3f9a1c02b7de", strings.Repeat("a", 39)} {
+		if err := ValidateLogin(login); err != nil {
+			t.Errorf("ValidateLogin(%q) error = %v", login, err)
+		}
+	}
+	for _, login := range []string{"", "../x", "a/b", "-flag", "a.b", "a b", strings.Repeat("a", 40), "keys", "Config", "sources"} {
+		if err := ValidateLogin(login); err == nil {
+			t.Errorf("ValidateLogin(%q) accepted it", login)
+		}
+	}
+}
+
+func TestParseContributionDataReportsLines(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	raw := `{
+  "username": "bob",
+  "contributions": [
+    { "date": "2024-01-01", "count": 5 },
+    { "date": "2024-13-01", "count": 1 },
+    { "date": "2024-01-01", "count": 2 },
+    { "date": "2024-02-01", "count": -3 },
+    { "date": "2024-02-02", "count": 99999999 },
+    { "date": "2030-01-01", "count": 1 }
+  ]
+}`
+	_, err := parseContributionData(".vanity/bob.json", []byte(raw), "bob", now)
+	if err == nil {
+		t.Fatal("parseContributionData() accepted an invalid file")
+	}
+	for _, want := range []string{
+		`.vanity/bob.json:5: invalid date "2024-13-01"`,
+		".vanity/bob.json:6: date 2024-01-01 appears again (first on line 4)",
+		".vanity/bob.json:7: count -3",
+		".vanity/bob.json:8: count 99999999",
+		".vanity/bob.json:9: date 2030-01-01 is in the future",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %q:\n%v", want, err)
+		}
+	}
+
+	if _, err := parseContributionData(".vanity/carol.json", []byte(`{"username":"bob","contributions":[]}`), "carol", now); err == nil {
+		t.Error("bob's file was accepted as carol's")
+	}
+	_, err = parseContributionData(".vanity/bob.json", []byte("{\n  \"username\": \"bob\",\n  \"contributions\": [\n    { \"date\": \"2024-01-01\", \"count\": \"5\" }\n  ]\n}"), "bob", now)
+	if err == nil || !strings.Contains(err.Error(), ".vanity/bob.json:4:") {
+		t.Errorf("type error = %v, want it on line 4", err)
+	}
+}
+
+func TestContributionFilesCannotEscapeVanityDir(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	withWorkingDirectory(t, repo, func() {
+		if err := SaveContributionData(&ContributionData{Username: "../x"}); err == nil {
+			t.Error("SaveContributionData() wrote outside .vanity/")
+		}
+		if _, err := LoadSyncState("../../etc/passwd"); err == nil {
+			t.Error("LoadSyncState() accepted a path")
+		}
+	})
+}
+
+func TestMirrorUserCommitLimits(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	writeTestFile(t, repo, ".vanity/bob.json",
+		`{"username":"bob","contributions":[{"date":"2024-01-02","count":4},{"date":"2024-01-03","count":3}]}`)
+
+	withWorkingDirectory(t, repo, func() {
+		captureStdout(t, func() {
+			state := &SyncState{Username: "alice"}
+			batchCount := 0
+			engine := &Engine{username: "alice", maxDayCommits: 3}
+			if _, err := engine.mirrorUser("bob", state, false, &batchCount); err == nil || !strings.Contains(err.Error(), "2024-01-02") {
+				t.Errorf("mirrorUser() over the per-day limit error = %v", err)
+			}
+			if len(state.MirroredCounts) != 0 {
+				t.Errorf("a refused source was partly mirrored: %v", state.MirroredCounts)
+			}
+
+			engine = &Engine{username: "alice", maxDayCommits: 10, maxRunCommits: 5}
+			mirrored, err := engine.mirrorUser("bob", state, false, &batchCount)
+			if err != nil {
+				t.Fatalf("mirrorUser() error = %v", err)
+			}
+			if mirrored != 5 || state.GetMirroredCount("bob", "2024-01-03") != 1 {
+				t.Errorf("mirrored %d, counts %v; want the run to stop after 5", mirrored, state.MirroredCounts)
+			}
+
+			// The next run picks up where this one stopped.
+			engine = &Engine{username: "alice", maxRunCommits: 5}
+			if mirrored, _ := engine.mirrorUser("bob", state, false, &batchCount); mirrored != 2 {
+				t.Errorf("next run mirrored %d, want the remaining 2", mirrored)
+			}
+		})
+	})
+}
@@ -0,0 +1,254 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wdm0006/vanity/internal/git"
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+// calendarWindowDays is how far back the default contribution calendar reaches,
+// and so how far back Verify can check
+const calendarWindowDays = 365
+
+// Shortfall is a day on which the contribution graph shows fewer contributions
+// than vanity expects there
+type Shortfall struct {
+	Date     string
+	Calendar int            // what the graph shows now
+	Own      int            // your own contributions, without mirror commits
+	Mirrored map[string]int // mirror commits created per source
+}
+
+// MirroredTotal is how many mirror commits were created on the day
+func (s Shortfall) MirroredTotal() int {
+	total := 0
+	for _, count := range s.Mirrored {
+		total += count
+	}
+	return total
+}
+
+// Expected is the least the graph should show: your own contributions plus
+// every mirror commit created on the day
+func (s Shortfall) Expected() int {
+	return s.Own + s.MirroredTotal()
+}
+
+// MissingMirrors is how many mirror commits the graph has dropped. A shortfall
+// larger than the day's mirror commits is in your own contributions, which
+// healing can't recreate.
+func (s Shortfall) MissingMirrors() int {
+	return min(s.MirroredTotal(), max(0, s.Expected()-s.Calendar))
+}
+
+// recordOwnCounts notes your own contributions on each fetched day, before this
+// run mirrors anything. The calendar already counts the mirror commits created
+// earlier, so they are subtracted; a day keeps its largest count, so mirror
+// commits GitHub drops later don't lower it.
+func recordOwnCounts(state *SyncState, calendar []github.Contribution) {
+	for _, c := range calendar {
+		own := c.Count - state.MirroredOn(c.Date)
+		if own <= state.OwnCounts[c.Date] {
+			continue
+		}
+		if state.OwnCounts == nil {
+			state.OwnCounts = make(map[string]int)
+		}
+		state.OwnCounts[c.Date] = own
+	}
+}
+
+// Verify refetches the contribution calendar and reports the days that fell
+// short of what was synced. With heal, it recreates the mirror commits GitHub
+// dropped and pushes them in batches.
+func (e *Engine) Verify(heal bool) (err error) {
+	if heal {
+		lock, lockErr := acquireLock(e.username)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer func() {
+			if releaseErr := lock.Release(); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}()
+	}
+
+	if err := e.loadNaming(); err != nil {
+		return err
+	}
+	state, err := LoadSyncState(e.self())
+	if err != nil {
+		return fmt.Errorf("failed to load sync state: %w", err)
+	}
+	own, err := LoadContributionData(e.self())
+	if err != nil {
+		return fmt.Errorf("failed to load contribution data: %w", err)
+	}
+
+	fmt.Printf("Fetching the contribution calendar of %s...\n", e.username)
+	calendar, _, err := github.FetchContributions(e.username, time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to fetch contributions: %w", err)
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -calendarWindowDays).Format("2006-01-02")
+	to := now.Format("2006-01-02")
+	shortfalls := findShortfalls(calendar, own, state, from, to)
+
+	if len(shortfalls) == 0 {
+		fmt.Printf("\nEvery day from %s to %s shows at least what was synced\n", from, to)
+		return nil
+	}
+
+	fmt.Printf("\n%d day(s) from %s to %s fell short:\n", len(shortfalls), from, to)
+	missing := 0
+	for _, s := range shortfalls {
+		fmt.Printf("  %s: graph shows %d, expected %d (own %d, mirrored %d)\n",
+			s.Date, s.Calendar, s.Expected(), s.Own, s.MirroredTotal())
+		missing += s.MissingMirrors()
+	}
+
+	if missing == 0 {
+		fmt.Println("\nNo mirror commits are missing; the shortfall is in your own contributions")
+		return nil
+	}
+	if !heal {
+		fmt.Printf("\n%d mirror commit(s) are missing from the graph. Run 'vanity verify --heal' to recreate them.\n", missing)
+		return nil
+	}
+	return e.healShortfalls(state, shortfalls)
+}
+
+// findShortfalls compares the calendar with your own and the mirrored counts
+// for each day in [from, to]. Days synced before own counts were recorded fall
+// back to your contribution file, less the day's mirror commits.
+func findShortfalls(calendar []github.Contribution, own *ContributionData, state *SyncState, from, to string) []Shortfall {
+	days := make(map[string]*Shortfall)
+	day := func(date string) *Shortfall {
+		if days[date] == nil {
+			days[date] = &Shortfall{Date: date, Mirrored: make(map[string]int)}
+		}
+		return days[date]
+	}
+
+	for _, c := range calendar {
+		day(c.Date).Calendar = c.Count
+	}
+	for source, dateCounts := range state.MirroredCounts {
+		for date, count := range dateCounts {
+			if count > 0 {
+				day(date).Mirrored[source] = count
+			}
+		}
+	}
+	for _, c := range own.Contributions {
+		if _, recorded := state.OwnCounts[c.Date]; !recorded {
+			day(c.Date).Own = max(0, c.Count-state.MirroredOn(c.Date))
+		}
+	}
+	for date, count := range state.OwnCounts {
+		day(date).Own = count
+	}
+
+	var shortfalls []Shortfall
+	for date, s := range days {
+		if date < from || date > to {
+			continue
+		}
+		if s.Calendar < s.Expected() {
+			shortfalls = append(shortfalls, *s)
+		}
+	}
+	sort.Slice(shortfalls, func(i, j int) bool {
+		return shortfalls[i].Date < shortfalls[j].Date
+	})
+	return shortfalls
+}
+
+// healShortfalls recreates each day's missing mirror commits. They are taken
+// from that day's sources in name order, never more than a source mirrored.
+// MirroredCounts is left alone, since the recreated commits replace dropped
+// ones rather than mirroring anything new; they are recorded as healed, so the
+// next heal or mirror continues after their timestamps.
+func (e *Engine) healShortfalls(state *SyncState, shortfalls []Shortfall) error {
+	fmt.Println("\nRecreating missing mirror commits...")
+	created := 0
+	batchCount := 0
+
+	for _, s := range shortfalls {
+		remaining := s.MissingMirrors()
+		sources := make([]string, 0, len(s.Mirrored))
+		for source := range s.Mirrored {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		for _, source := range sources {
+			if remaining == 0 {
+				break
+			}
+			count := min(remaining, s.Mirrored[source])
+			// Continue the day's timestamp sequence so recreated commits do not
+			// land on the same second as the ones GitHub dropped.
+			timestamps, err := e.commitTimestamps(s.Date, source, state.commitsCreated(source, s.Date), count)
+			if err != nil {
+				return err
+			}
+			n, err := git.CreateBackdatedCommits(timestamps, source, e.author)
+			state.AddHealedCount(source, s.Date, n)
+			created += n
+			batchCount += n
+			if err != nil {
+				return errors.Join(fmt.Errorf("failed to recreate commits for %s: %w", s.Date, err), e.commitHealedState(state))
+			}
+			remaining -= count
+
+			if e.batchSize > 0 && batchCount >= e.batchSize && git.HasRemote() {
+				fmt.Printf("  Batch pushing (%d commits so far)...\n", created)
+				if err := e.commitHealedState(state); err != nil {
+					return err
+				}
+				if err := e.pushWithRetry(); err != nil {
+					return fmt.Errorf("batch push failed: %w", err)
+				}
+				batchCount = 0
+			}
+		}
+	}
+
+	if err := e.commitHealedState(state); err != nil {
+		return err
+	}
+	if git.HasRemote() {
+		fmt.Println("Pushing changes...")
+		if err := e.pushWithRetry(); err != nil {
+			return fmt.Errorf("failed to push: %w", err)
+		}
+	}
+
+	fmt.Printf("\nRecreated %d mirror commits. GitHub can take a while to index them; run 'vanity verify' again later to check.\n", created)
+	return nil
+}
+
+// commitHealedState saves and commits the healed counts
+func (e *Engine) commitHealedState(state *SyncState) error {
+	if err := SaveSyncState(state); err != nil {
+		return fmt.Errorf("failed to save sync state: %w", err)
+	}
+	if !git.HasUncommittedChanges() {
+		return nil
+	}
+	if err := git.Add(".vanity/"); err != nil {
+		return fmt.Errorf("failed to stage changes: %w", err)
+	}
+	if err := git.Commit(e.selfMessage("vanity: heal %s", "vanity: heal")); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
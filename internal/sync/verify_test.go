@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wdm0006/vanity/internal/github"
+)
+
+func TestFindShortfalls(t *testing.T) {
+	calendar := []github.Contribution{
+		{Date: "2024-01-02", Count: 5}, // own 3 + mirrored 2, all counted
+		{Date: "2024-01-03", Count: 1}, // 3 mirrored, 2 dropped
+		{Date: "2024-01-04", Count: 2}, // own file recorded 4
+		{Date: "2024-01-05", Count: 4}, // own 4 + mirrored 1, the mirror dropped
+	}
+	own := &ContributionData{Contributions: []Contribution{
+		{Date: "2024-01-02", Count: 5},
+		{Date: "2024-01-04", Count: 4},
+		{Date: "2023-06-01", Count: 9}, // outside the window
+	}}
+	state := &SyncState{
+		MirroredCounts: map[string]map[string]int{
+			"bob":   {"2024-01-02": 2, "2024-01-03": 1, "2024-01-05": 1},
+			"carol": {"2024-01-03": 2},
+		},
+		OwnCounts: map[string]int{"2024-01-02": 3, "2024-01-05": 4},
+	}
+
+	got := findShortfalls(calendar, own, state, "2024-01-01", "2024-01-05")
+	want := []Shortfall{
+		{Date: "2024-01-03", Calendar: 1, Mirrored: map[string]int{"bob": 1, "carol": 2}},
+		{Date: "2024-01-04", Calendar: 2, Own: 4, Mirrored: map[string]int{}},
+		{Date: "2024-01-05", Calendar: 4, Own: 4, Mirrored: map[string]int{"bob": 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("findShortfalls() = %+v, want %+v", got, want)
+	}
+	for i, wantMissing := range []int{2, 0, 1} {
+		if missing := got[i].MissingMirrors(); missing != wantMissing {
+			t.Errorf("MissingMirrors() for %s = %d, want %d", got[i].Date, missing, wantMissing)
+		}
+	}
+}
+
+func TestRecordOwnCountsExcludesMirrorCommits(t *testing.T) {
+	state := &SyncState{MirroredCounts: map[string]map[string]int{"bob": {"2024-01-02": 2}}}
+
+	recordOwnCounts(state, []github.Contribution{{Date: "2024-01-02", Count: 5}, {Date: "2024-01-03", Count: 0}})
+	if want := map[string]int{"2024-01-02": 3}; !reflect.DeepEqual(state.OwnCounts, want) {
+		t.Fatalf("OwnCounts = %v, want %v", state.OwnCounts, want)
+	}
+
+	// GitHub dropping a mirror commit later must not lower the own count.
+	recordOwnCounts(state, []github.Contribution{{Date: "2024-01-02", Count: 4}})
+	if got := state.OwnCounts["2024-01-02"]; got != 3 {
+		t.Fatalf("OwnCounts[2024-01-02] after a dropped mirror = %d, want 3", got)
+	}
+}
+
+func TestHealShortfallsRecreatesOnlyMissingMirrorCommits(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	shortfalls := []Shortfall{
+		{Date: "2024-01-03", Calendar: 1, Mirrored: map[string]int{"bob": 1, "carol": 2}},
+		{Date: "2024-01-04", Calendar: 2, Own: 4, Mirrored: map[string]int{}},
+	}
+	state := &SyncState{Username: "alice", MirroredCounts: map[string]map[string]int{
+		"bob":   {"2024-01-03": 1},
+		"carol": {"2024-01-03": 2},
+	}}
+
+	withWorkingDirectory(t, repo, func() {
+		if err := os.MkdirAll(vanityDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		captureStdout(t, func() {
+			if err := (&Engine{username: "alice"}).healShortfalls(state, shortfalls); err != nil {
+				t.Fatalf("healShortfalls() error = %v", err)
+			}
+		})
+	})
+
+	lines := strings.Split(runGit(t, repo, "log", "--reverse", "--format=%ad %s", "--date=short"), "\n")
+	want := []string{
+		"2024-01-03 vanity: mirror from bob (1/1)",
+		"2024-01-03 vanity: mirror from carol (1/1)",
+	}
+	if !reflect.DeepEqual(lines[:len(lines)-1], want) || !strings.HasSuffix(lines[len(lines)-1], "vanity: heal alice") {
+		t.Fatalf("recreated commits = %q, want %q and the healed state", lines, want)
+	}
+
+	var saved *SyncState
+	withWorkingDirectory(t, repo, func() {
+		var err error
+		if saved, err = LoadSyncState("alice"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	wantHealed := map[string]map[string]int{"bob": {"2024-01-03": 1}, "carol": {"2024-01-03": 1}}
+	if !reflect.DeepEqual(saved.HealedCounts, wantHealed) {
+		t.Fatalf("saved HealedCounts = %v, want %v", saved.HealedCounts, wantHealed)
+	}
+}
+
+func TestHealShortfallsContinuesAfterEarlierHeals(t *testing.T) {
+	repo := initTestRepo(t, "main")
+	state := &SyncState{Username: "alice", MirroredCounts: map[string]map[string]int{"bob": {"2024-01-03": 1}}}
+	shortfall := []Shortfall{{Date: "2024-01-03", Mirrored: map[string]int{"bob": 1}}}
+
+	withWorkingDirectory(t, repo, func() {
+		if err := os.MkdirAll(vanityDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		e := &Engine{username: "alice"}
+		captureStdout(t, func() {
+			for i := 0; i < 2; i++ {
+				if err := e.healShortfalls(state, shortfall); err != nil {
+					t.Fatalf("healShortfalls() error = %v", err)
+				}
+			}
+		})
+	})
+
+	dates := strings.Split(runGit(t, repo, "log", "--format=%aI", "--grep", "^vanity: mirror from"), "\n")
+	if len(dates) != 2 || dates[0] == dates[1] {
+		t.Fatalf("recreated commit dates = %q, want two different timestamps", dates)
+	}
+}